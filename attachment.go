@@ -0,0 +1,142 @@
+package mimetype
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// maxPartDepth is the maximum nesting of multipart bodies and messages
+// followed by InspectMessage and InspectMultipart.
+const maxPartDepth = 16
+
+var errPartDepth = errors.New("mimetype: parts nested too deep")
+
+// Part describes a leaf part of a multipart body or of an email message.
+type Part struct {
+	// Section locates the part in the body, using the dot separated part
+	// numbers of IMAP sections, ex: "2.1" is the first part of the second part.
+	Section string
+	// Filename is the filename from the Content-Disposition header or, when
+	// missing, the name parameter of the Content-Type header.
+	Filename string
+	// Declared is the Content-Type header of the part, empty when missing.
+	Declared string
+	// Verdict holds the MIME type detected from the decoded content of the
+	// part and how it relates to Declared and Filename.
+	Verdict
+}
+
+// InspectMessage walks the RFC 5322 message read from r and returns its leaf
+// parts. Bodies with base64 or quoted-printable transfer encodings are decoded
+// before detection and message/rfc822 parts are walked as nested messages.
+//
+// When the message is malformed, the parts inspected so far are returned
+// together with the error.
+func InspectMessage(r io.Reader) ([]Part, error) {
+	var parts []Part
+	err := inspectMessage(r, "", 0, &parts)
+	return parts, err
+}
+
+// InspectMultipart is like InspectMessage, but it walks a multipart body, such
+// as multipart/form-data, delimited by boundary.
+func InspectMultipart(r io.Reader, boundary string) ([]Part, error) {
+	var parts []Part
+	err := inspectMultipart(r, boundary, "", 0, false, &parts)
+	return parts, err
+}
+
+func inspectMessage(r io.Reader, prefix string, depth int, parts *[]Part) error {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return err
+	}
+	return inspectEntity(textproto.MIMEHeader(msg.Header), msg.Body, prefix, joinSection(prefix, 1), depth, false, parts)
+}
+
+func inspectMultipart(r io.Reader, boundary, prefix string, depth int, digest bool, parts *[]Part) error {
+	mr := multipart.NewReader(r, boundary)
+	for i := 1; ; i++ {
+		// NextRawPart leaves the transfer encoding in place, so that base64 and
+		// quoted-printable are handled the same way.
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		section := joinSection(prefix, i)
+		if err := inspectEntity(p.Header, p, section, section, depth, digest, parts); err != nil {
+			return err
+		}
+	}
+}
+
+// inspectEntity inspects the body of a message or part with header h.
+// Children of multipart bodies are numbered under prefix, while a leaf body
+// is reported as section. Parts of multipart/digest bodies default to
+// message/rfc822 instead of text/plain.
+func inspectEntity(h textproto.MIMEHeader, body io.Reader, prefix, section string, depth int, digest bool, parts *[]Part) error {
+	if depth >= maxPartDepth {
+		return errPartDepth
+	}
+
+	declared := h.Get("Content-Type")
+	mediatype, params, _ := mime.ParseMediaType(declared)
+	if declared == "" && digest {
+		mediatype = "message/rfc822"
+	}
+	if strings.HasPrefix(mediatype, "multipart/") && params["boundary"] != "" {
+		return inspectMultipart(body, params["boundary"], prefix, depth+1, mediatype == "multipart/digest", parts)
+	}
+
+	body = decodeTransfer(body, h.Get("Content-Transfer-Encoding"))
+	if mediatype == "message/rfc822" {
+		return inspectMessage(body, section, depth+1, parts)
+	}
+
+	in, err := readHead(body, atomic.LoadUint32(&readLimit))
+	if err != nil {
+		return err
+	}
+	filename := params["name"]
+	if _, dparams, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil && dparams["filename"] != "" {
+		filename = dparams["filename"]
+	}
+	*parts = append(*parts, Part{
+		Section:  section,
+		Filename: filename,
+		Declared: declared,
+		Verdict:  Verify(in, declared, filename),
+	})
+
+	return nil
+}
+
+// decodeTransfer returns a reader decoding the Content-Transfer-Encoding of body.
+func decodeTransfer(body io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+func joinSection(prefix string, i int) string {
+	if prefix == "" {
+		return strconv.Itoa(i)
+	}
+	return prefix + "." + strconv.Itoa(i)
+}
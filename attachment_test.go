@@ -0,0 +1,151 @@
+package mimetype
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime/multipart"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestInspectMessage(t *testing.T) {
+	png, err := os.ReadFile("testdata/png.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf, err := os.ReadFile("testdata/pdf.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := func(b []byte) string {
+		s := base64.StdEncoding.EncodeToString(b)
+		var lines []string
+		for len(s) > 76 {
+			lines = append(lines, s[:76])
+			s = s[76:]
+		}
+		return strings.Join(append(lines, s), "\r\n")
+	}
+
+	msg := "From: a@example.com\r\n" +
+		"To: b@example.com\r\n" +
+		"Subject: files\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"preamble\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"caf=C3=A9 =\r\n" +
+		"au lait\r\n" +
+		"--outer\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: attachment; filename=\"image.png\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		b64(png) + "\r\n" +
+		"--outer\r\n" +
+		"Content-Type: image/png; name=\"invoice.png\"\r\n" +
+		"Content-Transfer-Encoding: BASE64\r\n" +
+		"\r\n" +
+		b64(pdf) + "\r\n" +
+		"--outer\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"Subject: forwarded\r\n" +
+		"Content-Type: multipart/alternative; boundary=inner\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<html><body>hi</body></html>\r\n" +
+		"--inner\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=a.gif\r\n" +
+		"\r\n" +
+		"GIF89a\r\n" +
+		"--inner--\r\n" +
+		"--outer--\r\n"
+
+	parts, err := InspectMessage(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		section, filename, detected string
+		relation                    ClaimRelation
+		extMismatch                 bool
+	}{
+		{"1", "", "text/plain; charset=utf-8", ClaimExact, false},
+		{"2", "image.png", "image/png", ClaimExact, false},
+		{"3", "invoice.png", "application/pdf; version=1.4", ClaimContradicts, true},
+		{"4.1", "", "text/html; charset=utf-8", ClaimExact, false},
+		{"4.2", "a.gif", "image/gif", ClaimAncestor, false},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("got %d parts, want %d: %+v", len(parts), len(want), parts)
+	}
+	for i, w := range want {
+		p := parts[i]
+		if p.Section != w.section || p.Filename != w.filename || p.Detected.String() != w.detected ||
+			p.Relation != w.relation || p.ExtensionMismatch != w.extMismatch {
+			t.Errorf("part %d: got {%s %s %s %s %t}, want %+v", i, p.Section, p.Filename,
+				p.Detected, p.Relation, p.ExtensionMismatch, w)
+		}
+	}
+}
+
+func TestInspectMessageSinglePart(t *testing.T) {
+	msg := "Subject: hi\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString([]byte("%PDF-1.4")) + "\r\n"
+
+	parts, err := InspectMessage(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 1 || parts[0].Section != "1" || parts[0].Declared != "" ||
+		!parts[0].Detected.Is("application/pdf") || parts[0].Relation != ClaimNone {
+		t.Errorf("got %+v", parts)
+	}
+}
+
+func TestInspectMessageDepth(t *testing.T) {
+	msg := "Subject: deep\r\n\r\nhello"
+	for i := 0; i < maxPartDepth+1; i++ {
+		msg = "Content-Type: message/rfc822\r\n\r\n" + msg
+	}
+	if _, err := InspectMessage(strings.NewReader(msg)); err != errPartDepth {
+		t.Errorf("got error %v, want %v", err, errPartDepth)
+	}
+}
+
+func TestInspectMultipart(t *testing.T) {
+	b := &bytes.Buffer{}
+	mw := multipart.NewWriter(b)
+	mw.WriteField("title", "{\"a\":1}")
+	fw, _ := mw.CreateFormFile("upload", "a.png")
+	fw.Write([]byte("GIF89a"))
+	mw.Close()
+
+	parts, err := InspectMultipart(b, mw.Boundary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	if p := parts[0]; p.Section != "1" || p.Filename != "" || !p.Detected.Is("application/json") {
+		t.Errorf("part 1: got %+v", p)
+	}
+	if p := parts[1]; p.Section != "2" || p.Filename != "a.png" || !p.Detected.Is("image/gif") ||
+		p.Declared != "application/octet-stream" || !p.ExtensionMismatch || p.Consistent() {
+		t.Errorf("part 2: got %+v", p)
+	}
+
+	if _, err := InspectMultipart(strings.NewReader("--x\r\nbroken"), "x"); err == nil {
+		t.Errorf("expected error for malformed multipart body")
+	}
+}
@@ -0,0 +1,164 @@
+package mimetype
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Cache remembers the MIME types detected for files and inputs, so that
+// detecting them again is cheap. Files are identified by their device, inode,
+// size and modification time, or by path, size and modification time on
+// systems without inodes. Other inputs are identified by a hash of the bytes
+// read for detection.
+//
+// The least recently used results are evicted once the cache is full. All the
+// results are discarded when the MIME tree is changed with Extend. Results
+// also depend on the limit set by SetLimit when they were detected.
+//
+// A Cache is safe for concurrent use.
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	// entries holds *cacheEntry values, most recently used first.
+	entries *list.List
+	index   map[cacheKey]*list.Element
+	// generation is the treeGeneration the entries were detected with.
+	generation uint64
+}
+
+// cacheKey identifies either a file, by dev, ino, path, size and mtime, or
+// a content, by sum.
+type cacheKey struct {
+	dev, ino    uint64
+	path        string
+	size, mtime int64
+	sum         [sha256.Size]byte
+	limit       uint32
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	mime *MIME
+}
+
+// NewCache returns a Cache holding at most size results. A size lower than 1
+// is treated as 1.
+func NewCache(size int) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		capacity: size,
+		entries:  list.New(),
+		index:    map[cacheKey]*list.Element{},
+	}
+}
+
+// DetectFile is like the DetectFile function, but it returns the cached
+// result when the file was already detected and was not modified since.
+func (c *Cache) DetectFile(path string) (*MIME, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return errMIME, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return errMIME, err
+	}
+
+	key := fileKey(path, fi)
+	key.limit = atomic.LoadUint32(&readLimit)
+	m, gen, ok := c.get(key)
+	if ok {
+		return m, nil
+	}
+	if m, err = detectFile(f); err != nil {
+		return m, err
+	}
+	c.add(key, m, gen)
+
+	return m, nil
+}
+
+// DetectReader is like the DetectReader function, but it returns the cached
+// result when the bytes read from r were already detected.
+func (c *Cache) DetectReader(r io.Reader) (*MIME, error) {
+	l := atomic.LoadUint32(&readLimit)
+	in, err := readHead(r, l)
+	if err != nil {
+		return errMIME, err
+	}
+
+	key := cacheKey{sum: sha256.Sum256(in), limit: l}
+	m, gen, ok := c.get(key)
+	if ok {
+		return m, nil
+	}
+	mu.RLock()
+	m = root.match(in, l)
+	mu.RUnlock()
+	c.add(key, m, gen)
+
+	return m, nil
+}
+
+// Len returns the number of cached results.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries.Len()
+}
+
+// Purge removes all the cached results.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purge()
+}
+
+func (c *Cache) purge() {
+	c.entries.Init()
+	c.index = map[cacheKey]*list.Element{}
+}
+
+// get returns the result cached for key and the tree generation it is valid
+// for. Results from older generations are discarded.
+func (c *Cache) get(key cacheKey) (*MIME, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen := atomic.LoadUint64(&treeGeneration); gen != c.generation {
+		c.purge()
+		c.generation = gen
+	}
+	e, ok := c.index[key]
+	if !ok {
+		return nil, c.generation, false
+	}
+	c.entries.MoveToFront(e)
+
+	return e.Value.(*cacheEntry).mime, c.generation, true
+}
+
+// add caches m for key, unless the tree changed since generation gen.
+func (c *Cache) add(key cacheKey, m *MIME, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.generation || gen != atomic.LoadUint64(&treeGeneration) {
+		return
+	}
+	if e, ok := c.index[key]; ok {
+		c.entries.MoveToFront(e)
+		return
+	}
+	c.index[key] = c.entries.PushFront(&cacheEntry{key: key, mime: m})
+	if c.entries.Len() > c.capacity {
+		last := c.entries.Back()
+		c.entries.Remove(last)
+		delete(c.index, last.Value.(*cacheEntry).key)
+	}
+}
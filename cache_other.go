@@ -0,0 +1,18 @@
+//go:build !unix
+
+package mimetype
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// fileKey identifies the file described by fi using its path, because this
+// system has no inodes.
+func fileKey(path string, fi fs.FileInfo) cacheKey {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	return cacheKey{path: path, size: fi.Size(), mtime: fi.ModTime().UnixNano()}
+}
@@ -0,0 +1,109 @@
+package mimetype
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheDetectFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a")
+	if err := os.WriteFile(name, []byte("GIF89a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCache(10)
+	for i := 0; i < 2; i++ {
+		m, err := c.DetectFile(name)
+		if err != nil || !m.Is("image/gif") {
+			t.Fatalf("got %s, err: %v", m, err)
+		}
+	}
+	if c.Len() != 1 {
+		t.Errorf("expected 1 cached result, got %d", c.Len())
+	}
+
+	// A modified file must be detected again.
+	if err := os.WriteFile(name, []byte("%PDF-1.7"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(name, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := c.DetectFile(name); err != nil || !m.Is("application/pdf") {
+		t.Errorf("modified file: got %s, err: %v", m, err)
+	}
+
+	if _, err := c.DetectFile(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func TestCacheDetectReader(t *testing.T) {
+	c := NewCache(2)
+	inputs := [][]byte{[]byte("GIF89a"), []byte("%PDF-1.7"), []byte("GIF89a"), []byte("<html>")}
+	want := []string{"image/gif", "application/pdf", "image/gif", "text/html"}
+	for i, in := range inputs {
+		m, err := c.DetectReader(bytes.NewReader(in))
+		if err != nil || !m.Is(want[i]) {
+			t.Errorf("input %d: got %s, want %s, err: %v", i, m, want[i], err)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected the cache to be bounded to 2 results, got %d", c.Len())
+	}
+
+	// The least recently used result, the pdf, must have been evicted.
+	c.mu.Lock()
+	for e := c.entries.Front(); e != nil; e = e.Next() {
+		if m := e.Value.(*cacheEntry).mime; m.Is("application/pdf") {
+			t.Errorf("least recently used result not evicted")
+		}
+	}
+	c.mu.Unlock()
+
+	c.Purge()
+	if c.Len() != 0 {
+		t.Errorf("expected an empty cache after Purge, got %d results", c.Len())
+	}
+}
+
+func TestCacheTreeGeneration(t *testing.T) {
+	c := NewCache(10)
+	if _, err := c.DetectReader(bytes.NewReader([]byte("GIF89a"))); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a call to Extend.
+	atomic.AddUint64(&treeGeneration, 1)
+	if _, err := c.DetectReader(bytes.NewReader([]byte("%PDF-1.7"))); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 1 {
+		t.Errorf("expected results of the old tree to be discarded, got %d results", c.Len())
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	c := NewCache(3)
+	inputs := [][]byte{[]byte("GIF89a"), []byte("%PDF-1.7"), []byte("<html>"), []byte("{}")}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.DetectReader(bytes.NewReader(inputs[(i+j)%len(inputs)]))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if c.Len() > 3 {
+		t.Errorf("cache exceeded its size: %d results", c.Len())
+	}
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package mimetype
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileKey identifies the file described by fi using its device and inode.
+func fileKey(path string, fi fs.FileInfo) cacheKey {
+	k := cacheKey{size: fi.Size(), mtime: fi.ModTime().UnixNano()}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		k.dev, k.ino = uint64(st.Dev), uint64(st.Ino)
+	} else {
+		k.path = path
+	}
+
+	return k
+}
@@ -0,0 +1,105 @@
+package mimetype
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype/internal/iana"
+)
+
+// IANAStatus is the registration status of a MIME type in the IANA Media Types
+// registry.
+type IANAStatus uint8
+
+const (
+	// IANAUnregistered is the status of MIME types missing from the registry,
+	// usually the x- prefixed or vendor variants used by various tools.
+	IANAUnregistered IANAStatus = IANAStatus(iana.Unregistered)
+	// IANARegistered is the status of MIME types present in the registry.
+	IANARegistered IANAStatus = IANAStatus(iana.Registered)
+	// IANADeprecated is the status of MIME types present in the registry, but
+	// marked as deprecated or obsoleted in favor of another MIME type.
+	IANADeprecated IANAStatus = IANAStatus(iana.Deprecated)
+)
+
+// String returns the name of the registration status.
+func (s IANAStatus) String() string {
+	switch s {
+	case IANARegistered:
+		return "registered"
+	case IANADeprecated:
+		return "deprecated"
+	default:
+		return "unregistered"
+	}
+}
+
+// Registration returns the IANA registration status of the s MIME type.
+// Any optional MIME parameters are ignored and the check is case insensitive.
+//
+// The registration status comes from a snapshot of the IANA registry embedded
+// in the package, which covers the MIME types known to mimetype and their aliases.
+func Registration(s string) IANAStatus {
+	s, _, err := mime.ParseMediaType(s)
+	if err != nil {
+		return IANAUnregistered
+	}
+	if e, ok := iana.Lookup(s); ok {
+		return IANAStatus(e.Status)
+	}
+
+	return IANAUnregistered
+}
+
+// Canonical returns the preferred name of the s MIME type. Obsolete, x- prefixed
+// and vendor aliases are mapped to the name registered with IANA, ex:
+// application/x-zip-compressed becomes application/zip. When no name is
+// registered for a format, the main MIME type used by mimetype is returned.
+// MIME types unknown to mimetype are returned as they are.
+//
+// Any optional MIME parameters are stripped and the result is lowercase, except
+// for registered names which use capital letters, ex:
+// application/vnd.ms-excel.sheet.macroEnabled.12.
+// The empty string is returned when s is not a valid MIME type.
+func Canonical(s string) string {
+	s, _, err := mime.ParseMediaType(s)
+	if err != nil {
+		return ""
+	}
+	if e, ok := iana.Lookup(s); ok {
+		if e.Preferred != "" {
+			return e.Preferred
+		}
+		if e.Status == iana.Registered {
+			return e.Name
+		}
+	}
+
+	mu.RLock()
+	m := root.lookupFold(s)
+	mu.RUnlock()
+	if m == nil {
+		return s
+	}
+	if e, ok := iana.Lookup(m.mime); ok && e.Preferred != "" {
+		return e.Preferred
+	}
+
+	return m.mime
+}
+
+// lookupFold is like lookup, but the comparison is case insensitive.
+func (m *MIME) lookupFold(mime string) *MIME {
+	for _, n := range append(m.aliases, m.mime) {
+		if strings.EqualFold(n, mime) {
+			return m
+		}
+	}
+
+	for _, c := range m.children {
+		if m := c.lookupFold(mime); m != nil {
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+// Command mimetype prints the MIME type of files, in the spirit of file(1).
+//
+// Usage:
+//
+//	mimetype [flags] [path ...]
+//
+// Each path can be a file or a directory, which is walked recursively. When no
+// path is given, or when the path is "-", the standard input is read.
+//
+// The flags are:
+//
+//	--json
+//		Print one JSON object per line instead of text.
+//	--csv
+//		Print CSV records, preceded by a header, instead of text.
+//	--mime-type
+//		Print only the MIME type, without parameters such as charset.
+//	--extension
+//		Print only the extension of the detected MIME type.
+//	--limit n
+//		Read at most n bytes for detection, 3072 by default; 0 means the
+//		whole input.
+//	--explain
+//		Also print the hierarchy of MIME types the detection went through.
+//	--expect type
+//		Check that every input is of the given MIME type or of one of its
+//		descendants.
+//
+// The exit status is 0 when all inputs were detected, and pass the --expect
+// check if one was requested, 1 when an input failed the --expect check and 2
+// when an input could not be read or the arguments are invalid.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+const (
+	exitOK = iota
+	exitUnexpected
+	exitError
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// defaultLimit is the default read limit of the mimetype package.
+const defaultLimit = 3072
+
+// config holds the command line flags.
+type config struct {
+	json, csv          bool
+	mimeOnly, extOnly  bool
+	explain            bool
+	limit              int64
+	expect             string
+	stdin              io.Reader
+	stdout, stderr     io.Writer
+	csvw               *csv.Writer
+	failed, unexpected bool
+}
+
+// result is the outcome of detecting the MIME type of one input.
+type result struct {
+	Path      string   `json:"path"`
+	MIME      string   `json:"mime,omitempty"`
+	Extension string   `json:"extension,omitempty"`
+	Hierarchy []string `json:"hierarchy,omitempty"`
+	Expected  *bool    `json:"expected,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &config{stdin: stdin, stdout: stdout, stderr: stderr}
+	fset := flag.NewFlagSet("mimetype", flag.ContinueOnError)
+	fset.SetOutput(stderr)
+	fset.BoolVar(&c.json, "json", false, "print one JSON object per line")
+	fset.BoolVar(&c.csv, "csv", false, "print CSV records")
+	fset.BoolVar(&c.mimeOnly, "mime-type", false, "print only the MIME type, without parameters")
+	fset.BoolVar(&c.extOnly, "extension", false, "print only the extension")
+	fset.BoolVar(&c.explain, "explain", false, "print the hierarchy of detected MIME types")
+	fset.Int64Var(&c.limit, "limit", defaultLimit, "read at most `n` bytes for detection, 0 for no limit")
+	fset.StringVar(&c.expect, "expect", "", "exit with status 1 unless inputs are of MIME `type`")
+	fset.Usage = func() {
+		fmt.Fprintf(stderr, "usage: mimetype [flags] [path ...]\n")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitError
+	}
+	if c.json && c.csv || c.mimeOnly && c.extOnly {
+		fmt.Fprintln(stderr, "mimetype: --json and --csv, or --mime-type and --extension, cannot be used together")
+		return exitError
+	}
+	if c.limit < 0 {
+		fmt.Fprintf(stderr, "mimetype: --limit %d is negative\n", c.limit)
+		fset.Usage()
+		return exitError
+	}
+	if c.limit > int64(^uint32(0)) {
+		fmt.Fprintf(stderr, "mimetype: --limit %d is too large\n", c.limit)
+		return exitError
+	}
+	mimetype.SetLimit(uint32(c.limit))
+
+	if c.csv {
+		c.csvw = csv.NewWriter(stdout)
+		header := []string{"path", "mime", "extension"}
+		if c.explain {
+			header = append(header, "hierarchy")
+		}
+		if c.expect != "" {
+			header = append(header, "expected")
+		}
+		c.csvw.Write(append(header, "error"))
+	}
+
+	paths := fset.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	for _, p := range paths {
+		c.detectPath(p)
+	}
+	if c.csvw != nil {
+		c.csvw.Flush()
+	}
+
+	switch {
+	case c.failed:
+		return exitError
+	case c.unexpected:
+		return exitUnexpected
+	}
+	return exitOK
+}
+
+// detectPath detects the MIME type of the file at path, or of all the files
+// under path when it is a directory.
+func (c *config) detectPath(path string) {
+	if path == "-" {
+		m, err := mimetype.DetectReader(c.stdin)
+		c.print(path, m, err)
+		return
+	}
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			c.print(p, nil, err)
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		// DetectPath reports special files, such as FIFOs, without reading
+		// them, which would block.
+		m, err := mimetype.DetectPath(p)
+		c.print(p, m, err)
+		return nil
+	})
+	if err != nil {
+		c.print(path, nil, err)
+	}
+}
+
+func (c *config) print(path string, m *mimetype.MIME, err error) {
+	r := result{Path: filepath.ToSlash(path)}
+	if err != nil {
+		c.failed = true
+		r.Error = err.Error()
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			r.Error = pathErr.Err.Error()
+		}
+	} else {
+		r.MIME = m.String()
+		if c.mimeOnly {
+			r.MIME, _, _ = strings.Cut(r.MIME, ";")
+		}
+		r.Extension = m.Extension()
+		if c.explain {
+			for p := m; p != nil; p = p.Parent() {
+				r.Hierarchy = append([]string{p.String()}, r.Hierarchy...)
+			}
+		}
+		if c.expect != "" {
+			expected := false
+			for p := m; p != nil && !expected; p = p.Parent() {
+				expected = p.Is(c.expect)
+			}
+			r.Expected = &expected
+			c.unexpected = c.unexpected || !expected
+		}
+	}
+
+	switch {
+	case c.json:
+		b, _ := json.Marshal(r)
+		fmt.Fprintf(c.stdout, "%s\n", b)
+	case c.csv:
+		record := []string{r.Path, r.MIME, r.Extension}
+		if c.explain {
+			record = append(record, strings.Join(r.Hierarchy, " > "))
+		}
+		if r.Expected != nil {
+			record = append(record, fmt.Sprint(*r.Expected))
+		} else if c.expect != "" {
+			record = append(record, "")
+		}
+		c.csvw.Write(append(record, r.Error))
+	default:
+		c.printText(r)
+	}
+}
+
+func (c *config) printText(r result) {
+	if r.Error != "" {
+		fmt.Fprintf(c.stderr, "mimetype: %s: %s\n", r.Path, r.Error)
+		return
+	}
+	out := r.MIME
+	if c.extOnly {
+		out = r.Extension
+		if out == "" {
+			out = "???"
+		}
+	}
+	if r.Expected != nil && !*r.Expected {
+		out += ", expected " + c.expect
+	}
+	fmt.Fprintf(c.stdout, "%s: %s\n", r.Path, out)
+	if c.explain {
+		fmt.Fprintf(c.stdout, "  %s\n", strings.Join(r.Hierarchy, " > "))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestGolden(t *testing.T) {
+	tcases := []struct {
+		name  string
+		args  []string
+		stdin string
+		exit  int
+	}{
+		{"dir", []string{"testdata/files"}, "", exitOK},
+		{"file", []string{"testdata/files/report.docx", "testdata/files/data.json"}, "", exitOK},
+		{"stdin", nil, "%PDF-1.7", exitOK},
+		{"stdin_dash", []string{"-", "testdata/files/notes.txt"}, "<svg></svg>", exitOK},
+		{"json", []string{"--json", "testdata/files"}, "", exitOK},
+		{"csv", []string{"--csv", "testdata/files"}, "", exitOK},
+		{"csv_explain_expect", []string{"--csv", "--explain", "--expect", "application/zip", "testdata/files/archive"}, "", exitUnexpected},
+		{"mime_type", []string{"--mime-type", "testdata/files"}, "", exitOK},
+		{"extension", []string{"--extension", "testdata/files"}, "", exitOK},
+		{"explain", []string{"--explain", "testdata/files/report.docx"}, "", exitOK},
+		{"json_explain", []string{"--json", "--explain", "testdata/files/report.docx"}, "", exitOK},
+		{"expect_ancestor", []string{"--expect", "application/zip", "testdata/files/report.docx"}, "", exitOK},
+		{"expect_fail", []string{"--expect", "text/plain", "testdata/files"}, "", exitUnexpected},
+		{"limit", []string{"--limit", "4", "testdata/files/page.html"}, "", exitOK},
+		{"missing", []string{"testdata/files/notes.txt", "testdata/missing"}, "", exitError},
+		{"json_missing", []string{"--json", "testdata/missing"}, "", exitError},
+		{"bad_flags", []string{"--json", "--csv"}, "", exitError},
+		{"negative_limit", []string{"--limit", "-1", "testdata/files/page.html"}, "", exitError},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer mimetype.SetLimit(3072)
+			out := &bytes.Buffer{}
+			if exit := run(tc.args, strings.NewReader(tc.stdin), out, out); exit != tc.exit {
+				t.Errorf("exit status: got %d, want %d", exit, tc.exit)
+			}
+
+			golden := filepath.Join("testdata", tc.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Errorf("output mismatch\ngot:\n%s\nwant:\n%s", out, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWalkFIFO(t *testing.T) {
+	dir := t.TempDir()
+	if err := syscall.Mkfifo(filepath.Join(dir, "fifo"), 0600); err != nil {
+		t.Skip(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	done := make(chan int)
+	go func() { done <- run([]string{dir}, strings.NewReader(""), out, out) }()
+	select {
+	case exit := <-done:
+		if exit != exitOK {
+			t.Errorf("exit status: got %d, want %d", exit, exitOK)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("walking a directory with a FIFO blocked")
+	}
+	want := filepath.ToSlash(dir) + "/fifo: inode/fifo\n" + filepath.ToSlash(dir) + "/notes.txt: text/plain; charset=utf-8\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
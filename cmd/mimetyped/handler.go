@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// mimeJSON is the JSON representation of a MIME type.
+type mimeJSON struct {
+	MIME      string   `json:"mime"`
+	Aliases   []string `json:"aliases"`
+	Extension string   `json:"extension"`
+	// Ancestors starts with the parent and ends with the root of the hierarchy.
+	Ancestors []string `json:"ancestors"`
+}
+
+func newMIMEJSON(m *mimetype.MIME) mimeJSON {
+	j := mimeJSON{
+		MIME:      m.String(),
+		Aliases:   m.Aliases(),
+		Extension: m.Extension(),
+		Ancestors: []string{},
+	}
+	for p := m.Parent(); p != nil; p = p.Parent() {
+		j.Ancestors = append(j.Ancestors, p.String())
+	}
+
+	return j
+}
+
+// partJSON is the detection result for one part of a multipart body.
+type partJSON struct {
+	Field    string `json:"field"`
+	Filename string `json:"filename,omitempty"`
+	mimeJSON
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// newHandler returns the handler serving all endpoints. Request bodies larger
+// than maxBody bytes are rejected.
+func newHandler(maxBody int64) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/detect", allowMethod(http.MethodPost, http.MaxBytesHandler(http.HandlerFunc(detect), maxBody)))
+	mux.Handle("/detect/batch", allowMethod(http.MethodPost, http.MaxBytesHandler(http.HandlerFunc(detectBatch), maxBody)))
+	mux.Handle("/types", allowMethod(http.MethodGet, http.HandlerFunc(types)))
+	return mux
+}
+
+func allowMethod(method string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func detect(w http.ResponseWriter, r *http.Request) {
+	m, err := mimetype.DetectReader(r.Body)
+	if err != nil {
+		writeError(w, bodyErrorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newMIMEJSON(m))
+}
+
+func detectBatch(w http.ResponseWriter, r *http.Request) {
+	mediatype, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediatype != "multipart/form-data" || params["boundary"] == "" {
+		writeError(w, http.StatusUnsupportedMediaType, errors.New("request body must be multipart/form-data"))
+		return
+	}
+
+	results := []partJSON{}
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, bodyErrorStatus(err), err)
+			return
+		}
+		m, err := mimetype.DetectReader(p)
+		if err != nil {
+			writeError(w, bodyErrorStatus(err), err)
+			return
+		}
+		results = append(results, partJSON{
+			Field:    p.FormName(),
+			Filename: p.FileName(),
+			mimeJSON: newMIMEJSON(m),
+		})
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func types(w http.ResponseWriter, r *http.Request) {
+	all := mimetype.Types()
+	out := make([]mimeJSON, 0, len(all))
+	for _, m := range all {
+		out = append(out, newMIMEJSON(m))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// bodyErrorStatus returns the status code for an error reading a request body.
+func bodyErrorStatus(err error) int {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorJSON{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
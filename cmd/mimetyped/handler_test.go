@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetect(t *testing.T) {
+	s := httptest.NewServer(newHandler(1 << 10))
+	defer s.Close()
+
+	res, err := http.Post(s.URL+"/detect", "application/octet-stream", strings.NewReader(`<?xml version="1.0"?><root/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	var got mimeJSON
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := mimeJSON{
+		MIME:      "text/xml; charset=utf-8",
+		Aliases:   []string{"application/xml"},
+		Extension: ".xml",
+		Ancestors: []string{"text/plain", "application/octet-stream"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDetectBatch(t *testing.T) {
+	b := &bytes.Buffer{}
+	mw := multipart.NewWriter(b)
+	mw.WriteField("note", "plain text")
+	fw, _ := mw.CreateFormFile("upload", "a.gif")
+	fw.Write([]byte("GIF89a"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/detect/batch", b)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	newHandler(1<<10).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got []partJSON
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d results, want 2", len(got))
+	}
+	if got[0].Field != "note" || got[0].Filename != "" || got[0].MIME != "text/plain; charset=utf-8" {
+		t.Errorf("part 1: got %+v", got[0])
+	}
+	if got[1].Field != "upload" || got[1].Filename != "a.gif" || got[1].MIME != "image/gif" ||
+		got[1].Extension != ".gif" {
+		t.Errorf("part 2: got %+v", got[1])
+	}
+}
+
+func TestTypes(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newHandler(1<<10).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/types", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got []mimeJSON
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) < 100 || got[0].MIME != "application/octet-stream" || len(got[0].Ancestors) != 0 {
+		t.Fatalf("unexpected types list, %d entries", len(got))
+	}
+	for _, m := range got {
+		if m.MIME == "application/zip" && !reflect.DeepEqual(m.Ancestors, []string{"application/octet-stream"}) {
+			t.Errorf("application/zip ancestors: got %v", m.Ancestors)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tcases := []struct {
+		name   string
+		method string
+		path   string
+		cType  string
+		body   string
+		status int
+	}{
+		{"wrong method", http.MethodGet, "/detect", "", "", http.StatusMethodNotAllowed},
+		{"wrong method types", http.MethodPost, "/types", "", "", http.StatusMethodNotAllowed},
+		{"not found", http.MethodGet, "/nope", "", "", http.StatusNotFound},
+		{"batch not multipart", http.MethodPost, "/detect/batch", "text/plain", "abc", http.StatusUnsupportedMediaType},
+		{"batch malformed", http.MethodPost, "/detect/batch", "multipart/form-data; boundary=x", "--x\r\nbroken", http.StatusBadRequest},
+		{"batch too large", http.MethodPost, "/detect/batch", "multipart/form-data; boundary=x", "--x\r\n\r\n" + strings.Repeat("a", 100), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.cType != "" {
+				req.Header.Set("Content-Type", tc.cType)
+			}
+			rec := httptest.NewRecorder()
+			newHandler(64).ServeHTTP(rec, req)
+			if rec.Code != tc.status {
+				t.Errorf("status: got %d, want %d", rec.Code, tc.status)
+			}
+		})
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- serve(ctx, "127.0.0.1:0", newHandler(64), time.Second)
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after the context was canceled")
+	}
+}
@@ -0,0 +1,99 @@
+// Command mimetyped serves MIME type detection over HTTP, for programs which
+// cannot use the Go package directly.
+//
+// Usage:
+//
+//	mimetyped [flags]
+//
+// The endpoints are:
+//
+//	POST /detect
+//		Detect the MIME type of the request body.
+//	POST /detect/batch
+//		Detect the MIME type of each part of a multipart/form-data body.
+//	GET /types
+//		List all the MIME types known to the detector.
+//
+// Responses are JSON objects describing the MIME type: its name, aliases,
+// extension and ancestors, starting with the parent.
+//
+// The flags are:
+//
+//	-addr address
+//		Listen on address; the default only accepts local connections.
+//	-limit n
+//		Read at most n bytes for detection; 0 means the whole input.
+//	-max-body n
+//		Reject requests with bodies larger than n bytes.
+//	-shutdown-timeout d
+//		Wait at most d for pending requests when stopped by a signal.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "listen on `address`")
+	limit := flag.Uint("limit", 3072, "read at most `n` bytes for detection, 0 for no limit")
+	maxBody := flag.Int64("max-body", 32<<20, "reject request bodies larger than `n` bytes")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "wait at most `d` for pending requests on shutdown")
+	flag.Parse()
+
+	if *limit > uint(^uint32(0)) {
+		fmt.Fprintf(os.Stderr, "mimetyped: -limit %d is too large\n", *limit)
+		os.Exit(2)
+	}
+	mimetype.SetLimit(uint32(*limit))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := serve(ctx, *addr, newHandler(*maxBody), *shutdownTimeout); err != nil {
+		log.Fatalf("mimetyped: %v", err)
+	}
+}
+
+// serve runs an HTTP server on addr until ctx is done, then waits for the
+// pending requests to finish, at most for shutdownTimeout.
+func serve(ctx context.Context, addr string, h http.Handler, shutdownTimeout time.Duration) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("mimetyped: listening on %s", addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("mimetyped: shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
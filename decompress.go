@@ -0,0 +1,91 @@
+package mimetype
+
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/gabriel-vasile/mimetype/internal/decompress"
+)
+
+const (
+	// maxInflate caps the decompressed bytes when there is no read limit.
+	maxInflate = 1 << 20
+	// compressedWindow is the minimum number of compressed bytes read by
+	// DetectReaderDecompressed. Bzip2 and zstd only produce output once a whole
+	// block is available, so reading just the read limit is often not enough.
+	compressedWindow = 64 << 10
+)
+
+// decompressors holds the decoders of the compression formats whose payload
+// can be detected, keyed by MIME type.
+var decompressors = map[string]func(in []byte, max int) ([]byte, error){
+	"application/gzip":    decompress.Gzip,
+	"application/x-bzip2": decompress.Bzip2,
+	"application/x-xz":    decompress.Xz,
+	"application/zstd":    decompress.Zstd,
+	"application/lzip":    decompress.Lzip,
+}
+
+// DetectDecompressed is like Detect, but when the input is compressed with
+// gzip, bzip2, xz, zstd or lzip it also decompresses the start of the input
+// and detects the MIME type of the payload. For example, a .tar.gz file has
+// application/gzip as outer MIME type and application/x-tar as inner MIME type.
+//
+// inner is nil when the input is not compressed with one of these formats or
+// when nothing could be decompressed. The decompressed bytes are capped to the
+// read limit, or to 1 MiB when the limit is 0. Inputs cut short, as usual for
+// detection buffers, are decompressed as far as possible.
+func DetectDecompressed(in []byte) (outer, inner *MIME) {
+	l := atomic.LoadUint32(&readLimit)
+	return detectDecompressed(in, l)
+}
+
+// DetectReaderDecompressed is like DetectDecompressed, but it reads the input
+// from r. At least 64 KiB of compressed data are read, or the whole input when
+// the read limit is 0.
+//
+// Any error returned is related to the reading from the input reader.
+func DetectReaderDecompressed(r io.Reader) (outer, inner *MIME, err error) {
+	l := atomic.LoadUint32(&readLimit)
+	window := l
+	if l > 0 && window < compressedWindow {
+		window = compressedWindow
+	}
+	in, err := readHead(r, window)
+	if err != nil {
+		return errMIME, nil, err
+	}
+
+	outer, inner = detectDecompressed(in, l)
+	return outer, inner, nil
+}
+
+func detectDecompressed(in []byte, l uint32) (outer, inner *MIME) {
+	head := in
+	if l > 0 && len(head) > int(l) {
+		head = head[:l]
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	outer = root.match(head, l)
+
+	var dec func([]byte, int) ([]byte, error)
+	for m := outer; m != nil && dec == nil; m = m.parent {
+		dec = decompressors[m.mime]
+	}
+	if dec == nil {
+		return outer, nil
+	}
+	max := int(l)
+	if l == 0 {
+		max = maxInflate
+	}
+	// Errors are expected for truncated inputs; whatever was decompressed
+	// before the error is still worth detecting.
+	out, _ := dec(in, max)
+	if len(out) == 0 {
+		return outer, nil
+	}
+
+	return outer, root.match(out, l)
+}
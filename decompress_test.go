@@ -0,0 +1,69 @@
+package mimetype
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectDecompressed(t *testing.T) {
+	dir := filepath.Join("internal", "decompress", "testdata")
+	tcs := []struct {
+		file  string
+		outer string
+	}{
+		{"plain.bin.gz", "application/x-compressed-tar"},
+		// The first bzip2 and zstd blocks do not fit in the read limit.
+		{"plain.bin.bz2", "application/x-bzip2"},
+		{"plain.bin.xz", "application/x-xz-compressed-tar"},
+		{"plain.bin.blocks.xz", "application/x-xz-compressed-tar"},
+		{"plain.bin.zst", "application/zstd"},
+		{"plain.bin.blocks.zst", "application/zstd"},
+		{"plain.bin.lz", "application/x-lzip-compressed-tar"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.file, func(t *testing.T) {
+			in, err := os.ReadFile(filepath.Join(dir, tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			outer, inner := DetectDecompressed(in)
+			if !outer.Is(tc.outer) {
+				t.Errorf("outer: got %s, want %s", outer, tc.outer)
+			}
+			if inner == nil || !inner.Is("application/x-tar") {
+				t.Errorf("inner: got %v, want application/x-tar", inner)
+			}
+
+			outer, inner, err = DetectReaderDecompressed(bytes.NewReader(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !outer.Is(tc.outer) {
+				t.Errorf("reader outer: got %s, want %s", outer, tc.outer)
+			}
+			if inner == nil || !inner.Is("application/x-tar") {
+				t.Errorf("reader inner: got %v, want application/x-tar", inner)
+			}
+		})
+	}
+
+	// Gzip decompresses progressively, so the payload of a truncated input is
+	// still detected.
+	in, err := os.ReadFile(filepath.Join(dir, "plain.bin.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, inner := DetectDecompressed(in[:1024]); inner == nil || !inner.Is("application/x-tar") {
+		t.Errorf("truncated gzip inner: got %v, want application/x-tar", inner)
+	}
+
+	outer, inner := DetectDecompressed([]byte("<html><body>not compressed</body></html>"))
+	if !outer.Is("text/html") || inner != nil {
+		t.Errorf("plain input: got %s and %v, want text/html and nil", outer, inner)
+	}
+	if _, inner := DetectDecompressed([]byte("\x1f\x8b\x08\x00garbage")); inner != nil {
+		t.Errorf("corrupt gzip inner: got %s, want nil", inner)
+	}
+}
@@ -0,0 +1,68 @@
+package mimetype
+
+import (
+	"mime"
+	"os"
+
+	"github.com/gabriel-vasile/mimetype/internal/magic"
+)
+
+// encryptionChecks holds the functions reporting whether the input of some
+// formats is encrypted, keyed by MIME type. Encrypted inputs are detected with
+// the encrypted=true MIME parameter, as they cannot be inspected any further.
+// Encrypted OOXML documents have their own MIME type instead,
+// application/x-ms-encrypted-ooxml, because they are not zip archives.
+var encryptionChecks = map[string]func([]byte) bool{
+	"application/pdf":              magic.PdfEncrypted,
+	"application/zip":              magic.ZipEncrypted,
+	"application/x-7z-compressed":  magic.SevenZEncrypted,
+	"application/x-rar-compressed": magic.RarEncrypted,
+}
+
+// detectEncryptedTail checks the encryption of the 7z archive f, larger than
+// the read limit l, from the header at the end of the archive. At most the
+// tail limit t is read of the header, and of its packed stream when the header
+// is compressed. m, the MIME type detected from the start of f, is returned
+// with the encrypted=true parameter when f is encrypted. The trailer of PDF
+// files is checked by detectPdfTail.
+func detectEncryptedTail(f *os.File, l, t uint32, m *MIME) *MIME {
+	if !m.Is("application/x-7z-compressed") {
+		return m
+	}
+	if _, ps, err := mime.ParseMediaType(m.mime); err != nil || ps["encrypted"] != "" {
+		return m
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.Size() <= int64(l) {
+		return m
+	}
+	size := fi.Size()
+
+	sig := make([]byte, 32)
+	if _, err := f.ReadAt(sig, 0); err != nil {
+		return m
+	}
+	off, n, ok := magic.SevenZNextHeader(sig)
+	if !ok || off >= size {
+		return m
+	}
+	max := int64(magic.MaxSevenZHeader)
+	if max > int64(t) {
+		max = int64(t)
+	}
+	if n > max {
+		n = max
+	}
+	if n > size-off {
+		n = size - off
+	}
+	hdr := make([]byte, n)
+	if _, err := f.ReadAt(hdr, off); err != nil {
+		return m
+	}
+	if !magic.SevenZHeaderEncrypted(hdr, f, max) {
+		return m
+	}
+
+	return m.withParams(map[string]string{"encrypted": "true"})
+}
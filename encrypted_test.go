@@ -0,0 +1,76 @@
+package mimetype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectFileEncrypted(t *testing.T) {
+	// The parts of the files recording the encryption are past the read limit.
+	padding := bytes.Repeat([]byte("%padding\n"), 1000)
+	pdf := func(trailer string) []byte {
+		return append(append([]byte("%PDF-1.7\n"), padding...), trailer...)
+	}
+	xrefStream := append([]byte("%PDF-1.7\n"), padding...)
+	xrefStream = append(xrefStream, fmt.Sprintf("9 0 obj\n<< /Type /XRef /Encrypt 4 0 R /Length 2000 >>\nstream\n%s\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n",
+		bytes.Repeat([]byte{0}, 2000), len(xrefStream))...)
+
+	sevenZ := func(hdr string) []byte {
+		b := make([]byte, 32, 32+len(padding)+len(hdr))
+		copy(b, "7z\xbc\xaf\x27\x1c\x00\x04")
+		binary.LittleEndian.PutUint64(b[12:], uint64(len(padding)))
+		binary.LittleEndian.PutUint64(b[20:], uint64(len(hdr)))
+		return append(append(b, padding...), hdr...)
+	}
+
+	tcs := []struct {
+		name       string
+		in         []byte
+		want       string
+		wantDetect string
+	}{{
+		"pdf trailer",
+		pdf("trailer\n<< /Size 5 /Root 1 0 R /Encrypt 4 0 R >>\nstartxref\n9\n%%EOF\n"),
+		"application/pdf; encrypted=true; version=1.7",
+		"application/pdf; version=1.7",
+	}, {
+		"pdf xref stream",
+		xrefStream,
+		"application/pdf; encrypted=true; version=1.7",
+		"application/pdf; version=1.7",
+	}, {
+		"plain pdf",
+		pdf("trailer\n<< /Size 5 /Root 1 0 R >>\nstartxref\n9\n%%EOF\n"),
+		"application/pdf; version=1.7",
+		"application/pdf; version=1.7",
+	}, {
+		"7z encrypted header",
+		sevenZ("\x17\x06\x00\x01\x09\x30\x00\x07\x0b\x01\x00\x01\x24\x06\xf1\x07\x01\x02\x13\x00"),
+		"application/x-7z-compressed; encrypted=true",
+		"application/x-7z-compressed",
+	}, {
+		"plain 7z",
+		sevenZ("\x01\x04\x06\x00\x01\x09\x30\x00"),
+		"application/x-7z-compressed",
+		"application/x-7z-compressed",
+	}}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "f")
+			if err := os.WriteFile(path, tc.in, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if m, err := DetectFile(path); err != nil || m.String() != tc.want {
+				t.Errorf("DetectFile: got %s, %v, want %s", m, err, tc.want)
+			}
+			// Only DetectFile reads past the read limit.
+			if m := Detect(tc.in); m.String() != tc.wantDetect {
+				t.Errorf("Detect: got %s, want %s", m, tc.wantDetect)
+			}
+		})
+	}
+}
@@ -55,6 +55,25 @@ func Example_whitelist() {
 	// Output: text/plain; charset=utf-8 is allowed
 }
 
+// Policy replaces hand written allow lists with rules targeting a MIME type,
+// a whole branch of the hierarchy or a risk category.
+func Example_policy() {
+	policy, err := mimetype.NewPolicy(mimetype.Deny,
+		mimetype.Rule{Action: mimetype.Deny, Category: mimetype.CategoryScript},
+		mimetype.Rule{Action: mimetype.Allow, Subtree: "text/plain"},
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, in := range []string{"plain text", "#!/usr/bin/env python\nprint(1)"} {
+		d := policy.Check([]byte(in))
+		fmt.Println(d.MIME, d.Action)
+	}
+	// Output: text/plain; charset=utf-8 allow
+	// text/x-python deny
+}
+
 // Use Extend to add support for a file format which is not detected by mimetype.
 //
 // https://www.garykessler.net/library/file_sigs.html and
@@ -71,3 +90,17 @@ func Example_extend() {
 	fmt.Println(mtype.String(), mtype.Extension())
 	// Output: text/foobar .fb
 }
+
+// Formats like SVG, RSS or GeoJSON are built on top of generic syntaxes and
+// their MIME types carry a suffix naming that syntax: +xml, +json, +zip.
+// Use MatchSuffix to treat them as the generic type.
+func Example_suffix() {
+	mtype := mimetype.Detect([]byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`))
+
+	fmt.Println(mtype.String(), mtype.Suffix())
+	fmt.Println(mtype.Is("application/xml"), mtype.IsWith("application/xml", mimetype.MatchSuffix))
+	fmt.Println(mimetype.Lookup("application/vnd.foo+json"))
+	// Output: image/svg+xml +xml
+	// false true
+	// application/json
+}
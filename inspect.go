@@ -0,0 +1,526 @@
+package mimetype
+
+import (
+	archivetar "archive/tar"
+	archivezip "archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Default limits of InspectOptions.
+const (
+	defaultInspectDepth     = 8
+	defaultInspectEntries   = 10000
+	defaultInspectExpansion = 256 << 20
+	defaultInspectRatio     = 100
+	// ratioGrace is the size up to which entries are not checked against the
+	// compression ratio limit, because small files often compress very well.
+	ratioGrace = 1 << 20
+)
+
+// ErrInspectLimit is wrapped by the errors returned by Inspect when one of
+// the limits of InspectOptions is exceeded.
+var ErrInspectLimit = errors.New("mimetype: inspection limit exceeded")
+
+var errInspectCorrupt = errors.New("mimetype: corrupt container")
+
+// InspectOptions holds the limits of Inspect, which protect against archive
+// bombs. A zero field means the default value is used.
+type InspectOptions struct {
+	// MaxDepth is the maximum nesting of containers walked. The input itself
+	// is at depth 0, so a MaxDepth of 1 only lists its entries. Defaults to 8.
+	MaxDepth int
+	// MaxEntries is the maximum number of entries listed in total.
+	// Defaults to 10000.
+	MaxEntries int
+	// MaxExpansion is the maximum number of bytes decompressed in total.
+	// Defaults to 256 MiB.
+	MaxExpansion int64
+	// MaxRatio is the maximum ratio between the decompressed and compressed
+	// sizes of an entry. Entries up to 1 MiB are not checked. Defaults to 100.
+	MaxRatio int64
+}
+
+// Entry is a file found by Inspect.
+type Entry struct {
+	// Path is the name of the entry in its container, ex: "dir/file.txt".
+	// It is empty for the input itself. The payload of a compressed file is
+	// named after the compressed file, without the compression extension.
+	Path string
+	// Size is the uncompressed size of the entry.
+	Size int64
+	// MIME is the MIME type detected from the content of the entry. It is nil
+	// when the content is not available, as for the entries of 7z archives,
+	// whose headers only are read.
+	MIME *MIME
+	// Children holds the entries of containers, in the order they are found.
+	Children []*Entry
+	// Err is set when the content of the entry could not be read or, for
+	// containers, when the entries could not be listed. Children holds the
+	// entries found before the error.
+	Err error
+}
+
+// Inspect detects the MIME type of the size bytes of r and, when r is an
+// archive or a compressed file, recursively lists and detects its entries.
+// Zip (including formats based on zip, like jar and docx), tar, ar and deb,
+// cpio, 7z, gzip, bzip2, xz, zstd and lzip are supported. Only regular files
+// are listed.
+//
+// When a limit of opts is exceeded the inspection stops, and the entries
+// found so far are returned together with an error wrapping ErrInspectLimit.
+// Other errors are reported in the Err field of the entries; the returned
+// error is only set for them when the MIME type of r could not be detected.
+func Inspect(r io.ReaderAt, size int64, opts InspectOptions) (*Entry, error) {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = defaultInspectDepth
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultInspectEntries
+	}
+	if opts.MaxExpansion <= 0 {
+		opts.MaxExpansion = defaultInspectExpansion
+	}
+	if opts.MaxRatio <= 0 {
+		opts.MaxRatio = defaultInspectRatio
+	}
+	in := &inspector{opts: opts, limit: atomic.LoadUint32(&readLimit)}
+
+	e, err := in.entry("", entrySource{size: size, ra: r}, 0)
+	if err == nil && e.MIME == nil {
+		err = e.Err
+	}
+
+	return e, err
+}
+
+// inspector holds the state of an Inspect call.
+type inspector struct {
+	opts     InspectOptions
+	limit    uint32
+	entries  int
+	expanded int64
+}
+
+// entrySource gives access to the content of an entry.
+type entrySource struct {
+	size int64
+	// ra reads the content of entries stored as is.
+	ra io.ReaderAt
+	// open returns the content of compressed entries, when ra is nil.
+	open func() (io.ReadCloser, error)
+}
+
+// walker lists the entries of the container e, whose content is r, adding them
+// with inspector.add.
+type walker func(in *inspector, e *Entry, r io.ReaderAt, size int64, depth int) error
+
+// walkerFor returns the walker for containers of type m, or nil.
+func walkerFor(m *MIME) walker {
+	for ; m != nil; m = m.parent {
+		switch m.mime {
+		case "application/zip":
+			return walkZip
+		case "application/x-tar":
+			return walkTar
+		case "application/x-archive":
+			return walkAr
+		case "application/x-cpio":
+			return walkCpio
+		case "application/x-7z-compressed":
+			return walk7z
+		}
+		if _, ok := decompressors[m.mime]; ok {
+			return walkCompressed
+		}
+	}
+
+	return nil
+}
+
+// add detects the entry path of the container e and adds it to the children
+// of e, walking it when it is a container.
+func (in *inspector) add(e *Entry, path string, src entrySource, depth int) error {
+	if err := in.count(); err != nil {
+		return err
+	}
+	child, err := in.entry(path, src, depth)
+	e.Children = append(e.Children, child)
+	return err
+}
+
+// addListed adds an entry whose content is not available to e.
+func (in *inspector) addListed(e *Entry, path string, size int64) error {
+	if err := in.count(); err != nil {
+		return err
+	}
+	e.Children = append(e.Children, &Entry{Path: path, Size: size})
+	return nil
+}
+
+func (in *inspector) count() error {
+	if in.entries >= in.opts.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrInspectLimit, in.opts.MaxEntries)
+	}
+	in.entries++
+	return nil
+}
+
+// entry detects the MIME type of an entry and walks it when it is a container
+// and depth allows it. Only limit errors are returned, other errors are kept
+// in the Err field of the entry.
+func (in *inspector) entry(path string, src entrySource, depth int) (*Entry, error) {
+	e := &Entry{Path: path, Size: src.size}
+	head, err := in.head(src)
+	if err != nil {
+		e.Err = err
+		return e, limitErr(err)
+	}
+	mu.RLock()
+	e.MIME = root.match(head, in.limit)
+	mu.RUnlock()
+
+	walk := walkerFor(e.MIME)
+	if walk == nil || depth >= in.opts.MaxDepth {
+		return e, nil
+	}
+	ra := src.ra
+	if ra == nil {
+		data, err := in.readAll(path, src)
+		if err != nil {
+			e.Err = err
+			return e, limitErr(err)
+		}
+		ra = bytes.NewReader(data)
+	}
+	if err := walk(in, e, ra, src.size, depth); err != nil {
+		if limitErr(err) != nil {
+			return e, err
+		}
+		e.Err = err
+	}
+
+	return e, nil
+}
+
+// limitErr returns err if it is about a limit being exceeded, nil otherwise.
+func limitErr(err error) error {
+	if errors.Is(err, ErrInspectLimit) {
+		return err
+	}
+	return nil
+}
+
+// head returns the bytes of src used for detection.
+func (in *inspector) head(src entrySource) ([]byte, error) {
+	n := src.size
+	if in.limit > 0 && n > int64(in.limit) {
+		n = int64(in.limit)
+	}
+	if src.ra != nil {
+		head := make([]byte, n)
+		m, err := src.ra.ReadAt(head, 0)
+		if err == io.EOF {
+			err = nil
+		}
+		return head[:m], err
+	}
+
+	rc, err := src.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	head, err := io.ReadAll(io.LimitReader(rc, n))
+	if err != nil {
+		return nil, err
+	}
+	return head, in.expand(int64(len(head)))
+}
+
+// readAll decompresses the whole content of src.
+func (in *inspector) readAll(path string, src entrySource) ([]byte, error) {
+	if src.size > in.opts.MaxExpansion-in.expanded {
+		return nil, in.expand(src.size)
+	}
+	rc, err := src.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, src.size+1))
+	if err != nil {
+		return nil, err
+	}
+	if err := in.expand(int64(len(data))); err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != src.size {
+		return nil, fmt.Errorf("%w: %s has %d bytes instead of %d", errInspectCorrupt, path, len(data), src.size)
+	}
+
+	return data, nil
+}
+
+// expand accounts for n more decompressed bytes.
+func (in *inspector) expand(n int64) error {
+	in.expanded += n
+	if in.expanded > in.opts.MaxExpansion {
+		return fmt.Errorf("%w: more than %d bytes decompressed", ErrInspectLimit, in.opts.MaxExpansion)
+	}
+	return nil
+}
+
+// checkRatio checks the compression ratio of an entry.
+func (in *inspector) checkRatio(path string, size, compressed int64) error {
+	if size <= ratioGrace || size <= compressed*in.opts.MaxRatio {
+		return nil
+	}
+	return fmt.Errorf("%w: %s has a compression ratio above %d", ErrInspectLimit, path, in.opts.MaxRatio)
+}
+
+func walkZip(in *inspector, e *Entry, r io.ReaderAt, size int64, depth int) error {
+	zr, err := archivezip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		size, compressed := int64(f.UncompressedSize64), int64(f.CompressedSize64)
+		if err := in.checkRatio(f.Name, size, compressed); err != nil {
+			return err
+		}
+		src := entrySource{size: size, open: f.Open}
+		if f.Method == archivezip.Store {
+			if off, err := f.DataOffset(); err == nil {
+				src.ra = io.NewSectionReader(r, off, size)
+			}
+		}
+		if err := in.add(e, f.Name, src, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func walkTar(in *inspector, e *Entry, r io.ReaderAt, size int64, depth int) error {
+	// The tar reader reads whole blocks, so the count is the offset of the
+	// content of the entry returned by Next.
+	cr := &countingReader{r: io.NewSectionReader(r, 0, size)}
+	tr := archivetar.NewReader(cr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != archivetar.TypeReg {
+			continue
+		}
+		if cr.n+h.Size > size {
+			return fmt.Errorf("%w: %s is truncated", errInspectCorrupt, h.Name)
+		}
+		src := entrySource{size: h.Size, ra: io.NewSectionReader(r, cr.n, h.Size)}
+		if err := in.add(e, h.Name, src, depth+1); err != nil {
+			return err
+		}
+	}
+}
+
+func walkAr(in *inspector, e *Entry, r io.ReaderAt, size int64, depth int) error {
+	var longNames []byte
+	hdr := make([]byte, 60)
+	for pos := int64(8); pos < size; {
+		if _, err := r.ReadAt(hdr, pos); err != nil {
+			return errInspectCorrupt
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if string(hdr[58:]) != "`\n" || err != nil || n < 0 {
+			return errInspectCorrupt
+		}
+		data := pos + 60
+		if data+n > size {
+			return errInspectCorrupt
+		}
+		pos = data + n + n%2
+
+		name := strings.TrimRight(string(hdr[:16]), " ")
+		switch {
+		case name == "//":
+			// GNU table of the names longer than 15 bytes.
+			if n > 1<<20 {
+				return errInspectCorrupt
+			}
+			longNames = make([]byte, n)
+			if _, err := r.ReadAt(longNames, data); err != nil {
+				return errInspectCorrupt
+			}
+			continue
+		case name == "/" || name == "/SYM64/" || strings.HasPrefix(name, "__.SYMDEF"):
+			// Symbol tables.
+			continue
+		case strings.HasPrefix(name, "#1/"):
+			// BSD names longer than 16 bytes, stored before the content.
+			l, err := strconv.ParseInt(name[3:], 10, 64)
+			if err != nil || l < 0 || l > n || l > 4096 {
+				return errInspectCorrupt
+			}
+			b := make([]byte, l)
+			if _, err := r.ReadAt(b, data); err != nil {
+				return errInspectCorrupt
+			}
+			name = strings.TrimRight(string(b), "\x00")
+			data, n = data+l, n-l
+		case len(name) > 1 && name[0] == '/':
+			off, err := strconv.Atoi(name[1:])
+			if err != nil || off < 0 || off >= len(longNames) {
+				return errInspectCorrupt
+			}
+			name, _, _ = strings.Cut(string(longNames[off:]), "/\n")
+		default:
+			name = strings.TrimSuffix(name, "/")
+		}
+		src := entrySource{size: n, ra: io.NewSectionReader(r, data, n)}
+		if err := in.add(e, name, src, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkCpio(in *inspector, e *Entry, r io.ReaderAt, size int64, depth int) error {
+	for pos := int64(0); ; {
+		hdr := make([]byte, 110)
+		if _, err := r.ReadAt(hdr[:6], pos); err != nil {
+			return errInspectCorrupt
+		}
+		var mode, n, nameSize int64
+		var err error
+		var align int64
+		switch string(hdr[:6]) {
+		case "070701", "070702": // New ASCII format, with hexadecimal fields.
+			if _, err = r.ReadAt(hdr, pos); err != nil {
+				return errInspectCorrupt
+			}
+			mode, err = cpioField(hdr[14:22], 16, err)
+			n, err = cpioField(hdr[54:62], 16, err)
+			nameSize, err = cpioField(hdr[94:102], 16, err)
+			pos += 110
+			align = 4
+		case "070707": // Old ASCII format, with octal fields.
+			hdr = hdr[:76]
+			if _, err = r.ReadAt(hdr, pos); err != nil {
+				return errInspectCorrupt
+			}
+			mode, err = cpioField(hdr[18:24], 8, err)
+			nameSize, err = cpioField(hdr[59:65], 8, err)
+			n, err = cpioField(hdr[65:76], 8, err)
+			pos += 76
+			align = 1
+		default:
+			return errInspectCorrupt
+		}
+		if err != nil || nameSize < 1 || nameSize > 4096 {
+			return errInspectCorrupt
+		}
+		name := make([]byte, nameSize)
+		if _, err := r.ReadAt(name, pos); err != nil {
+			return errInspectCorrupt
+		}
+		data := alignUp(pos+nameSize, align)
+		if n < 0 || data+n > size {
+			return errInspectCorrupt
+		}
+		pos = alignUp(data+n, align)
+
+		path := strings.TrimRight(string(name), "\x00")
+		if path == "TRAILER!!!" {
+			return nil
+		}
+		if mode&0170000 != 0100000 {
+			continue
+		}
+		src := entrySource{size: n, ra: io.NewSectionReader(r, data, n)}
+		if err := in.add(e, path, src, depth+1); err != nil {
+			return err
+		}
+	}
+}
+
+// cpioField parses a numeric field of a cpio header, unless err is not nil.
+func cpioField(b []byte, base int, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(b), base, 64)
+}
+
+func alignUp(n, align int64) int64 {
+	return (n + align - 1) / align * align
+}
+
+// walkCompressed decompresses gzip, bzip2, xz, zstd and lzip files, whose
+// payload is added as the only entry.
+func walkCompressed(in *inspector, e *Entry, r io.ReaderAt, size int64, depth int) error {
+	m := e.MIME
+	for decompressors[m.mime] == nil {
+		m = m.parent
+	}
+	name := strings.TrimSuffix(path.Base(e.Path), m.extension)
+	if e.Path == "" {
+		name = ""
+	}
+
+	max := in.opts.MaxExpansion - in.expanded + 1
+	if ratioMax := size*in.opts.MaxRatio + 1; ratioMax > ratioGrace && ratioMax < max {
+		max = ratioMax
+	}
+	// Compressed data is at most slightly larger than the decompressed data,
+	// so there is no need to read more than that.
+	if n := max + max/8 + 1<<16; n < size {
+		size = n
+	}
+	compressed := make([]byte, size)
+	if _, err := r.ReadAt(compressed, 0); err != nil && err != io.EOF {
+		return err
+	}
+	out, err := decompressors[m.mime](compressed, int(max))
+	if err := in.checkRatio(e.Path, int64(len(out)), size); err != nil {
+		return err
+	}
+	if err := in.expand(int64(len(out))); err != nil {
+		return err
+	}
+	if len(out) > 0 {
+		src := entrySource{size: int64(len(out)), ra: bytes.NewReader(out)}
+		if err := in.add(e, name, src, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
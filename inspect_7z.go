@@ -0,0 +1,58 @@
+package mimetype
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/gabriel-vasile/mimetype/internal/sevenz"
+)
+
+// maxSzHeader is the maximum size of the headers of 7z archives, once
+// decompressed.
+const maxSzHeader = 64 << 20
+
+// walk7z lists the files of 7z archives. Their content is usually compressed
+// as a whole, so only the names and sizes from the headers are listed.
+func walk7z(in *inspector, e *Entry, r io.ReaderAt, size int64, depth int) error {
+	sig := make([]byte, 32)
+	if _, err := r.ReadAt(sig, 0); err != nil {
+		return errInspectCorrupt
+	}
+	off := binary.LittleEndian.Uint64(sig[12:])
+	n := binary.LittleEndian.Uint64(sig[20:])
+	if off > uint64(size) || n > uint64(size)-32-off || n > maxSzHeader {
+		return errInspectCorrupt
+	}
+	header := make([]byte, n)
+	if _, err := r.ReadAt(header, int64(32+off)); err != nil {
+		return errInspectCorrupt
+	}
+
+	h, err := sevenz.ReadHeader(header, func(s *sevenz.Streams) ([]byte, error) {
+		for _, n := range s.PackSizes {
+			if n > uint64(size) {
+				return nil, errInspectCorrupt
+			}
+		}
+		if len(s.Folders) == 1 {
+			if err := in.expand(int64(s.Folders[0].UnpackSize())); err != nil {
+				return nil, err
+			}
+		}
+		return sevenz.Decode(r, s, maxSzHeader)
+	})
+	if errors.Is(err, sevenz.ErrCorrupt) {
+		return errInspectCorrupt
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range h.Files {
+		if err := in.addListed(e, f.Name, int64(f.Size)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
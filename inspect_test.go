@@ -0,0 +1,167 @@
+package mimetype
+
+import (
+	archivezip "archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// entryLines formats e and its children, one entry per line.
+func entryLines(e *Entry, indent string, lines *[]string) {
+	m := "-"
+	if e.MIME != nil {
+		m = e.MIME.String()
+	}
+	*lines = append(*lines, fmt.Sprintf("%s%s %d %s", indent, e.Path, e.Size, m))
+	for _, c := range e.Children {
+		entryLines(c, indent+"  ", lines)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	tcs := []struct {
+		file string
+		want []string
+	}{{
+		"deb.deb",
+		[]string{
+			" 4476 application/vnd.debian.binary-package",
+			"  debian-binary 4 text/plain; charset=utf-8",
+			"  control.tar.xz 812 application/x-xz-compressed-tar",
+			"    control.tar 10240 application/x-tar",
+			"      ./control 823 text/plain; charset=utf-8",
+			"      ./md5sums 191 text/plain; charset=utf-8",
+			"  data.tar.xz 3472 application/x-xz-compressed-tar",
+			"    data.tar 20480 application/x-tar",
+			"      ./usr/bin/virtualenv 400 text/plain; charset=utf-8",
+			"      ./usr/share/doc/virtualenv/copyright 1856 text/plain; charset=utf-8",
+			"      ./usr/share/man/man1/virtualenv.1.gz 1816 application/gzip",
+			"        virtualenv.1 4385 text/plain; charset=utf-8",
+		},
+	}, {
+		"7z.7z",
+		[]string{
+			" 258 application/x-7z-compressed",
+			"  asd.go 187 -",
+		},
+	}, {
+		"cpio.cpio",
+		[]string{
+			" 512 application/x-cpio",
+			"  cpio.txt 15 text/plain; charset=utf-8",
+		},
+	}, {
+		"a.a",
+		[]string{
+			" 1076 application/x-archive",
+			"  test.out 944 application/x-object",
+		},
+	}, {
+		"jar.jar",
+		[]string{
+			" 779 application/jar",
+			"  META-INF/MANIFEST.MF 93 text/plain; charset=utf-8",
+			"  HelloWorld.class 427 application/x-java-applet",
+		},
+	}, {
+		"png.png",
+		[]string{" 10184 image/png"},
+	}}
+	for _, tc := range tcs {
+		t.Run(tc.file, func(t *testing.T) {
+			in, err := os.ReadFile(filepath.Join(testDataDir, tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := Inspect(bytes.NewReader(in), int64(len(in)), InspectOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			entryLines(e, "", &got)
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
+
+// testZip returns a zip archive holding files, deflated.
+func testZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := archivezip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspectLimits(t *testing.T) {
+	inner := testZip(t, map[string][]byte{"a.txt": []byte("hello")})
+	nested := testZip(t, map[string][]byte{"inner.zip": inner})
+	many := testZip(t, map[string][]byte{
+		"1.txt": []byte("1"), "2.txt": []byte("2"), "3.txt": []byte("3"),
+	})
+	bomb := testZip(t, map[string][]byte{"zeros": make([]byte, 2<<20)})
+	big := testZip(t, map[string][]byte{"a.json": bytes.Repeat([]byte(`{"a":1}`), 100)})
+
+	tcs := []struct {
+		name    string
+		in      []byte
+		opts    InspectOptions
+		limit   bool
+		entries int
+	}{
+		{"depth default", nested, InspectOptions{}, false, 2},
+		{"depth 1", nested, InspectOptions{MaxDepth: 1}, false, 1},
+		{"entries", many, InspectOptions{MaxEntries: 2}, true, 2},
+		{"ratio", bomb, InspectOptions{}, true, 0},
+		{"ratio allowed", bomb, InspectOptions{MaxRatio: 10000}, false, 1},
+		{"expansion", nested, InspectOptions{MaxExpansion: int64(len(inner)) + 10}, true, 1},
+		{"expansion by detection", big, InspectOptions{MaxExpansion: 100}, true, 1},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := Inspect(bytes.NewReader(tc.in), int64(len(tc.in)), tc.opts)
+			if got := errors.Is(err, ErrInspectLimit); got != tc.limit {
+				t.Errorf("got error %v, want limit error: %t", err, tc.limit)
+			}
+			var lines []string
+			entryLines(e, "", &lines)
+			if len(lines)-1 != tc.entries {
+				t.Errorf("got %d entries, want %d:\n%s", len(lines)-1, tc.entries, strings.Join(lines, "\n"))
+			}
+		})
+	}
+}
+
+func TestInspectCorrupt(t *testing.T) {
+	for _, f := range []string{"7z.7z", "cpio.cpio", "deb.deb", "a.a", "tar.tar", "zip.zip"} {
+		in, err := os.ReadFile(filepath.Join(testDataDir, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Truncated and altered containers must not make Inspect panic.
+		for i := 0; i < len(in); i += 13 {
+			Inspect(bytes.NewReader(in[:i]), int64(i), InspectOptions{})
+			c := bytes.Clone(in)
+			c[i] ^= 0xFF
+			Inspect(bytes.NewReader(c), int64(len(c)), InspectOptions{})
+		}
+	}
+}
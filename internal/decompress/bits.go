@@ -0,0 +1,79 @@
+package decompress
+
+import "math/bits"
+
+// forwardBits reads bits from the start of a byte slice, least significant bit
+// first, as in the headers of zstd FSE tables.
+type forwardBits struct {
+	in  []byte
+	pos int // Position of the next bit.
+}
+
+// read returns the next n bits. Bits past the end of the input are zeros.
+func (b *forwardBits) read(n int) uint32 {
+	v := bitsAt(b.in, b.pos, n)
+	b.pos += n
+	return v
+}
+
+// overflowed reports whether more bits were read than available.
+func (b *forwardBits) overflowed() bool {
+	return b.pos > len(b.in)*8
+}
+
+// bytesUsed returns the number of bytes holding the bits read so far.
+func (b *forwardBits) bytesUsed() int {
+	return (b.pos + 7) / 8
+}
+
+// backwardBits reads bits from the end of a byte slice towards its start, as
+// in the zstd Huffman and sequence streams. The highest set bit of the last
+// byte marks where the stream starts.
+type backwardBits struct {
+	in  []byte
+	pos int // Position after the next bit to read.
+}
+
+func newBackwardBits(in []byte) (*backwardBits, error) {
+	if len(in) == 0 || in[len(in)-1] == 0 {
+		return nil, errCorrupt
+	}
+	last := in[len(in)-1]
+	return &backwardBits{in: in, pos: len(in)*8 - 8 + bits.Len8(last) - 1}, nil
+}
+
+// read returns the next n bits, most significant first. Bits before the
+// start of the input are zeros.
+func (b *backwardBits) read(n int) uint32 {
+	if n == 0 {
+		return 0
+	}
+	b.pos -= n
+	if b.pos >= 0 {
+		return bitsAt(b.in, b.pos, n)
+	}
+	if b.pos+n <= 0 {
+		return 0
+	}
+	return bitsAt(b.in, 0, b.pos+n) << -b.pos
+}
+
+// overflowed reports whether more bits were read than available.
+func (b *backwardBits) overflowed() bool {
+	return b.pos < 0
+}
+
+// finished reports whether all the bits were read exactly.
+func (b *backwardBits) finished() bool {
+	return b.pos == 0
+}
+
+// bitsAt returns the n bits, at most 32, starting at bit position pos of in.
+func bitsAt(in []byte, pos, n int) uint32 {
+	var v uint64
+	first := pos / 8
+	for i := 0; i < 5 && first+i < len(in); i++ {
+		v |= uint64(in[first+i]) << (8 * i)
+	}
+	return uint32(v>>(pos%8)) & (1<<n - 1)
+}
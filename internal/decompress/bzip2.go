@@ -0,0 +1,469 @@
+package decompress
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+const (
+	bzip2BlockMagic = 0x314159265359
+	bzip2EndMagic   = 0x177245385090
+	bzip2MaxLen     = 20 // Maximum length of Huffman codes.
+	bzip2GroupSize  = 50 // Symbols coded with the same Huffman tree.
+	// bzip2LookupBits is the number of bits looked up at once when decoding
+	// Huffman codes, longer codes are decoded bit by bit.
+	bzip2LookupBits = 10
+)
+
+// bzip2Magics holds the bytes fully covered by the block and end of stream
+// magics at each of the 8 possible bit offsets. Blocks are not byte aligned.
+var bzip2Magics = func() (m [16][]byte) {
+	for i, magic := range []uint64{bzip2BlockMagic, bzip2EndMagic} {
+		for k := 0; k < 8; k++ {
+			var b [8]byte
+			for j := range b {
+				b[j] = byte(magic << (16 - k) >> (56 - 8*j))
+			}
+			first := 0
+			if k > 0 {
+				first = 1
+			}
+			m[i*8+k] = b[first:6]
+		}
+	}
+	return m
+}()
+
+// bzip2CRCTable is the table of the big-endian CRC-32 used by bzip2.
+var bzip2CRCTable = func() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04C11DB7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+// bzip2Pool holds decoders for reuse. Their block buffer takes up to 3.6 MB
+// for the largest block size.
+var bzip2Pool = sync.Pool{New: func() any { return new(bzip2Decoder) }}
+
+// Bzip2 decompresses the bzip2 stream in, returning at most max bytes. Bzip2
+// blocks are decoded whole, so no output is produced unless the first block
+// is complete. Concatenated streams are supported but randomized blocks,
+// deprecated since bzip2 0.9.5, are not.
+//
+// Unlike compress/bzip2, blocks are only decoded when the input holds their
+// end, the block buffer only grows as far as the block being decoded and
+// decoders are reused between calls. Truncated inputs and small files are
+// cheap to decode.
+func Bzip2(in []byte, max int) ([]byte, error) {
+	d := bzip2Pool.Get().(*bzip2Decoder)
+	defer bzip2Pool.Put(d)
+
+	d.b = msbBits{in: in}
+	d.out = make([]byte, 0, initialSize(max))
+	d.max = max
+	err := d.decode()
+	out := d.out
+	d.b, d.out = msbBits{}, nil
+
+	return out, err
+}
+
+// bzip2Decoder holds the state kept between the blocks of bzip2 streams.
+type bzip2Decoder struct {
+	b   msbBits
+	out []byte
+	max int
+	// tt holds the bytes of the current block and, once the block is read,
+	// the links of the inverse Burrows-Wheeler transform in the upper bits.
+	tt         []uint32
+	blockSize  int
+	trees      [6]bzip2Huffman
+	selectors  []uint8
+	seqToUnseq []byte
+}
+
+// decode decodes the streams of d.b until max bytes were produced.
+func (d *bzip2Decoder) decode() error {
+	for streams := 0; ; streams++ {
+		if d.b.pos/8+4 > len(d.b.in) {
+			if streams > 0 && d.b.pos/8 == len(d.b.in) {
+				return nil
+			}
+			return io.ErrUnexpectedEOF
+		}
+		if d.b.read(24) != 'B'<<16|'Z'<<8|'h' {
+			return errCorrupt
+		}
+		level := d.b.read(8)
+		if level < '1' || level > '9' {
+			return errCorrupt
+		}
+		d.blockSize = int(level-'0') * 100000
+
+		var streamCRC uint32
+		for {
+			magic := uint64(d.b.read(24))<<24 | uint64(d.b.read(24))
+			crc := d.b.read(32)
+			if d.b.overflowed() {
+				return io.ErrUnexpectedEOF
+			}
+			if magic == bzip2EndMagic {
+				if crc != streamCRC {
+					return errCorrupt
+				}
+				break
+			}
+			if magic != bzip2BlockMagic {
+				return errCorrupt
+			}
+			// Blocks produce no output unless they are complete, so there is
+			// no point in decoding one unless its end may be in the input.
+			if !bzip2HasMagic(d.b.in[d.b.pos/8:]) {
+				return io.ErrUnexpectedEOF
+			}
+			blockCRC, err := d.block()
+			if err != nil {
+				return err
+			}
+			if len(d.out) >= d.max {
+				return nil
+			}
+			if blockCRC != crc {
+				return errCorrupt
+			}
+			streamCRC = streamCRC<<1 | streamCRC>>31
+			streamCRC ^= blockCRC
+		}
+		// Streams end on a byte boundary.
+		d.b.pos = (d.b.pos + 7) &^ 7
+	}
+}
+
+// block decodes the block after the block header and returns the CRC of its
+// output.
+func (d *bzip2Decoder) block() (uint32, error) {
+	b := &d.b
+	if b.read(1) != 0 {
+		return 0, errUnsupported
+	}
+	origPtr := int(b.read(24))
+
+	// Map of the bytes used in the block.
+	seqToUnseq := d.seqToUnseq[:0]
+	used := b.read(16)
+	for i := 0; i < 16; i++ {
+		if used&(0x8000>>i) == 0 {
+			continue
+		}
+		bits := b.read(16)
+		for j := 0; j < 16; j++ {
+			if bits&(0x8000>>j) != 0 {
+				seqToUnseq = append(seqToUnseq, byte(i*16+j))
+			}
+		}
+	}
+	d.seqToUnseq = seqToUnseq
+	if len(seqToUnseq) == 0 {
+		return 0, errCorrupt
+	}
+	numSymbols := len(seqToUnseq) + 2
+
+	numTrees := int(b.read(3))
+	numSelectors := int(b.read(15))
+	if numTrees < 2 || numTrees > 6 || numSelectors == 0 {
+		return 0, errCorrupt
+	}
+	// Selectors are move-to-front coded in unary.
+	treeMTF := [6]uint8{0, 1, 2, 3, 4, 5}
+	if cap(d.selectors) < numSelectors {
+		d.selectors = make([]uint8, numSelectors)
+	}
+	selectors := d.selectors[:numSelectors]
+	for i := range selectors {
+		j := 0
+		for b.read(1) == 1 {
+			if j++; j >= numTrees {
+				return 0, errCorrupt
+			}
+		}
+		t := treeMTF[j]
+		copy(treeMTF[1:j+1], treeMTF[:j])
+		treeMTF[0] = t
+		selectors[i] = t
+	}
+	if b.overflowed() {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	// Code lengths are delta coded.
+	trees := d.trees[:numTrees]
+	var lengths [258]uint8
+	for t := range trees {
+		length := int(b.read(5))
+		for s := range lengths[:numSymbols] {
+			for {
+				if length < 1 || length > bzip2MaxLen {
+					return 0, errCorrupt
+				}
+				if b.read(1) == 0 {
+					break
+				}
+				if b.read(1) == 0 {
+					length++
+				} else {
+					length--
+				}
+			}
+			lengths[s] = uint8(length)
+		}
+		trees[t].init(lengths[:numSymbols])
+	}
+	if b.overflowed() {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	if err := d.symbols(selectors, trees, seqToUnseq); err != nil {
+		return 0, err
+	}
+	if origPtr >= len(d.tt) {
+		return 0, errCorrupt
+	}
+
+	return d.inverse(origPtr), nil
+}
+
+// symbols decodes the Huffman coded symbols of the block into d.tt, undoing
+// the move-to-front and zero run-length coding.
+func (d *bzip2Decoder) symbols(selectors []uint8, trees []bzip2Huffman, seqToUnseq []byte) error {
+	b := &d.b
+	eob := len(seqToUnseq) + 1
+	var mtf [256]uint8
+	for i := range mtf {
+		mtf[i] = uint8(i)
+	}
+	d.tt = d.tt[:0]
+	run, runWeight := 0, 1
+	var tree *bzip2Huffman
+	for i := 0; ; i++ {
+		if i%bzip2GroupSize == 0 {
+			if i/bzip2GroupSize >= len(selectors) {
+				return errCorrupt
+			}
+			tree = &trees[selectors[i/bzip2GroupSize]]
+		}
+		sym, ok := tree.decode(b)
+		if b.overflowed() {
+			return io.ErrUnexpectedEOF
+		}
+		if !ok {
+			return errCorrupt
+		}
+
+		// RUNA and RUNB write the run length in bijective base 2.
+		if sym <= 1 {
+			if run += runWeight << sym; run > d.blockSize {
+				return errCorrupt
+			}
+			runWeight <<= 1
+			continue
+		}
+		if run > 0 {
+			if len(d.tt)+run > d.blockSize {
+				return errCorrupt
+			}
+			v := uint32(seqToUnseq[mtf[0]])
+			for ; run > 0; run-- {
+				d.tt = append(d.tt, v)
+			}
+			runWeight = 1
+		}
+		if sym == eob {
+			return nil
+		}
+
+		j := sym - 1
+		if j >= len(seqToUnseq) || len(d.tt) >= d.blockSize {
+			return errCorrupt
+		}
+		c := mtf[j]
+		copy(mtf[1:j+1], mtf[:j])
+		mtf[0] = c
+		d.tt = append(d.tt, uint32(seqToUnseq[c]))
+	}
+}
+
+// inverse undoes the Burrows-Wheeler transform and the initial run-length
+// coding of the block in d.tt, appending to d.out up to max bytes, and
+// returns the CRC of the block output.
+func (d *bzip2Decoder) inverse(origPtr int) uint32 {
+	var c [256]int
+	for _, v := range d.tt {
+		c[byte(v)]++
+	}
+	sum := 0
+	for i, n := range c {
+		c[i] = sum
+		sum += n
+	}
+	for i, v := range d.tt {
+		b := byte(v)
+		d.tt[c[b]] |= uint32(i) << 8
+		c[b]++
+	}
+
+	crc := ^uint32(0)
+	emit := func(b byte) {
+		d.out = append(d.out, b)
+		crc = crc<<8 ^ bzip2CRCTable[byte(crc>>24)^b]
+	}
+	// Runs of 4 equal bytes are followed by the number of extra repeats.
+	last, repeats := -1, 0
+	pos := d.tt[origPtr] >> 8
+	for i := 0; i < len(d.tt) && len(d.out) < d.max; i++ {
+		pos = d.tt[pos]
+		b := byte(pos)
+		pos >>= 8
+		if repeats == 4 {
+			for n := int(b); n > 0 && len(d.out) < d.max; n-- {
+				emit(byte(last))
+			}
+			repeats = 0
+			continue
+		}
+		if int(b) == last {
+			repeats++
+		} else {
+			last, repeats = int(b), 1
+		}
+		emit(b)
+	}
+
+	return ^crc
+}
+
+// bzip2Huffman is a canonical Huffman code of a bzip2 block.
+type bzip2Huffman struct {
+	// count holds the number of codes of each length, first the first code of
+	// each length and index the position of its symbol in symbols.
+	count, first, index [bzip2MaxLen + 1]int
+	symbols             [258]uint16
+	maxLen              int
+	// lookup maps the next bzip2LookupBits bits to the symbol shifted left by
+	// 5 and the code length, or to 0 for longer codes.
+	lookup [1 << bzip2LookupBits]uint16
+}
+
+// init builds the code from the code length of each symbol.
+func (h *bzip2Huffman) init(lengths []uint8) {
+	h.count, h.maxLen = [bzip2MaxLen + 1]int{}, 0
+	for _, l := range lengths {
+		h.count[l]++
+		if int(l) > h.maxLen {
+			h.maxLen = int(l)
+		}
+	}
+	code, index := 0, 0
+	for l := 1; l <= h.maxLen; l++ {
+		h.first[l] = code
+		h.index[l] = index
+		code = (code + h.count[l]) << 1
+		index += h.count[l]
+	}
+	next := h.index
+	for s, l := range lengths {
+		h.symbols[next[l]] = uint16(s)
+		next[l]++
+	}
+
+	h.lookup = [1 << bzip2LookupBits]uint16{}
+	for l := 1; l <= h.maxLen && l <= bzip2LookupBits; l++ {
+		shift := bzip2LookupBits - l
+		for i := 0; i < h.count[l]; i++ {
+			start := (h.first[l] + i) << shift
+			if start+1<<shift > len(h.lookup) {
+				break
+			}
+			e := h.symbols[h.index[l]+i]<<5 | uint16(l)
+			for j := start; j < start+1<<shift; j++ {
+				h.lookup[j] = e
+			}
+		}
+	}
+}
+
+// decode reads the next symbol. ok is false for bits that are not a code.
+func (h *bzip2Huffman) decode(b *msbBits) (sym int, ok bool) {
+	if e := h.lookup[b.peek(bzip2LookupBits)]; e != 0 {
+		b.pos += int(e & 31)
+		return int(e >> 5), true
+	}
+	code := 0
+	for l := 1; l <= h.maxLen; l++ {
+		code = code<<1 | int(b.read(1))
+		if i := code - h.first[l]; i >= 0 && i < h.count[l] {
+			return int(h.symbols[h.index[l]+i]), true
+		}
+	}
+	return 0, false
+}
+
+// msbBits reads bits from the start of a byte slice, most significant bit
+// first, as in bzip2 streams.
+type msbBits struct {
+	in  []byte
+	pos int // Position of the next bit.
+}
+
+// read returns the next n bits, at most 32. Bits past the end of the input
+// are zeros.
+func (b *msbBits) read(n int) uint32 {
+	if n > 24 {
+		return b.read(n-16)<<16 | b.read(16)
+	}
+	v := b.peek(n)
+	b.pos += n
+	return v
+}
+
+// peek returns the next n bits, at most 24, without consuming them.
+func (b *msbBits) peek(n int) uint32 {
+	var v uint32
+	i := b.pos / 8
+	if i+4 <= len(b.in) {
+		v = uint32(b.in[i])<<24 | uint32(b.in[i+1])<<16 | uint32(b.in[i+2])<<8 | uint32(b.in[i+3])
+	} else {
+		for j := 0; j < 4; j++ {
+			v <<= 8
+			if i+j < len(b.in) {
+				v |= uint32(b.in[i+j])
+			}
+		}
+	}
+	return v << (b.pos % 8) >> (32 - n)
+}
+
+// overflowed reports whether more bits were read than available.
+func (b *msbBits) overflowed() bool {
+	return b.pos > len(b.in)*8
+}
+
+// bzip2HasMagic reports whether in holds the magic of a block or of the end of
+// a stream at any bit offset.
+func bzip2HasMagic(in []byte) bool {
+	for _, m := range bzip2Magics {
+		if bytes.Contains(in, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+// Package decompress inflates the beginning of compressed streams so their
+// payload can be sniffed. Decoders work on in-memory input, produce at most a
+// given number of bytes and keep the output decoded so far when the input is
+// truncated, which is the common case for detection buffers.
+package decompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	errCorrupt     = errors.New("decompress: corrupt input")
+	errUnsupported = errors.New("decompress: unsupported format feature")
+)
+
+// gzipPool holds gzip readers for reuse, which saves allocating their
+// decompression window on each call.
+var gzipPool sync.Pool
+
+// Gzip decompresses the gzip stream in, returning at most max bytes.
+func Gzip(in []byte, max int) ([]byte, error) {
+	r, _ := gzipPool.Get().(*gzip.Reader)
+	var err error
+	if r == nil {
+		r, err = gzip.NewReader(bytes.NewReader(in))
+	} else {
+		err = r.Reset(bytes.NewReader(in))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer gzipPool.Put(r)
+	return readMax(r, max)
+}
+
+// readMax reads up to max bytes from r. Errors are returned along with the
+// data read so far.
+func readMax(r io.Reader, max int) ([]byte, error) {
+	return io.ReadAll(io.LimitReader(r, int64(max)))
+}
+
+// initialSize is the initial capacity of output buffers, which grow as needed
+// up to max bytes.
+func initialSize(max int) int {
+	if max > 64<<10 {
+		return 64 << 10
+	}
+	return max
+}
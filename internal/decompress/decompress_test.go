@@ -0,0 +1,101 @@
+package decompress
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+var decoders = []struct {
+	files  []string
+	decode func([]byte, int) ([]byte, error)
+	// progressive is true for decoders producing output from truncated blocks.
+	progressive bool
+}{
+	{[]string{"plain.bin.gz"}, Gzip, true},
+	{[]string{"plain.bin.bz2", "plain.bin.streams.bz2"}, Bzip2, false},
+	{[]string{"plain.bin.xz", "plain.bin.sha256.xz", "plain.bin.blocks.xz"}, Xz, true},
+	{[]string{"plain.bin.zst", "plain.bin.19.zst", "plain.bin.blocks.zst"}, Zstd, false},
+	{[]string{"plain.bin.lz"}, Lzip, true},
+}
+
+func TestDecompress(t *testing.T) {
+	plain, err := os.ReadFile("testdata/plain.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range decoders {
+		for _, f := range d.files {
+			in, err := os.ReadFile("testdata/" + f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Run(f, func(t *testing.T) {
+				out, err := d.decode(in, len(plain)+100)
+				if err != nil {
+					t.Fatalf("full input: %v", err)
+				}
+				if !bytes.Equal(out, plain) {
+					t.Fatalf("full input: got %d bytes, want %d", len(out), len(plain))
+				}
+
+				out, err = d.decode(in, 1000)
+				if err != nil {
+					t.Fatalf("max 1000: %v", err)
+				}
+				if !bytes.Equal(out, plain[:1000]) {
+					t.Fatalf("max 1000: got %d bytes, want the first 1000", len(out))
+				}
+
+				out, err = d.decode(in[:len(in)/2], len(plain))
+				if err == nil {
+					t.Fatalf("truncated input: want error")
+				}
+				if !bytes.HasPrefix(plain, out) {
+					t.Fatalf("truncated input: output is not a prefix")
+				}
+				if d.progressive && len(out) == 0 {
+					t.Fatalf("truncated input: no output")
+				}
+			})
+		}
+	}
+}
+
+func TestDecompressCorrupt(t *testing.T) {
+	for _, d := range decoders {
+		in, err := os.ReadFile("testdata/" + d.files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(in); i += 7 {
+			c := bytes.Clone(in)
+			c[i] ^= 0x55
+			// Must not panic nor produce more than max bytes.
+			if out, _ := d.decode(c, 4096); len(out) > 4096 {
+				t.Fatalf("%s: output of %d bytes", d.files[0], len(out))
+			}
+		}
+		if _, err := d.decode(nil, 10); err == nil {
+			t.Errorf("%s: empty input: want error", d.files[0])
+		}
+	}
+}
+
+// BenchmarkDecompressHead decodes a tar header worth of output from the start
+// of each stream, as done when detecting compressed tar files.
+func BenchmarkDecompressHead(b *testing.B) {
+	for _, d := range decoders {
+		in, err := os.ReadFile("testdata/" + d.files[0])
+		if err != nil {
+			b.Fatal(err)
+		}
+		in = in[:3072]
+		b.Run(d.files[0], func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				d.decode(in, 512)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package decompress
+
+import "math/bits"
+
+// fseTable is a decoding table for Finite State Entropy coded symbols.
+type fseTable struct {
+	accuracyLog int
+	symbols     []uint8
+	numBits     []uint8
+	baseline    []uint16
+}
+
+// readFSETable reads the description of an FSE table from the start of in,
+// allowing symbols up to maxSymbol and accuracy logs up to maxLog. It returns
+// the number of bytes used.
+func readFSETable(in []byte, maxSymbol, maxLog int) (*fseTable, int, error) {
+	b := &forwardBits{in: in}
+	accuracyLog := int(b.read(4)) + 5
+	if accuracyLog > maxLog {
+		return nil, 0, errCorrupt
+	}
+
+	var probs []int16
+	remaining := 1 << accuracyLog
+	for remaining > 0 && len(probs) <= maxSymbol {
+		n := bits.Len(uint(remaining + 1)) // Bits needed for values up to remaining+1.
+		v := b.read(n)
+		lowMask := uint32(1)<<(n-1) - 1
+		threshold := uint32(1)<<n - 1 - uint32(remaining+1)
+		if v&lowMask < threshold {
+			b.pos--
+			v &= lowMask
+		} else if v > lowMask {
+			v -= threshold
+		}
+		prob := int16(v) - 1
+		if prob < 0 {
+			remaining--
+		} else {
+			remaining -= int(prob)
+		}
+		probs = append(probs, prob)
+		if prob == 0 {
+			for {
+				repeat := b.read(2)
+				for i := uint32(0); i < repeat && len(probs) <= maxSymbol; i++ {
+					probs = append(probs, 0)
+				}
+				if repeat != 3 {
+					break
+				}
+			}
+		}
+		if b.overflowed() {
+			return nil, 0, errCorrupt
+		}
+	}
+	if remaining != 0 || len(probs) > maxSymbol+1 {
+		return nil, 0, errCorrupt
+	}
+
+	t, err := newFSETable(probs, accuracyLog)
+	return t, b.bytesUsed(), err
+}
+
+// newFSETable builds the decoding table for the normalized probabilities.
+// A probability of -1 stands for "less than 1".
+func newFSETable(probs []int16, accuracyLog int) (*fseTable, error) {
+	size := 1 << accuracyLog
+	t := &fseTable{
+		accuracyLog: accuracyLog,
+		symbols:     make([]uint8, size),
+		numBits:     make([]uint8, size),
+		baseline:    make([]uint16, size),
+	}
+
+	next := make([]uint16, len(probs))
+	high := size
+	for s, p := range probs {
+		if p == -1 {
+			high--
+			t.symbols[high] = uint8(s)
+			next[s] = 1
+		}
+	}
+	step := size>>1 + size>>3 + 3
+	pos := 0
+	for s, p := range probs {
+		if p <= 0 {
+			continue
+		}
+		next[s] = uint16(p)
+		for i := 0; i < int(p); i++ {
+			t.symbols[pos] = uint8(s)
+			pos = (pos + step) & (size - 1)
+			for pos >= high {
+				pos = (pos + step) & (size - 1)
+			}
+		}
+	}
+	if pos != 0 {
+		return nil, errCorrupt
+	}
+
+	for i := 0; i < size; i++ {
+		s := t.symbols[i]
+		n := next[s]
+		next[s]++
+		nb := accuracyLog - (bits.Len16(n) - 1)
+		t.numBits[i] = uint8(nb)
+		t.baseline[i] = uint16(int(n)<<nb - size)
+	}
+
+	return t, nil
+}
+
+// rleFSETable returns a table always decoding symbol, without reading bits.
+func rleFSETable(symbol uint8) *fseTable {
+	return &fseTable{symbols: []uint8{symbol}, numBits: []uint8{0}, baseline: []uint16{0}}
+}
+
+// fseState is the state of an FSE decoder reading from a backward stream.
+type fseState struct {
+	t     *fseTable
+	state uint32
+}
+
+func (s *fseState) init(t *fseTable, b *backwardBits) {
+	s.t = t
+	s.state = b.read(t.accuracyLog)
+}
+
+func (s *fseState) symbol() uint8 {
+	return s.t.symbols[s.state]
+}
+
+func (s *fseState) update(b *backwardBits) {
+	s.state = uint32(s.t.baseline[s.state]) + b.read(int(s.t.numBits[s.state]))
+}
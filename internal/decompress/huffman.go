@@ -0,0 +1,165 @@
+package decompress
+
+import "math/bits"
+
+const huffmanMaxBits = 11
+
+// huffmanTable is a zstd Huffman decoding table, indexed by the next maxBits
+// bits of the stream.
+type huffmanTable struct {
+	maxBits int
+	symbols []uint8
+	numBits []uint8
+}
+
+// readHuffmanTable reads a Huffman tree description from the start of in and
+// returns the table and the number of bytes used.
+func readHuffmanTable(in []byte) (*huffmanTable, int, error) {
+	if len(in) == 0 {
+		return nil, 0, errCorrupt
+	}
+	header := int(in[0])
+	var weights []uint8
+	var used int
+	if header >= 128 {
+		// Weights stored directly, 4 bits each.
+		n := header - 127
+		used = 1 + (n+1)/2
+		if len(in) < used {
+			return nil, 0, errCorrupt
+		}
+		for i := 0; i < n; i++ {
+			w := in[1+i/2]
+			if i%2 == 0 {
+				w >>= 4
+			}
+			weights = append(weights, w&0x0F)
+		}
+	} else {
+		used = 1 + header
+		if len(in) < used {
+			return nil, 0, errCorrupt
+		}
+		var err error
+		if weights, err = fseWeights(in[1:used]); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	t, err := newHuffmanTable(weights)
+	return t, used, err
+}
+
+// fseWeights decodes FSE compressed Huffman weights.
+func fseWeights(in []byte) ([]uint8, error) {
+	t, n, err := readFSETable(in, 255, 6)
+	if err != nil {
+		return nil, err
+	}
+	b, err := newBackwardBits(in[n:])
+	if err != nil {
+		return nil, err
+	}
+
+	var s1, s2 fseState
+	s1.init(t, b)
+	s2.init(t, b)
+	var weights []uint8
+	for len(weights) < 255 {
+		weights = append(weights, s1.symbol())
+		s1.update(b)
+		if b.overflowed() {
+			weights = append(weights, s2.symbol())
+			break
+		}
+		weights = append(weights, s2.symbol())
+		s2.update(b)
+		if b.overflowed() {
+			weights = append(weights, s1.symbol())
+			break
+		}
+	}
+
+	return weights, nil
+}
+
+// newHuffmanTable builds the table for the weights of all symbols but the
+// last one, whose weight is implied.
+func newHuffmanTable(weights []uint8) (*huffmanTable, error) {
+	if len(weights) == 0 || len(weights) > 255 {
+		return nil, errCorrupt
+	}
+	var sum uint32
+	for _, w := range weights {
+		if w > huffmanMaxBits {
+			return nil, errCorrupt
+		}
+		if w > 0 {
+			sum += 1 << (w - 1)
+		}
+	}
+	if sum == 0 {
+		return nil, errCorrupt
+	}
+	maxBits := bits.Len32(sum)
+	left := uint32(1)<<maxBits - sum
+	if left&(left-1) != 0 || maxBits > huffmanMaxBits {
+		return nil, errCorrupt
+	}
+	weights = append(weights, uint8(bits.Len32(left)))
+
+	t := &huffmanTable{
+		maxBits: maxBits,
+		symbols: make([]uint8, 1<<maxBits),
+		numBits: make([]uint8, 1<<maxBits),
+	}
+	// Codes with more bits come first in the table.
+	var rankCount [huffmanMaxBits + 1]int
+	numBits := make([]int, len(weights))
+	for s, w := range weights {
+		if w > 0 {
+			numBits[s] = maxBits + 1 - int(w)
+			rankCount[numBits[s]]++
+		}
+	}
+	var rankStart [huffmanMaxBits + 1]int
+	for n := maxBits; n >= 1; n-- {
+		if n > 1 {
+			rankStart[n-1] = rankStart[n] + rankCount[n]<<(maxBits-n)
+		}
+	}
+	for s, n := range numBits {
+		if n == 0 {
+			continue
+		}
+		size := 1 << (maxBits - n)
+		for i := rankStart[n]; i < rankStart[n]+size; i++ {
+			t.symbols[i] = uint8(s)
+			t.numBits[i] = uint8(n)
+		}
+		rankStart[n] += size
+	}
+
+	return t, nil
+}
+
+// decodeStream decodes n symbols from the backward stream in, appending them
+// to out.
+func (t *huffmanTable) decodeStream(out, in []byte, n int) ([]byte, error) {
+	b, err := newBackwardBits(in)
+	if err != nil {
+		return out, err
+	}
+	mask := uint32(1)<<t.maxBits - 1
+	state := b.read(t.maxBits)
+	for i := 0; i < n; i++ {
+		out = append(out, t.symbols[state])
+		nb := int(t.numBits[state])
+		state = (state<<nb | b.read(nb)) & mask
+	}
+	if b.pos < -t.maxBits {
+		return out, errCorrupt
+	}
+
+	return out, nil
+}
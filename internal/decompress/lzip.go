@@ -0,0 +1,28 @@
+package decompress
+
+import (
+	"bytes"
+	"io"
+)
+
+// Lzip decompresses the first member of the lzip stream in, returning at most
+// max bytes. The trailer is not verified.
+func Lzip(in []byte, max int) ([]byte, error) {
+	if len(in) < 6 || !bytes.HasPrefix(in, []byte("LZIP")) || in[4] != 1 {
+		return nil, errCorrupt
+	}
+	// The dictionary size is not needed, the output is the dictionary.
+	rd, err := newRangeDecoder(in[6:])
+	if err != nil {
+		if len(in) < 11 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	d := &lzmaDecoder{out: make([]byte, 0, initialSize(max)), max: max}
+	d.reset(lzmaProps{lc: 3, lp: 0, pb: 2})
+	_, err = d.decode(rd, -1)
+
+	return d.out, err
+}
@@ -0,0 +1,376 @@
+package decompress
+
+import "io"
+
+// rangeDecoder decodes the range coded bits of LZMA streams.
+type rangeDecoder struct {
+	in         []byte
+	rng, code  uint32
+	overflowed bool
+}
+
+func newRangeDecoder(in []byte) (*rangeDecoder, error) {
+	if len(in) < 5 || in[0] != 0 {
+		return nil, errCorrupt
+	}
+	rd := &rangeDecoder{in: in[5:], rng: 0xFFFFFFFF}
+	rd.code = uint32(in[1])<<24 | uint32(in[2])<<16 | uint32(in[3])<<8 | uint32(in[4])
+	if rd.code == rd.rng {
+		return nil, errCorrupt
+	}
+
+	return rd, nil
+}
+
+func (rd *rangeDecoder) next() uint32 {
+	if len(rd.in) == 0 {
+		rd.overflowed = true
+		return 0
+	}
+	b := rd.in[0]
+	rd.in = rd.in[1:]
+	return uint32(b)
+}
+
+func (rd *rangeDecoder) normalize() {
+	if rd.rng < 1<<24 {
+		rd.rng <<= 8
+		rd.code = rd.code<<8 | rd.next()
+	}
+}
+
+// bit decodes a bit using the probability p, which is then updated.
+func (rd *rangeDecoder) bit(p *uint16) uint32 {
+	bound := (rd.rng >> 11) * uint32(*p)
+	var b uint32
+	if rd.code < bound {
+		rd.rng = bound
+		*p += (1<<11 - *p) >> 5
+	} else {
+		rd.rng -= bound
+		rd.code -= bound
+		*p -= *p >> 5
+		b = 1
+	}
+	rd.normalize()
+
+	return b
+}
+
+// direct decodes n bits with fixed probabilities.
+func (rd *rangeDecoder) direct(n int) uint32 {
+	var res uint32
+	for ; n > 0; n-- {
+		rd.rng >>= 1
+		rd.code -= rd.rng
+		t := 0 - (rd.code >> 31)
+		rd.code += rd.rng & t
+		rd.normalize()
+		res = res<<1 + t + 1
+	}
+
+	return res
+}
+
+// tree decodes n bits, most significant first, using the probabilities probs.
+func (rd *rangeDecoder) tree(probs []uint16, n int) uint32 {
+	m := uint32(1)
+	for i := 0; i < n; i++ {
+		m = m<<1 + rd.bit(&probs[m])
+	}
+
+	return m - 1<<n
+}
+
+// reverseTree decodes n bits, least significant first.
+func (rd *rangeDecoder) reverseTree(probs []uint16, n int) uint32 {
+	m, sym := uint32(1), uint32(0)
+	for i := 0; i < n; i++ {
+		b := rd.bit(&probs[m])
+		m = m<<1 + b
+		sym |= b << i
+	}
+
+	return sym
+}
+
+const (
+	lzmaStates      = 12
+	lzmaPosStates   = 1 << 4
+	lzmaEndPosModel = 14
+	lzmaFullDists   = 1 << (lzmaEndPosModel >> 1)
+	lzmaMatchMinLen = 2
+	probInit        = 1 << 10
+)
+
+type lenDecoder struct {
+	choice, choice2 uint16
+	low, mid        [lzmaPosStates][1 << 3]uint16
+	high            [1 << 8]uint16
+}
+
+func (ld *lenDecoder) decode(rd *rangeDecoder, posState uint32) uint32 {
+	if rd.bit(&ld.choice) == 0 {
+		return rd.tree(ld.low[posState][:], 3)
+	}
+	if rd.bit(&ld.choice2) == 0 {
+		return 8 + rd.tree(ld.mid[posState][:], 3)
+	}
+	return 16 + rd.tree(ld.high[:], 8)
+}
+
+// lzmaProps holds the literal context bits, literal position bits and
+// position bits of an LZMA stream.
+type lzmaProps struct {
+	lc, lp, pb uint
+}
+
+func decodeProps(b byte) (lzmaProps, error) {
+	if b >= 9*5*5 {
+		return lzmaProps{}, errCorrupt
+	}
+	d := uint(b)
+	return lzmaProps{lc: d % 9, lp: d / 9 % 5, pb: d / 45}, nil
+}
+
+// lzmaDecoder holds the state of an LZMA decoder. The decompressed data is
+// appended to out, which also serves as dictionary, up to max bytes.
+type lzmaDecoder struct {
+	props      lzmaProps
+	literal    []uint16
+	isMatch    [lzmaStates * lzmaPosStates]uint16
+	isRep      [lzmaStates]uint16
+	isRepG0    [lzmaStates]uint16
+	isRepG1    [lzmaStates]uint16
+	isRepG2    [lzmaStates]uint16
+	isRep0Long [lzmaStates * lzmaPosStates]uint16
+	posSlot    [4][1 << 6]uint16
+	posDecs    [1 + lzmaFullDists - lzmaEndPosModel]uint16
+	align      [1 << 4]uint16
+	lenDec     lenDecoder
+	repLenDec  lenDecoder
+	state      uint32
+	reps       [4]uint32
+	// dictStart is the position in out where the dictionary was last reset.
+	dictStart int
+	out       []byte
+	max       int
+}
+
+// reset sets the decoder to its initial state, with new properties.
+func (d *lzmaDecoder) reset(p lzmaProps) {
+	d.props = p
+	n := 0x300 << (p.lc + p.lp)
+	if cap(d.literal) >= n {
+		d.literal = d.literal[:n]
+	} else {
+		d.literal = make([]uint16, n)
+	}
+	for _, probs := range [][]uint16{
+		d.literal, d.isMatch[:], d.isRep[:], d.isRepG0[:], d.isRepG1[:],
+		d.isRepG2[:], d.isRep0Long[:], d.posDecs[:], d.align[:],
+	} {
+		fill(probs)
+	}
+	for i := range d.posSlot {
+		fill(d.posSlot[i][:])
+	}
+	for _, ld := range []*lenDecoder{&d.lenDec, &d.repLenDec} {
+		ld.choice, ld.choice2 = probInit, probInit
+		for i := range ld.low {
+			fill(ld.low[i][:])
+			fill(ld.mid[i][:])
+		}
+		fill(ld.high[:])
+	}
+	d.state = 0
+	d.reps = [4]uint32{}
+}
+
+func fill(probs []uint16) {
+	for i := range probs {
+		probs[i] = probInit
+	}
+}
+
+// full reports whether the output reached its maximum size.
+func (d *lzmaDecoder) full() bool {
+	return len(d.out) >= d.max
+}
+
+// decode decodes from rd until n more bytes are produced, the output is full
+// or, when n is negative, the end marker is found. It returns true when the
+// end marker was found. When the input is too short, the bytes decoded from
+// the available input are kept and io.ErrUnexpectedEOF is returned.
+func (d *lzmaDecoder) decode(rd *rangeDecoder, n int) (bool, error) {
+	end := len(d.out) + n
+	for (n < 0 || len(d.out) < end) && !d.full() {
+		start := len(d.out)
+		eos, err := d.symbol(rd, end, n < 0)
+		// Bits decoded after the end of the input are not reliable.
+		if rd.overflowed {
+			d.out = d.out[:start]
+			return false, io.ErrUnexpectedEOF
+		}
+		if eos || err != nil {
+			return eos, err
+		}
+	}
+
+	return false, nil
+}
+
+// symbol decodes a literal or a match. Matches are not copied past end,
+// unless unbounded is true, nor past the capacity of the output.
+func (d *lzmaDecoder) symbol(rd *rangeDecoder, end int, unbounded bool) (bool, error) {
+	pos := uint32(len(d.out) - d.dictStart)
+	posState := pos & (1<<d.props.pb - 1)
+	state := d.state
+
+	if rd.bit(&d.isMatch[state<<4+posState]) == 0 {
+		var prev uint32
+		if len(d.out) > d.dictStart {
+			prev = uint32(d.out[len(d.out)-1])
+		}
+		base := 0x300 * ((pos&(1<<d.props.lp-1))<<d.props.lc + prev>>(8-d.props.lc))
+		probs := d.literal[base : base+0x300]
+		sym := uint32(1)
+		if state >= 7 {
+			match, err := d.byteAt(d.reps[0] + 1)
+			if err != nil {
+				return false, err
+			}
+			for sym < 0x100 {
+				matchBit := uint32(match>>7) & 1
+				match <<= 1
+				b := rd.bit(&probs[(1+matchBit)<<8+sym])
+				sym = sym<<1 | b
+				if matchBit != b {
+					break
+				}
+			}
+		}
+		for sym < 0x100 {
+			sym = sym<<1 | rd.bit(&probs[sym])
+		}
+		d.out = append(d.out, byte(sym))
+		switch {
+		case state < 4:
+			d.state = 0
+		case state < 10:
+			d.state = state - 3
+		default:
+			d.state = state - 6
+		}
+		return false, nil
+	}
+
+	var length uint32
+	if rd.bit(&d.isRep[state]) != 0 {
+		if len(d.out) == d.dictStart {
+			return false, errCorrupt
+		}
+		if rd.bit(&d.isRepG0[state]) == 0 {
+			if rd.bit(&d.isRep0Long[state<<4+posState]) == 0 {
+				d.state = 9
+				if state >= 7 {
+					d.state = 11
+				}
+				b, err := d.byteAt(d.reps[0] + 1)
+				if err != nil {
+					return false, err
+				}
+				d.out = append(d.out, b)
+				return false, nil
+			}
+		} else {
+			var dist uint32
+			if rd.bit(&d.isRepG1[state]) == 0 {
+				dist = d.reps[1]
+			} else {
+				if rd.bit(&d.isRepG2[state]) == 0 {
+					dist = d.reps[2]
+				} else {
+					dist = d.reps[3]
+					d.reps[3] = d.reps[2]
+				}
+				d.reps[2] = d.reps[1]
+			}
+			d.reps[1] = d.reps[0]
+			d.reps[0] = dist
+		}
+		length = d.repLenDec.decode(rd, posState)
+		d.state = 8
+		if state >= 7 {
+			d.state = 11
+		}
+	} else {
+		d.reps[3], d.reps[2], d.reps[1] = d.reps[2], d.reps[1], d.reps[0]
+		length = d.lenDec.decode(rd, posState)
+		d.state = 7
+		if state >= 7 {
+			d.state = 10
+		}
+		d.reps[0] = d.distance(rd, length)
+		if d.reps[0] == 0xFFFFFFFF {
+			return true, nil
+		}
+	}
+
+	length += lzmaMatchMinLen
+	dist := int(d.reps[0]) + 1
+	if dist > len(d.out)-d.dictStart {
+		return false, errCorrupt
+	}
+	for ; length > 0 && !d.full() && (unbounded || len(d.out) < end); length-- {
+		d.out = append(d.out, d.out[len(d.out)-dist])
+	}
+
+	return false, nil
+}
+
+func (d *lzmaDecoder) distance(rd *rangeDecoder, length uint32) uint32 {
+	lenState := length
+	if lenState > 3 {
+		lenState = 3
+	}
+	slot := rd.tree(d.posSlot[lenState][:], 6)
+	if slot < 4 {
+		return slot
+	}
+	directBits := int(slot>>1) - 1
+	dist := (2 | slot&1) << directBits
+	if slot < lzmaEndPosModel {
+		return dist + rd.reverseTree(d.posDecs[dist-slot:], directBits)
+	}
+	dist += rd.direct(directBits-4) << 4
+	return dist + rd.reverseTree(d.align[:], 4)
+}
+
+// byteAt returns the byte dist positions back in the output.
+func (d *lzmaDecoder) byteAt(dist uint32) (byte, error) {
+	if int(dist) > len(d.out)-d.dictStart {
+		return 0, errCorrupt
+	}
+	return d.out[len(d.out)-int(dist)], nil
+}
+
+// LZMA decompresses the raw LZMA stream in, as stored in 7z archives, which
+// has no header: props is the properties byte of the coder. It returns at
+// most max bytes.
+func LZMA(in []byte, props byte, max int) ([]byte, error) {
+	p, err := decodeProps(props)
+	if err != nil {
+		return nil, err
+	}
+	rd, err := newRangeDecoder(in)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &lzmaDecoder{out: make([]byte, 0, initialSize(max)), max: max}
+	d.reset(p)
+	_, err = d.decode(rd, -1)
+
+	return d.out, err
+}
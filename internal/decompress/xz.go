@@ -0,0 +1,187 @@
+package decompress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Xz decompresses the xz stream in, returning at most max bytes. Only blocks
+// using the LZMA2 filter alone, the default of xz, are supported. Checks are
+// not verified.
+func Xz(in []byte, max int) ([]byte, error) {
+	if len(in) < 12 || !bytes.HasPrefix(in, []byte("\xFD7zXZ\x00")) || in[6] != 0 || in[7] > 0x0F {
+		return nil, errCorrupt
+	}
+	checkSize := xzCheckSize(in[7])
+	in = in[12:]
+
+	d := &lzmaDecoder{out: make([]byte, 0, initialSize(max)), max: max}
+	for !d.full() {
+		if len(in) == 0 {
+			return d.out, io.ErrUnexpectedEOF
+		}
+		// A zero header size starts the index, which follows the last block.
+		if in[0] == 0 {
+			return d.out, nil
+		}
+		headerSize := (int(in[0]) + 1) * 4
+		if len(in) < headerSize {
+			return d.out, io.ErrUnexpectedEOF
+		}
+		if err := xzBlockHeader(in[:headerSize]); err != nil {
+			return d.out, err
+		}
+		n, err := lzma2(d, in[headerSize:])
+		if err != nil {
+			return d.out, err
+		}
+		// The block is followed by padding to a multiple of 4 bytes and a check.
+		n += headerSize
+		n += (4-n%4)%4 + checkSize
+		if n > len(in) {
+			return d.out, io.ErrUnexpectedEOF
+		}
+		in = in[n:]
+	}
+
+	return d.out, nil
+}
+
+// xzCheckSize returns the size of the check field for the check type.
+func xzCheckSize(check byte) int {
+	if check == 0 {
+		return 0
+	}
+	return 4 << ((check - 1) / 3)
+}
+
+// xzBlockHeader validates the block header h, which must declare a single
+// LZMA2 filter.
+func xzBlockHeader(h []byte) error {
+	flags := h[1]
+	if flags&0x3C != 0 {
+		return errCorrupt
+	}
+	if flags&0x03 != 0 {
+		return errUnsupported
+	}
+	r := bytes.NewReader(h[2 : len(h)-4])
+	// Compressed and uncompressed sizes are not needed.
+	for _, present := range []bool{flags&0x40 != 0, flags&0x80 != 0} {
+		if present {
+			if _, err := binary.ReadUvarint(r); err != nil {
+				return errCorrupt
+			}
+		}
+	}
+	id, err := binary.ReadUvarint(r)
+	if err != nil {
+		return errCorrupt
+	}
+	if id != 0x21 {
+		return errUnsupported
+	}
+	if size, err := binary.ReadUvarint(r); err != nil || size != 1 {
+		return errCorrupt
+	}
+
+	return nil
+}
+
+// lzma2 decodes LZMA2 chunks from in, appending to d.out. It returns the
+// number of bytes of in used by the chunks, including the end marker.
+func lzma2(d *lzmaDecoder, in []byte) (int, error) {
+	pos := 0
+	needProps, needDictReset := true, true
+	for !d.full() {
+		if pos >= len(in) {
+			return pos, io.ErrUnexpectedEOF
+		}
+		control := in[pos]
+		pos++
+		switch {
+		case control == 0x00:
+			return pos, nil
+		case control == 0x01 || control == 0x02:
+			if control == 0x01 {
+				d.dictStart, needDictReset = len(d.out), false
+			} else if needDictReset {
+				return pos, errCorrupt
+			}
+			if pos+2 > len(in) {
+				return pos, io.ErrUnexpectedEOF
+			}
+			size := int(in[pos])<<8 | int(in[pos+1]) + 1
+			pos += 2
+			chunk := in[pos:]
+			if len(chunk) > size {
+				chunk = chunk[:size]
+			}
+			if room := d.max - len(d.out); len(chunk) > room {
+				chunk = chunk[:room]
+			}
+			d.out = append(d.out, chunk...)
+			if pos+size > len(in) && !d.full() {
+				return len(in), io.ErrUnexpectedEOF
+			}
+			pos += size
+		case control >= 0x80:
+			if pos+4 > len(in) {
+				return pos, io.ErrUnexpectedEOF
+			}
+			unpacked := int(control&0x1F)<<16 | int(in[pos])<<8 | int(in[pos+1]) + 1
+			packed := int(in[pos+2])<<8 | int(in[pos+3]) + 1
+			pos += 4
+			reset := control >> 5 & 0x03
+			if reset == 3 {
+				d.dictStart, needDictReset = len(d.out), false
+			} else if needDictReset {
+				return pos, errCorrupt
+			}
+			if reset >= 2 {
+				if pos >= len(in) {
+					return pos, io.ErrUnexpectedEOF
+				}
+				p, err := decodeProps(in[pos])
+				if err != nil || p.lc+p.lp > 4 {
+					return pos, errCorrupt
+				}
+				pos++
+				d.reset(p)
+				needProps = false
+			} else if needProps {
+				return pos, errCorrupt
+			} else if reset == 1 {
+				d.reset(d.props)
+			}
+			chunk := in[pos:]
+			if len(chunk) > packed {
+				chunk = chunk[:packed]
+			}
+			rd, err := newRangeDecoder(chunk)
+			if err != nil {
+				if len(chunk) < 5 {
+					err = io.ErrUnexpectedEOF
+				}
+				return pos, err
+			}
+			if _, err := d.decode(rd, unpacked); err != nil {
+				return pos, err
+			}
+			pos += packed
+		default:
+			return pos, errCorrupt
+		}
+	}
+
+	return pos, nil
+}
+
+// LZMA2 decompresses the raw LZMA2 stream in, as stored in 7z archives,
+// returning at most max bytes.
+func LZMA2(in []byte, max int) ([]byte, error) {
+	d := &lzmaDecoder{out: make([]byte, 0, initialSize(max)), max: max}
+	_, err := lzma2(d, in)
+	return d.out, err
+}
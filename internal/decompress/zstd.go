@@ -0,0 +1,467 @@
+package decompress
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const zstdMagic = 0xFD2FB528
+
+// Predefined distributions and code tables of RFC 8878.
+var (
+	llDefault = []int16{4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 2, 2, 2, 2,
+		2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1, -1, -1, -1, -1}
+	mlDefault = []int16{1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1, -1, -1, -1}
+	ofDefault = []int16{1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, -1, -1, -1, -1, -1}
+
+	llBase = []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 18,
+		20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096, 8192,
+		16384, 32768, 65536}
+	llBits = []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1,
+		2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	mlBase = []uint32{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19,
+		20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 37, 39, 41,
+		43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051, 4099, 8195, 16387,
+		32771, 65539}
+	mlBits = []uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9,
+		10, 11, 12, 13, 14, 15, 16}
+
+	llDefaultTable, _ = newFSETable(llDefault, 6)
+	mlDefaultTable, _ = newFSETable(mlDefault, 6)
+	ofDefaultTable, _ = newFSETable(ofDefault, 5)
+)
+
+// zstdFrame holds the state kept between the blocks of a zstd frame.
+type zstdFrame struct {
+	out []byte
+	max int
+	// start is the position in out where the frame starts.
+	start      int
+	huffman    *huffmanTable
+	ll, of, ml *fseTable
+	reps       [3]uint32
+}
+
+// Zstd decompresses the zstd stream in, returning at most max bytes. Frames
+// needing a dictionary are not supported and checksums are not verified.
+func Zstd(in []byte, max int) ([]byte, error) {
+	if len(in) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	out := make([]byte, 0, initialSize(max))
+	for len(out) < max {
+		if len(in) == 0 {
+			return out, nil
+		}
+		if len(in) < 8 {
+			return out, io.ErrUnexpectedEOF
+		}
+		magic := binary.LittleEndian.Uint32(in)
+		if magic&0xFFFFFFF0 == 0x184D2A50 {
+			size := int(binary.LittleEndian.Uint32(in[4:]))
+			if size > len(in)-8 {
+				return out, io.ErrUnexpectedEOF
+			}
+			in = in[8+size:]
+			continue
+		}
+		if magic != zstdMagic {
+			return out, errCorrupt
+		}
+
+		f := &zstdFrame{out: out, max: max, start: len(out), reps: [3]uint32{1, 4, 8}}
+		n, err := f.decode(in[4:])
+		out = f.out
+		if err != nil {
+			return out, err
+		}
+		in = in[4+n:]
+	}
+
+	return out, nil
+}
+
+// decode decodes the frame from in, which starts after the magic number, and
+// returns the number of bytes used.
+func (f *zstdFrame) decode(in []byte) (int, error) {
+	if len(in) < 1 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	desc := in[0]
+	if desc&0x08 != 0 {
+		return 0, errCorrupt
+	}
+	single := desc&0x20 != 0
+	pos := 1
+	if !single {
+		pos++
+	}
+	dictSize := []int{0, 1, 2, 4}[desc&0x03]
+	if pos+dictSize > len(in) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	for _, b := range in[pos : pos+dictSize] {
+		if b != 0 {
+			return 0, errUnsupported
+		}
+	}
+	pos += dictSize
+	fcsSize := []int{0, 2, 4, 8}[desc>>6]
+	if single && fcsSize == 0 {
+		fcsSize = 1
+	}
+	pos += fcsSize
+
+	for len(f.out) < f.max {
+		if pos+3 > len(in) {
+			return pos, io.ErrUnexpectedEOF
+		}
+		header := int(in[pos]) | int(in[pos+1])<<8 | int(in[pos+2])<<16
+		pos += 3
+		last := header&1 != 0
+		size := header >> 3
+		switch header >> 1 & 3 {
+		case 0: // Raw block.
+			data := in[pos:]
+			if len(data) > size {
+				data = data[:size]
+			}
+			f.append(data...)
+			if len(data) < size && len(f.out) < f.max {
+				return len(in), io.ErrUnexpectedEOF
+			}
+		case 1: // RLE block.
+			if pos >= len(in) {
+				return pos, io.ErrUnexpectedEOF
+			}
+			for i := 0; i < size && len(f.out) < f.max; i++ {
+				f.out = append(f.out, in[pos])
+			}
+			size = 1
+		case 2: // Compressed block.
+			if pos+size > len(in) {
+				return len(in), io.ErrUnexpectedEOF
+			}
+			if err := f.block(in[pos : pos+size]); err != nil {
+				return pos, err
+			}
+		default:
+			return pos, errCorrupt
+		}
+		pos += size
+		if last {
+			if desc&0x04 != 0 {
+				pos += 4
+			}
+			if pos > len(in) {
+				return len(in), io.ErrUnexpectedEOF
+			}
+			return pos, nil
+		}
+	}
+
+	return pos, nil
+}
+
+// append appends data to the output, up to max bytes.
+func (f *zstdFrame) append(data ...byte) {
+	if room := f.max - len(f.out); len(data) > room {
+		data = data[:room]
+	}
+	f.out = append(f.out, data...)
+}
+
+// block decodes a compressed block.
+func (f *zstdFrame) block(in []byte) error {
+	literals, n, err := f.literals(in)
+	if err != nil {
+		return err
+	}
+	return f.sequences(in[n:], literals)
+}
+
+// literals decodes the literals section at the start of in and returns the
+// literals and the size of the section. Every literal ends up in the output,
+// so literals are only decoded as far as the output can take them.
+func (f *zstdFrame) literals(in []byte) ([]byte, int, error) {
+	if len(in) == 0 {
+		return nil, 0, errCorrupt
+	}
+	room := f.max - len(f.out)
+	typ := in[0] & 3
+	sizeFormat := in[0] >> 2 & 3
+	if typ < 2 {
+		var regen, headerSize int
+		switch sizeFormat {
+		case 0, 2:
+			regen, headerSize = int(in[0]>>3), 1
+		case 1:
+			if len(in) < 2 {
+				return nil, 0, errCorrupt
+			}
+			regen, headerSize = int(in[0]>>4)|int(in[1])<<4, 2
+		case 3:
+			if len(in) < 3 {
+				return nil, 0, errCorrupt
+			}
+			regen, headerSize = int(in[0]>>4)|int(in[1])<<4|int(in[2])<<12, 3
+		}
+		if typ == 0 {
+			if len(in) < headerSize+regen {
+				return nil, 0, errCorrupt
+			}
+			return in[headerSize : headerSize+regen], headerSize + regen, nil
+		}
+		if len(in) < headerSize+1 {
+			return nil, 0, errCorrupt
+		}
+		if regen > room {
+			regen = room
+		}
+		lits := make([]byte, regen)
+		for i := range lits {
+			lits[i] = in[headerSize]
+		}
+		return lits, headerSize + 1, nil
+	}
+
+	var regen, comp, headerSize int
+	streams := 4
+	switch sizeFormat {
+	case 0, 1:
+		if len(in) < 3 {
+			return nil, 0, errCorrupt
+		}
+		if sizeFormat == 0 {
+			streams = 1
+		}
+		regen = int(in[0]>>4) | int(in[1]&0x3F)<<4
+		comp = int(in[1]>>6) | int(in[2])<<2
+		headerSize = 3
+	case 2:
+		if len(in) < 4 {
+			return nil, 0, errCorrupt
+		}
+		regen = int(in[0]>>4) | int(in[1])<<4 | int(in[2]&0x03)<<12
+		comp = int(in[2]>>2) | int(in[3])<<6
+		headerSize = 4
+	case 3:
+		if len(in) < 5 {
+			return nil, 0, errCorrupt
+		}
+		regen = int(in[0]>>4) | int(in[1])<<4 | int(in[2]&0x3F)<<12
+		comp = int(in[2]>>6) | int(in[3])<<2 | int(in[4])<<10
+		headerSize = 5
+	}
+	if len(in) < headerSize+comp {
+		return nil, 0, errCorrupt
+	}
+	data := in[headerSize : headerSize+comp]
+	if typ == 2 {
+		t, n, err := readHuffmanTable(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		f.huffman = t
+		data = data[n:]
+	} else if f.huffman == nil {
+		return nil, 0, errCorrupt
+	}
+
+	want := regen
+	if want > room {
+		want = room
+	}
+	lits := make([]byte, 0, want)
+	var err error
+	if streams == 1 {
+		lits, err = f.huffman.decodeStream(lits, data, want)
+	} else {
+		if len(data) < 6 {
+			return nil, 0, errCorrupt
+		}
+		sizes := [4]int{
+			int(binary.LittleEndian.Uint16(data)),
+			int(binary.LittleEndian.Uint16(data[2:])),
+			int(binary.LittleEndian.Uint16(data[4:])),
+		}
+		data = data[6:]
+		sizes[3] = len(data) - sizes[0] - sizes[1] - sizes[2]
+		if sizes[3] < 0 {
+			return nil, 0, errCorrupt
+		}
+		per := (regen + 3) / 4
+		for i, size := range sizes {
+			n := per
+			if i == 3 {
+				n = regen - 3*per
+			}
+			if n < 0 {
+				return nil, 0, errCorrupt
+			}
+			if n > want-len(lits) {
+				n = want - len(lits)
+			}
+			if lits, err = f.huffman.decodeStream(lits, data[:size], n); err != nil {
+				break
+			}
+			data = data[size:]
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return lits, headerSize + comp, nil
+}
+
+// sequences decodes the sequences section in and executes the sequences,
+// using literals.
+func (f *zstdFrame) sequences(in, literals []byte) error {
+	if len(in) == 0 {
+		return errCorrupt
+	}
+	nbSeq := int(in[0])
+	pos := 1
+	switch {
+	case nbSeq == 0:
+		f.append(literals...)
+		return nil
+	case nbSeq == 255:
+		if len(in) < 3 {
+			return errCorrupt
+		}
+		nbSeq = int(in[1]) | int(in[2])<<8 + 0x7F00
+		pos = 3
+	case nbSeq >= 128:
+		if len(in) < 2 {
+			return errCorrupt
+		}
+		nbSeq = (nbSeq-128)<<8 | int(in[1])
+		pos = 2
+	}
+	if pos >= len(in) {
+		return errCorrupt
+	}
+	modes := in[pos]
+	pos++
+
+	tables := []struct {
+		t         **fseTable
+		mode      byte
+		def       *fseTable
+		maxSymbol int
+		maxLog    int
+	}{
+		{&f.ll, modes >> 6, llDefaultTable, 35, 9},
+		{&f.of, modes >> 4 & 3, ofDefaultTable, 31, 8},
+		{&f.ml, modes >> 2 & 3, mlDefaultTable, 52, 9},
+	}
+	for _, t := range tables {
+		switch t.mode {
+		case 0:
+			*t.t = t.def
+		case 1:
+			if pos >= len(in) || int(in[pos]) > t.maxSymbol {
+				return errCorrupt
+			}
+			*t.t = rleFSETable(in[pos])
+			pos++
+		case 2:
+			table, n, err := readFSETable(in[pos:], t.maxSymbol, t.maxLog)
+			if err != nil {
+				return err
+			}
+			*t.t = table
+			pos += n
+		case 3:
+			if *t.t == nil {
+				return errCorrupt
+			}
+		}
+	}
+
+	b, err := newBackwardBits(in[pos:])
+	if err != nil {
+		return err
+	}
+	var ll, of, ml fseState
+	ll.init(f.ll, b)
+	of.init(f.of, b)
+	ml.init(f.ml, b)
+	for i := 0; i < nbSeq && len(f.out) < f.max; i++ {
+		ofCode, llCode, mlCode := of.symbol(), ll.symbol(), ml.symbol()
+		if ofCode > 31 || int(llCode) >= len(llBase) || int(mlCode) >= len(mlBase) {
+			return errCorrupt
+		}
+		offset := uint32(1)<<ofCode + b.read(int(ofCode))
+		matchLen := mlBase[mlCode] + b.read(int(mlBits[mlCode]))
+		litLen := llBase[llCode] + b.read(int(llBits[llCode]))
+		if i < nbSeq-1 {
+			ll.update(b)
+			ml.update(b)
+			of.update(b)
+		}
+		if b.overflowed() {
+			return errCorrupt
+		}
+
+		if int(litLen) > len(literals) {
+			// Literals were cut short because they fill the output.
+			if len(f.out)+len(literals) < f.max {
+				return errCorrupt
+			}
+			f.append(literals...)
+			return nil
+		}
+		f.append(literals[:litLen]...)
+		literals = literals[litLen:]
+		if offset, err = f.offset(offset, litLen); err != nil {
+			return err
+		}
+		if int(offset) > len(f.out)-f.start {
+			return errCorrupt
+		}
+		for ; matchLen > 0 && len(f.out) < f.max; matchLen-- {
+			f.out = append(f.out, f.out[len(f.out)-int(offset)])
+		}
+	}
+	f.append(literals...)
+
+	return nil
+}
+
+// offset turns an offset value into an actual offset, updating the repeated
+// offsets.
+func (f *zstdFrame) offset(value, litLen uint32) (uint32, error) {
+	if value > 3 {
+		f.reps[2], f.reps[1], f.reps[0] = f.reps[1], f.reps[0], value-3
+		return value - 3, nil
+	}
+	if litLen == 0 {
+		value++
+	}
+	var offset uint32
+	switch value {
+	case 1:
+		return f.reps[0], nil
+	case 2:
+		offset = f.reps[1]
+	case 3:
+		offset = f.reps[2]
+		f.reps[2] = f.reps[1]
+	case 4:
+		offset = f.reps[0] - 1
+		if offset == 0 {
+			return 0, errCorrupt
+		}
+		f.reps[2] = f.reps[1]
+	}
+	f.reps[1], f.reps[0] = f.reps[0], offset
+
+	return offset, nil
+}
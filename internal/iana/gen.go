@@ -0,0 +1,114 @@
+//go:build ignore
+
+// gen.go writes registry.csv, the extract of the IANA Media Types registry
+// which the statuses of media-types.txt are checked against. It downloads the
+// CSV files of the registry and keeps the rows of the media types listed in
+// media-types.txt, including those listed as unregistered, so that the extract
+// shows they are still missing from the registry.
+//
+// Run it with go generate whenever media-types.txt changes.
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const registry = "https://www.iana.org/assignments/media-types/"
+
+// topLevel holds the top-level types of the registry, one CSV file each.
+var topLevel = []string{
+	"application", "audio", "font", "image", "message", "model", "multipart",
+	"text", "video",
+}
+
+func main() {
+	names, err := snapshotNames("media-types.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var rows [][]string
+	for _, top := range topLevel {
+		records, err := download(registry + top + ".csv")
+		if err != nil {
+			log.Fatal(err)
+		}
+		// The first record holds the column names: Name, Template, Reference.
+		for _, r := range records[1:] {
+			if len(r) < 2 {
+				log.Fatalf("%s.csv: short record %q", top, r)
+			}
+			full := r[1]
+			if full == "" {
+				full = top + "/" + strings.Fields(r[0])[0]
+			}
+			if names[strings.ToLower(full)] {
+				rows = append(rows, []string{top, r[0], r[1]})
+			}
+		}
+	}
+
+	f, err := os.Create("registry.csv")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "# Extract of the IANA Media Types registry, retrieved on %s from\n", time.Now().UTC().Format("2006-01-02"))
+	fmt.Fprintf(f, "# %s{%s}.csv.\n", registry, strings.Join(topLevel, ","))
+	fmt.Fprintf(f, "# Generated by gen.go, do not edit. Only the rows of the media types in\n")
+	fmt.Fprintf(f, "# media-types.txt are kept, with their top-level type, name and template.\n")
+	w := csv.NewWriter(f)
+	w.Write([]string{"Type", "Name", "Template"})
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// snapshotNames returns the lowercase names of the media types in the snapshot
+// file, including their preferred names.
+func snapshotNames(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names := map[string]bool{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		names[strings.ToLower(fields[0])] = true
+		if len(fields) == 3 {
+			names[strings.ToLower(fields[2])] = true
+		}
+	}
+
+	return names, s.Err()
+}
+
+func download(url string) ([][]string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	return csv.NewReader(resp.Body).ReadAll()
+}
@@ -0,0 +1,107 @@
+// Package iana holds a snapshot of the IANA Media Types registry.
+package iana
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Status is the registration status of a media type.
+type Status uint8
+
+const (
+	// Unregistered media types are not present in the IANA registry.
+	Unregistered Status = iota
+	// Registered media types are present in the IANA registry.
+	Registered
+	// Deprecated media types are present in the IANA registry, but are marked
+	// as deprecated or obsoleted in favor of other media types.
+	Deprecated
+)
+
+// Entry is a media type from the registry snapshot.
+type Entry struct {
+	// Name is the media type name, with the casing used by IANA.
+	Name   string
+	Status Status
+	// Preferred is the media type name which should be used instead of Name.
+	// It is empty when Name is the preferred name.
+	Preferred string
+}
+
+//go:generate go run gen.go
+
+//go:embed media-types.txt
+var snapshot string
+
+var (
+	once    sync.Once
+	entries []Entry
+	// byName indexes entries by their lowercase name.
+	byName map[string]int
+)
+
+// Entries returns all the media types from the registry snapshot, in the order
+// they appear in the snapshot.
+func Entries() []Entry {
+	once.Do(load)
+	return append([]Entry(nil), entries...)
+}
+
+// Lookup returns the snapshot entry for the media type name. The name must
+// not contain parameters. The lookup is case insensitive.
+func Lookup(name string) (Entry, bool) {
+	once.Do(load)
+	i, ok := byName[strings.ToLower(name)]
+	if !ok {
+		return Entry{}, false
+	}
+	return entries[i], true
+}
+
+func load() {
+	var err error
+	entries, err = parse(snapshot)
+	if err != nil {
+		panic(err)
+	}
+	byName = make(map[string]int, len(entries))
+	for i, e := range entries {
+		byName[strings.ToLower(e.Name)] = i
+	}
+}
+
+var statuses = map[string]Status{
+	"unregistered": Unregistered,
+	"registered":   Registered,
+	"deprecated":   Deprecated,
+}
+
+// parse reads the snapshot format: one media type per line, with tab
+// separated name, status and optional preferred name. Empty lines and lines
+// starting with # are ignored.
+func parse(s string) ([]Entry, error) {
+	var ret []Entry
+	for i, line := range strings.Split(s, "\n") {
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("iana: line %d: want 2 or 3 tab separated fields", i+1)
+		}
+		st, ok := statuses[fields[1]]
+		if !ok {
+			return nil, fmt.Errorf("iana: line %d: unknown status %q", i+1, fields[1])
+		}
+		e := Entry{Name: fields[0], Status: st}
+		if len(fields) == 3 {
+			e.Preferred = fields[2]
+		}
+		ret = append(ret, e)
+	}
+
+	return ret, nil
+}
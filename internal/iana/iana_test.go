@@ -0,0 +1,147 @@
+package iana
+
+import (
+	"encoding/csv"
+	"errors"
+	"io/fs"
+	"mime"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestSnapshot verifies the embedded registry snapshot is well formed.
+func TestSnapshot(t *testing.T) {
+	es, err := parse(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) == 0 {
+		t.Fatal("registry snapshot is empty")
+	}
+
+	names := map[string]Entry{}
+	for _, e := range es {
+		parsed, params, err := mime.ParseMediaType(e.Name)
+		if err != nil || len(params) > 0 || parsed != strings.ToLower(e.Name) {
+			t.Errorf("%s: malformed media type name", e.Name)
+		}
+		if _, ok := names[parsed]; ok {
+			t.Errorf("%s: duplicate entry", e.Name)
+		}
+		names[parsed] = e
+		if e.Status == Deprecated && e.Preferred == "" {
+			t.Errorf("%s: deprecated media types must have a preferred name", e.Name)
+		}
+		if e.Status == Registered && e.Preferred != "" {
+			t.Errorf("%s: registered media types must not have a preferred name", e.Name)
+		}
+	}
+
+	isSorted := sort.SliceIsSorted(es, func(i, j int) bool {
+		return strings.ToLower(es[i].Name) < strings.ToLower(es[j].Name)
+	})
+	if !isSorted {
+		t.Error("registry snapshot entries must be sorted by name")
+	}
+
+	for _, e := range es {
+		if e.Preferred == "" {
+			continue
+		}
+		p, ok := names[strings.ToLower(e.Preferred)]
+		if !ok {
+			t.Errorf("%s: preferred name %s is not in the snapshot", e.Name, e.Preferred)
+			continue
+		}
+		if p.Preferred != "" || p.Status == Deprecated {
+			t.Errorf("%s: preferred name %s must be a final name", e.Name, e.Preferred)
+		}
+	}
+}
+
+// TestSnapshotRegistry checks the statuses of the snapshot against
+// registry.csv, the extract of the IANA registry written by gen.go.
+func TestSnapshotRegistry(t *testing.T) {
+	f, err := os.Open("registry.csv")
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Skip("registry.csv is missing, run go generate with network access")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rows holds the Name column of the registry, by lowercase media type.
+	rows := map[string]string{}
+	for _, rec := range records[1:] {
+		full := rec[2]
+		if full == "" {
+			full = rec[0] + "/" + strings.Fields(rec[1])[0]
+		}
+		rows[strings.ToLower(full)] = rec[1]
+	}
+
+	for _, e := range Entries() {
+		name, ok := rows[strings.ToLower(e.Name)]
+		upper := strings.ToUpper(name)
+		deprecated := strings.Contains(upper, "DEPRECATED") || strings.Contains(upper, "OBSOLETE")
+		switch e.Status {
+		case Unregistered:
+			if ok {
+				t.Errorf("%s: unregistered, but in the registry as %q", e.Name, name)
+			}
+		case Registered:
+			if !ok || deprecated {
+				t.Errorf("%s: registered, but the registry has %q", e.Name, name)
+			}
+		case Deprecated:
+			if !ok || !deprecated {
+				t.Errorf("%s: deprecated, but the registry has %q", e.Name, name)
+			}
+			_, favored, found := strings.Cut(name, "in favor of ")
+			if found && !strings.EqualFold(strings.Trim(favored, " )"), e.Preferred) {
+				t.Errorf("%s: preferred name %s, but the registry has %q", e.Name, e.Preferred, name)
+			}
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tcs := []struct {
+		name  string
+		found bool
+		entry Entry
+	}{
+		{"application/zip", true, Entry{"application/zip", Registered, ""}},
+		{"APPLICATION/ZIP", true, Entry{"application/zip", Registered, ""}},
+		{"application/x-zip", true, Entry{"application/x-zip", Unregistered, "application/zip"}},
+		{"application/javascript", true, Entry{"application/javascript", Deprecated, "text/javascript"}},
+		{"foo/bar", false, Entry{}},
+	}
+	for _, tc := range tcs {
+		e, ok := Lookup(tc.name)
+		if ok != tc.found || e != tc.entry {
+			t.Errorf("Lookup(%s); expected: %v %v, got: %v %v", tc.name, tc.entry, tc.found, e, ok)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, in := range []string{
+		"application/zip",
+		"application/zip\tbogus",
+		"application/zip\tregistered\ta\tb",
+	} {
+		if _, err := parse(in); err == nil {
+			t.Errorf("parse(%q) should fail", in)
+		}
+	}
+}
@@ -3,6 +3,10 @@ package magic
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
+
+	"github.com/gabriel-vasile/mimetype/internal/decompress"
+	"github.com/gabriel-vasile/mimetype/internal/sevenz"
 )
 
 var (
@@ -73,12 +77,13 @@ func CRX(raw []byte, limit uint32) bool {
 	return Zip(raw[zipOffset:], limit)
 }
 
+// sizeRecord is the size of the records of tar archives.
+const sizeRecord = 512
+
 // Tar matches a (t)ape (ar)chive file.
 // Tar files are divided into 512 bytes records. First record contains a 257
 // bytes header padded with NUL.
 func Tar(raw []byte, _ uint32) bool {
-	const sizeRecord = 512
-
 	// The structure of a tar header:
 	// type TarHeader struct {
 	// 	Name     [100]byte
@@ -117,6 +122,30 @@ func Tar(raw []byte, _ uint32) bool {
 	return recsum == sum1 || recsum == sum2
 }
 
+var (
+	// GzipTar matches a tar archive compressed with gzip.
+	GzipTar = compressedTar(decompress.Gzip)
+	// XzTar matches a tar archive compressed with xz.
+	XzTar = compressedTar(decompress.Xz)
+	// ZstdTar matches a tar archive compressed with Zstandard.
+	ZstdTar = compressedTar(decompress.Zstd)
+	// Bz2Tar matches a tar archive compressed with bzip2.
+	Bz2Tar = compressedTar(decompress.Bzip2)
+	// LzipTar matches a tar archive compressed with lzip.
+	LzipTar = compressedTar(decompress.Lzip)
+)
+
+// compressedTar returns a Detector which decompresses the first tar record
+// with inflate and checks its header. Bzip2 and Zstandard decompress whole
+// blocks, so they only match when the input holds the first block entirely.
+func compressedTar(inflate func(in []byte, max int) ([]byte, error)) Detector {
+	return func(raw []byte, limit uint32) bool {
+		// Errors are expected because raw is usually cut short.
+		out, _ := inflate(raw, sizeRecord)
+		return Tar(out, limit)
+	}
+}
+
 // tarParseOctal converts octal string to decimal int.
 func tarParseOctal(b []byte) int64 {
 	// Because unused fields are filled with NULs, we need to skip leading NULs.
@@ -156,3 +185,132 @@ func tarChksum(b []byte) (unsigned, signed int64) {
 	}
 	return unsigned, signed
 }
+
+// SevenZNextHeader returns the position and size of the header of the 7z
+// archive starting with in, read from the signature header. The header is
+// usually at the end of the archive.
+func SevenZNextHeader(in []byte) (off, size int64, ok bool) {
+	if len(in) < 32 || !SevenZ(in, 0) {
+		return 0, 0, false
+	}
+	o := binary.LittleEndian.Uint64(in[12:])
+	s := binary.LittleEndian.Uint64(in[20:])
+	// Sizes beyond 1TiB are bogus, and would overflow below.
+	if o > 1<<40 || s > 1<<40 {
+		return 0, 0, false
+	}
+	return 32 + int64(o), int64(s), true
+}
+
+// MaxSevenZHeader is the maximum size of the header of 7z archives read to
+// tell whether they are encrypted, and of their packed header when compressed.
+const MaxSevenZHeader = 64 << 10
+
+// SevenZEncrypted returns true if the 7z archive in, whose header must be in
+// the input, is encrypted. See SevenZHeaderEncrypted.
+func SevenZEncrypted(in []byte) bool {
+	off, size, ok := SevenZNextHeader(in)
+	if !ok || off > int64(len(in)) {
+		return false
+	}
+	hdr := in[off:]
+	if size < int64(len(hdr)) {
+		hdr = hdr[:size]
+	}
+	return SevenZHeaderEncrypted(hdr, bytes.NewReader(in), MaxSevenZHeader)
+}
+
+// SevenZHeaderEncrypted returns true if the 7z archive header hdr lists the
+// AES-256 coder. Archives with encrypted headers have an encoded header packed
+// by AES-256. Archives with encrypted content only list it in their header,
+// which 7-Zip compresses by default: compressed headers are decoded, with
+// their packed stream of at most max bytes read from the archive r.
+func SevenZHeaderEncrypted(hdr []byte, r io.ReaderAt, max int64) bool {
+	h, _ := sevenz.ReadHeader(hdr, func(s *sevenz.Streams) ([]byte, error) {
+		return sevenz.Decode(r, s, uint64(max))
+	})
+	return h.Encrypted()
+}
+
+// RarEncrypted returns true if the RAR5 archive in has encrypted headers, or
+// if any of the files or service headers in the input are encrypted.
+// https://www.rarlab.com/technote.htm
+func RarEncrypted(in []byte) bool {
+	sig := []byte("Rar!\x1A\x07\x01\x00")
+	if !bytes.HasPrefix(in, sig) {
+		return false
+	}
+	in = in[len(sig):]
+	const (
+		encryptionHeader = 4
+		fileHeader       = 2
+		serviceHeader    = 3
+		endHeader        = 5
+		encryptionRecord = 1
+	)
+	for len(in) > 4 {
+		// Each header starts with its CRC32 and its size.
+		size, n := rarVint(in[4:])
+		if n == 0 {
+			return false
+		}
+		in = in[4+n:]
+		h := in
+		if size < uint64(len(h)) {
+			h = h[:size]
+		}
+		typ, n := rarVint(h)
+		if n == 0 {
+			return false
+		}
+		if typ == encryptionHeader {
+			return true
+		}
+		if typ == endHeader || size > uint64(len(in)) {
+			return false
+		}
+		h = h[n:]
+		flags, n := rarVint(h)
+		h = h[n:]
+		var extra, data uint64
+		if flags&0x1 != 0 {
+			extra, n = rarVint(h)
+			h = h[n:]
+		}
+		if flags&0x2 != 0 {
+			data, _ = rarVint(h)
+		}
+		// The extra area is at the end of the header, as a list of records.
+		if (typ == fileHeader || typ == serviceHeader) && extra <= size {
+			for rec := in[size-extra : size]; len(rec) > 0; {
+				recSize, n := rarVint(rec)
+				if n == 0 || recSize == 0 || recSize > uint64(len(rec)-n) {
+					break
+				}
+				if recType, _ := rarVint(rec[n:]); recType == encryptionRecord {
+					return true
+				}
+				rec = rec[uint64(n)+recSize:]
+			}
+		}
+		if data > uint64(len(in))-size {
+			return false
+		}
+		in = in[size+data:]
+	}
+	return false
+}
+
+// rarVint decodes a variable length integer of RAR5 archives, made of 7 bits
+// per byte, least significant first. It returns the number of bytes read, or
+// 0 when in does not hold a valid integer.
+func rarVint(in []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(in) && i < 10; i++ {
+		v |= uint64(in[i]&0x7F) << (7 * i)
+		if in[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
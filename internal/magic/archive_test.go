@@ -1,6 +1,10 @@
 package magic
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestTarParseOctal(t *testing.T) {
 	tests := []struct {
@@ -28,3 +32,77 @@ func TestTarParseOctal(t *testing.T) {
 		}
 	}
 }
+
+func TestRarEncrypted(t *testing.T) {
+	sig := "Rar!\x1A\x07\x01\x00"
+	crc := "\x00\x00\x00\x00"
+	// Headers are the CRC32, the size, then the type and the flags.
+	main := crc + "\x03\x01\x00\x00"
+	// A file header with 10 bytes of data and an extra area of 3 bytes
+	// holding a record of type typ.
+	file := func(typ byte) string {
+		fields := "\x02\x03\x03\x0a" + "\x00\x00\x00\x00\x00\x00\x01\x00\x00\x01a"
+		extra := string([]byte{0x02, typ, 0x00})
+		return crc + string(rune(len(fields)+len(extra))) + fields + extra + "0123456789"
+	}
+	tests := []struct {
+		name string
+		in   string
+		want bool
+	}{
+		{"encrypted headers", sig + crc + "\x02\x04\x00", true},
+		{"encrypted file", sig + main + file(0x02) + file(0x01), true},
+		{"plain files", sig + main + file(0x02) + file(0x02) + crc + "\x02\x05\x00", false},
+		{"file cut short", sig + main + file(0x01)[:12], false},
+		{"rar4", "Rar!\x1A\x07\x00" + crc + "\x02\x04\x00", false},
+		{"bad size", sig + crc + "\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff", false},
+	}
+	for _, tt := range tests {
+		if got := RarEncrypted([]byte(tt.in)); got != tt.want {
+			t.Errorf("%s: got %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSevenZEncrypted(t *testing.T) {
+	sevenZ := func(hdr string) []byte {
+		b := make([]byte, 32, 32+len(hdr))
+		copy(b, "7z\xbc\xaf\x27\x1c\x00\x04")
+		b[20] = byte(len(hdr))
+		return append(b, hdr...)
+	}
+	aes := "\x24\x06\xf1\x07\x01\x02\x13\x00"
+	tests := []struct {
+		name string
+		in   []byte
+		want bool
+	}{
+		{"encrypted header", sevenZ("\x17\x06\x00\x01\x09\x30\x00\x07\x0b\x01\x00\x01" + aes), true},
+		{"plain header", sevenZ("\x01\x04\x06\x00\x01\x09\x30\x00\x07\x0b\x01\x00\x01\x23\x03\x01\x01\x05\x5d"), false},
+		{"header cut short", sevenZ("\x17\x06\x00\x01\x09\x30\x00\x07\x0b\x01\x00\x01" + aes)[:40], false},
+		// 7z a -p -mhc=off: the header lists the coders of the content.
+		{"encrypted content, plain header", sevenZ("\x01\x04\x06\x00\x01\x09\x10\x00\x07\x0b\x01\x00\x02" + aes +
+			"\x23\x03\x01\x01\x05\x5d\x00\x00\x01\x00\x01\x00\x0c\x10\x0a\x00\x08\x00\x00"), true},
+		{"archive properties", sevenZ("\x01\x02\x01\x02\xff\xff\x00\x04\x06\x00\x01\x09\x10\x00\x07\x0b\x01\x00\x01" + aes), true},
+		// The packed stream of the compressed header is not LZMA data.
+		{"corrupt compressed header", sevenZ("\x17\x06\x10\x01\x09\x30\x00\x07\x0b\x01\x00\x01" +
+			"\x23\x03\x01\x01\x05\x5d\x00\x00\x01\x00\x0c\x70\x0a\x01\x01\x02\x03\x04\x00\x00"), false},
+		{"pack CRCs", sevenZ("\x17\x06\x00\x02\x09\x30\x30\x0a\x00\x02\x01\x02\x03\x04\x00\x07\x0b\x01\x00\x01" + aes), true},
+		{"AES in properties", sevenZ("\x17\x06\x00\x01\x09\x30\x00\x07\x0b\x01\x00\x01\x23\x03\x01\x01\x05\x24\x06\xf1\x07\x01\x00"), false},
+	}
+	// 7z a -p: the coders of the content are in the compressed header.
+	password, err := os.ReadFile(filepath.Join("..", "..", "testdata", "7z.password.7z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests = append(tests, struct {
+		name string
+		in   []byte
+		want bool
+	}{"encrypted content, compressed header", password, true})
+	for _, tt := range tests {
+		if got := SevenZEncrypted(tt.in); got != tt.want {
+			t.Errorf("%s: got %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package magic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+// Compound File Binary files, also known as OLE2 or structured storage, hold
+// a file system of storages and streams. Microsoft Office 97-2003 documents,
+// Outlook messages and Windows Installer packages are compound files which
+// differ in the names of their top level entries.
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-cfb/53989ce4-7b05-4f8d-829b-d08d6148375b
+
+const (
+	cfbHeaderLen  = 512
+	cfbEntryLen   = 128
+	cfbNoStream   = 0xFFFFFFFF
+	cfbMaxSector  = 0xFFFFFFFA
+	cfbHeaderFATs = 109
+
+	cfbStorage = 1
+	cfbStream  = 2
+	cfbRoot    = 5
+)
+
+var oleSig = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// cfbEntry is an entry of the directory of a compound file.
+type cfbEntry struct {
+	name  string
+	typ   byte
+	clsid []byte
+	// left, right and child are the IDs of the entries linked to this one in
+	// the red-black trees of the directory.
+	left, right, child uint32
+	// start is the first sector of the content, of size bytes.
+	start uint32
+	size  uint64
+}
+
+// cfbDir holds the root entry of a compound file and the entries of the
+// root storage.
+type cfbDir struct {
+	r    cfbReader
+	root cfbEntry
+	top  []cfbEntry
+}
+
+// has returns true if the root storage holds an entry named name.
+func (d cfbDir) has(name string) bool {
+	for _, e := range d.top {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPrefix returns true if the root storage holds an entry of type typ
+// whose name starts with prefix.
+func (d cfbDir) hasPrefix(typ byte, prefix string) bool {
+	for _, e := range d.top {
+		if e.typ == typ && strings.HasPrefix(e.name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// stream returns up to max bytes of the content of the stream named name in
+// the root storage, as far as in holds it.
+func (d cfbDir) stream(name string, max int) []byte {
+	for _, e := range d.top {
+		if e.typ != cfbStream || e.name != name {
+			continue
+		}
+		size := d.r.size(e)
+		if size > max {
+			size = max
+		}
+		// Streams smaller than the cutoff are stored in the mini stream,
+		// in sectors of 64 bytes listed in the mini FAT.
+		if d.r.size(e) >= int(binary.LittleEndian.Uint32(d.r.in[56:])) {
+			return d.r.chain(e.start, size, d.r.sector, d.r.next)
+		}
+		miniStream := d.r.chain(d.root.start, d.r.size(d.root), d.r.sector, d.r.next)
+		miniFAT := d.r.chain(binary.LittleEndian.Uint32(d.r.in[60:]), len(d.r.in), d.r.sector, d.r.next)
+		miniSector := func(id uint32) []byte {
+			if int64(id)*64+64 > int64(len(miniStream)) {
+				return nil
+			}
+			return miniStream[id*64 : id*64+64]
+		}
+		miniNext := func(id uint32) (uint32, bool) {
+			if int64(id)*4+4 > int64(len(miniFAT)) {
+				return 0, false
+			}
+			return binary.LittleEndian.Uint32(miniFAT[id*4:]), true
+		}
+		return d.r.chain(e.start, size, miniSector, miniNext)
+	}
+	return nil
+}
+
+// cfbReader reads the sectors of a compound file.
+type cfbReader struct {
+	in         []byte
+	sectorSize int
+}
+
+// sector returns the content of the sector id, or nil when in does not
+// hold it.
+func (r cfbReader) sector(id uint32) []byte {
+	if id > cfbMaxSector {
+		return nil
+	}
+	off := (int64(id) + 1) * int64(r.sectorSize)
+	if off+int64(r.sectorSize) > int64(len(r.in)) {
+		return nil
+	}
+	return r.in[off : off+int64(r.sectorSize)]
+}
+
+// fatSector returns the ID of the i-th sector of the File Allocation Table.
+// The IDs of the first 109 sectors are in the header, the others in a chain
+// of DIFAT sectors, each ending with the ID of the next one.
+func (r cfbReader) fatSector(i uint32) (uint32, bool) {
+	if i < cfbHeaderFATs {
+		return binary.LittleEndian.Uint32(r.in[76+4*i:]), true
+	}
+	i -= cfbHeaderFATs
+	perSector := uint32(r.sectorSize/4 - 1)
+	id := binary.LittleEndian.Uint32(r.in[68:])
+	hops := i / perSector
+	if int64(hops) > int64(len(r.in)/r.sectorSize) {
+		return 0, false
+	}
+	for ; hops > 0; hops-- {
+		s := r.sector(id)
+		if s == nil {
+			return 0, false
+		}
+		id = binary.LittleEndian.Uint32(s[4*perSector:])
+	}
+	s := r.sector(id)
+	if s == nil {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(s[4*(i%perSector):]), true
+}
+
+// next returns the ID of the sector following id in its chain.
+func (r cfbReader) next(id uint32) (uint32, bool) {
+	perSector := uint32(r.sectorSize / 4)
+	fat, ok := r.fatSector(id / perSector)
+	if !ok {
+		return 0, false
+	}
+	s := r.sector(fat)
+	if s == nil {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(s[4*(id%perSector):]), true
+}
+
+// size returns the size of the content of e, capped to the size of the file.
+func (r cfbReader) size(e cfbEntry) int {
+	size := e.size
+	// Version 3 files can have garbage in the high 32 bits.
+	if r.sectorSize == 512 {
+		size &= 0xFFFFFFFF
+	}
+	if size > uint64(len(r.in)) {
+		return len(r.in)
+	}
+	return int(size)
+}
+
+// chain returns up to size bytes from the chain of sectors starting at id.
+func (r cfbReader) chain(id uint32, size int, sector func(uint32) []byte, next func(uint32) (uint32, bool)) []byte {
+	var out []byte
+	// Chains cannot be longer than the number of sectors; longer ones loop.
+	for n := len(r.in) / 64; len(out) < size && n > 0; n-- {
+		s := sector(id)
+		if s == nil {
+			break
+		}
+		out = append(out, s...)
+		var ok bool
+		if id, ok = next(id); !ok {
+			break
+		}
+	}
+	if len(out) > size {
+		out = out[:size]
+	}
+	return out
+}
+
+// entries returns the entries of the directory, indexed by their ID.
+// complete is false when in does not hold the whole directory.
+func (r cfbReader) entries() (entries []cfbEntry, complete bool) {
+	id := binary.LittleEndian.Uint32(r.in[48:])
+	// Chains cannot be longer than the number of sectors; longer ones loop.
+	for n := len(r.in) / r.sectorSize; n > 0; n-- {
+		if id > cfbMaxSector {
+			return entries, true
+		}
+		s := r.sector(id)
+		if s == nil {
+			return entries, false
+		}
+		for e := s; len(e) >= cfbEntryLen; e = e[cfbEntryLen:] {
+			entries = append(entries, cfbParseEntry(e))
+		}
+		var ok bool
+		if id, ok = r.next(id); !ok {
+			return entries, false
+		}
+	}
+	return entries, false
+}
+
+func cfbParseEntry(e []byte) cfbEntry {
+	nameLen := int(binary.LittleEndian.Uint16(e[64:]))
+	if nameLen > 64 {
+		nameLen = 64
+	}
+	// The name is UTF-16 with a null terminator.
+	name := make([]uint16, 0, nameLen/2)
+	for i := 0; i+1 < nameLen; i += 2 {
+		c := binary.LittleEndian.Uint16(e[i:])
+		if c == 0 {
+			break
+		}
+		name = append(name, c)
+	}
+	return cfbEntry{
+		name:  string(utf16.Decode(name)),
+		typ:   e[66],
+		left:  binary.LittleEndian.Uint32(e[68:]),
+		right: binary.LittleEndian.Uint32(e[72:]),
+		child: binary.LittleEndian.Uint32(e[76:]),
+		clsid: e[80:96],
+		start: binary.LittleEndian.Uint32(e[116:]),
+		size:  binary.LittleEndian.Uint64(e[120:]),
+	}
+}
+
+// sharedCFB holds the directory of a shared compound file.
+type sharedCFB struct {
+	once     sync.Once
+	dir      cfbDir
+	complete bool
+}
+
+// cfbDirectory reads the directory of the compound file in. complete is false
+// when in does not hold the whole directory; dir then holds the entries which
+// could be read.
+func cfbDirectory(in []byte) (dir cfbDir, complete bool) {
+	s := sharedOf(in)
+	if s == nil {
+		return readCFBDirectory(in)
+	}
+	c := &s.cfb
+	c.once.Do(func() {
+		c.dir, c.complete = readCFBDirectory(in)
+	})
+	return c.dir, c.complete
+}
+
+// readCFBDirectory is cfbDirectory for inputs which are not shared.
+func readCFBDirectory(in []byte) (dir cfbDir, complete bool) {
+	if len(in) < cfbHeaderLen || !bytes.HasPrefix(in, oleSig) {
+		return dir, false
+	}
+	// Version 3 files have sectors of 512 bytes, version 4 of 4096 bytes.
+	shift := binary.LittleEndian.Uint16(in[30:])
+	if shift != 9 && shift != 12 {
+		return dir, false
+	}
+	r := cfbReader{in: in, sectorSize: 1 << shift}
+	entries, complete := r.entries()
+	if len(entries) == 0 || entries[0].typ != cfbRoot {
+		return dir, false
+	}
+	dir.r = r
+	dir.root = entries[0]
+
+	// The entries of a storage are the nodes of a tree rooted at its child.
+	stack := []uint32{dir.root.child}
+	seen := make(map[uint32]bool)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == cfbNoStream || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if int(id) >= len(entries) {
+			complete = false
+			continue
+		}
+		e := entries[id]
+		if e.typ == cfbStorage || e.typ == cfbStream {
+			dir.top = append(dir.top, e)
+		}
+		stack = append(stack, e.left, e.right)
+	}
+
+	return dir, complete
+}
@@ -0,0 +1,176 @@
+package magic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// testCFB returns a version 3 compound file whose root storage, with the
+// CLSID clsid, holds empty streams named top. When nested is not empty, the
+// root storage also holds a storage named ObjectPool with streams named nested.
+func testCFB(clsid []byte, top, nested []string) []byte {
+	const none = 0xFFFFFFFF
+	entry := func(name string, typ byte, right, child uint32, clsid []byte) []byte {
+		e := make([]byte, cfbEntryLen)
+		u := utf16.Encode([]rune(name))
+		for i, c := range u {
+			binary.LittleEndian.PutUint16(e[2*i:], c)
+		}
+		binary.LittleEndian.PutUint16(e[64:], uint16(2*len(u)+2))
+		e[66] = typ
+		binary.LittleEndian.PutUint32(e[68:], none)
+		binary.LittleEndian.PutUint32(e[72:], right)
+		binary.LittleEndian.PutUint32(e[76:], child)
+		copy(e[80:], clsid)
+		binary.LittleEndian.PutUint32(e[116:], 0xFFFFFFFE)
+		return e
+	}
+	// Siblings are linked by their right pointer, which is a valid, if
+	// unbalanced, tree.
+	next := func(i, n int, id uint32) uint32 {
+		if i == n-1 {
+			return none
+		}
+		return id + 1
+	}
+	dir := &bytes.Buffer{}
+	n := len(top)
+	if len(nested) > 0 {
+		n++
+	}
+	dir.Write(entry("Root Entry", cfbRoot, none, 1, clsid))
+	for i, name := range top {
+		dir.Write(entry(name, cfbStream, next(i, n, uint32(1+i)), none, nil))
+	}
+	if len(nested) > 0 {
+		dir.Write(entry("ObjectPool", cfbStorage, none, uint32(n+1), nil))
+		for i, name := range nested {
+			dir.Write(entry(name, cfbStream, next(i, len(nested), uint32(n+1+i)), none, nil))
+		}
+	}
+	for dir.Len()%512 != 0 {
+		dir.Write(make([]byte, cfbEntryLen))
+	}
+
+	// Sector 0 holds the FAT, the next ones the directory.
+	fat := make([]byte, 512)
+	for i := range fat {
+		fat[i] = 0xFF
+	}
+	binary.LittleEndian.PutUint32(fat, 0xFFFFFFFD)
+	dirSectors := dir.Len() / 512
+	for i := 1; i <= dirSectors; i++ {
+		binary.LittleEndian.PutUint32(fat[4*i:], uint32(i+1))
+	}
+	binary.LittleEndian.PutUint32(fat[4*dirSectors:], 0xFFFFFFFE)
+
+	h := make([]byte, cfbHeaderLen)
+	copy(h, oleSig)
+	binary.LittleEndian.PutUint16(h[26:], 3)
+	binary.LittleEndian.PutUint16(h[28:], 0xFFFE)
+	binary.LittleEndian.PutUint16(h[30:], 9)
+	binary.LittleEndian.PutUint16(h[32:], 6)
+	binary.LittleEndian.PutUint32(h[44:], 1)
+	binary.LittleEndian.PutUint32(h[48:], 1)
+	binary.LittleEndian.PutUint32(h[56:], 4096)
+	binary.LittleEndian.PutUint32(h[60:], 0xFFFFFFFE)
+	binary.LittleEndian.PutUint32(h[68:], 0xFFFFFFFE)
+	for i := 76; i < cfbHeaderLen; i += 4 {
+		binary.LittleEndian.PutUint32(h[i:], none)
+	}
+	binary.LittleEndian.PutUint32(h[76:], 0)
+
+	return append(append(h, fat...), dir.Bytes()...)
+}
+
+func TestCFBDirectory(t *testing.T) {
+	docWithChart := testCFB(nil, []string{"WordDocument", "1Table", "Data"}, []string{"Workbook"})
+	loop := testCFB(nil, []string{"WordDocument"}, nil)
+	// The FAT links the first directory sector to itself.
+	binary.LittleEndian.PutUint32(loop[cfbHeaderLen+4:], 1)
+	// The last entries are in the 11th directory sector.
+	after40 := func(name string) []byte {
+		names := make([]string, 40)
+		for i := range names {
+			names[i] = "Stream"
+		}
+		return testCFB(nil, append(names, name), nil)
+	}
+	ppt := after40("PowerPoint Document")
+	vsd := after40("VisioDocument")
+
+	tcs := []struct {
+		name     string
+		in       []byte
+		detector Detector
+		want     bool
+	}{
+		{"doc", docWithChart, Doc, true},
+		{"embedded workbook is not xls", docWithChart, Xls, false},
+		{"xls", testCFB(nil, []string{"\x05SummaryInformation", "Workbook"}, nil), Xls, true},
+		{"excel 95", testCFB(nil, []string{"Book"}, nil), Xls, true},
+		{"ppt in a later directory sector", ppt, Ppt, true},
+		{"truncated ppt falls back to guesses", ppt[:2048], Ppt, true},
+		{"vsd in a later directory sector", vsd, Vsd, true},
+		{"truncated vsd", vsd[:2048], Vsd, false},
+		{"msg", testCFB(nil, []string{"__properties_version1.0", "__substg1.0_0037001F"}, nil), Msg, true},
+		{"msg is not oft", testCFB(nil, []string{"__substg1.0_0037001F"}, nil), Oft, false},
+		{"vsd", testCFB(nil, []string{"VisioDocument"}, nil), Vsd, true},
+		{"wps", testCFB(nil, []string{"CONTENTS", "MatOST"}, nil), Wps, true},
+		{"pub", testCFB(nil, []string{"Contents", "Quill"}, nil), Pub, true},
+		{"looping directory", loop, Doc, true},
+		{"looping directory is not xls", loop, Xls, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.detector(tc.in, 0); got != tc.want {
+				t.Errorf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOLEMacros(t *testing.T) {
+	record := func(typ uint16, data ...byte) []byte {
+		r := binary.LittleEndian.AppendUint16(nil, typ)
+		r = binary.LittleEndian.AppendUint16(r, uint16(len(data)))
+		return append(r, data...)
+	}
+	sheet := func(dt byte) []byte {
+		return record(0x0085, 0, 0, 0, 0, 0, dt, 1, 0, 'S')
+	}
+	eof := record(0x000A)
+	vbaInfo := func(hasMacros byte) []byte {
+		return []byte{
+			0x0F, 0x00, 0xFF, 0x03, 0x14, 0x00, 0x00, 0x00,
+			0x02, 0x00, 0x00, 0x04, 0x0C, 0x00, 0x00, 0x00,
+			0x05, 0x00, 0x00, 0x00, hasMacros, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00,
+		}
+	}
+
+	tcs := []struct {
+		name string
+		got  bool
+		want bool
+	}{
+		{"word macros", OLEMacros(testCFB(nil, []string{"WordDocument", "Macros"}, nil)), true},
+		{"excel vba", OLEMacros(testCFB(nil, []string{"Workbook", "_VBA_PROJECT_CUR"}, nil)), true},
+		{"nested macros", OLEMacros(testCFB(nil, []string{"WordDocument"}, []string{"Macros"})), false},
+		{"no macros", OLEMacros(testCFB(nil, []string{"WordDocument", "1Table"}, nil)), false},
+		{"xlm sheet", xlsMacroSheets(bytes.Join([][]byte{sheet(0), sheet(1), eof}, nil)), true},
+		{"excel 5 module sheet", xlsMacroSheets(bytes.Join([][]byte{sheet(6), eof}, nil)), true},
+		{"worksheets only", xlsMacroSheets(bytes.Join([][]byte{sheet(0), sheet(2), eof}, nil)), false},
+		{"sheet after globals", xlsMacroSheets(bytes.Join([][]byte{sheet(0), eof, sheet(1)}, nil)), false},
+		{"record cut short", xlsMacroSheets(sheet(1)[:8]), false},
+		{"ppt vba", pptMacros(append([]byte("records"), vbaInfo(1)...)), true},
+		{"ppt vba without macros", pptMacros(vbaInfo(0)), false},
+		{"ppt cut short", pptMacros(vbaInfo(1)[:20]), false},
+	}
+	for _, tc := range tcs {
+		if tc.got != tc.want {
+			t.Errorf("%s: got %t, want %t", tc.name, tc.got, tc.want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package magic
 
-import "bytes"
+import (
+	"bytes"
+	"strings"
+)
 
 var (
 	// Pdf matches a Portable Document Format file.
@@ -21,6 +24,145 @@ var (
 	Lit = prefix([]byte("ITOLITLS"))
 )
 
+// pdfMaxJunk is the size of the data readers accept before the PDF header.
+const pdfMaxJunk = 1024
+
+// PdfJunk matches a PDF file whose header follows up to 1024 bytes of junk, as
+// readers accept. As the header is not at the start of the input, it must be
+// complete, as in %PDF-1.7 followed by an end of line, and PdfJunk must only
+// be checked once all other formats, which can mention it, failed to match.
+func PdfJunk(raw []byte, limit uint32) bool {
+	return pdfJunkHeader(raw) != -1
+}
+
+// PdfHeader returns the offset of the %PDF- header in raw, either at its
+// start or after junk, or -1 when raw has no PDF header.
+func PdfHeader(raw []byte) int {
+	for _, p := range [][]byte{[]byte("%PDF-"), []byte("\012%PDF-"), []byte("\xef\xbb\xbf%PDF-")} {
+		if bytes.HasPrefix(raw, p) {
+			return len(p) - len("%PDF-")
+		}
+	}
+	return pdfJunkHeader(raw)
+}
+
+// pdfJunkHeader returns the offset of the first complete PDF header in the
+// first 1024 bytes of raw, or -1 when there is none.
+func pdfJunkHeader(raw []byte) int {
+	sig := []byte("%PDF-")
+	head := raw
+	if len(head) > pdfMaxJunk+len(sig) {
+		head = head[:pdfMaxJunk+len(sig)]
+	}
+	for off := 0; ; {
+		i := bytes.Index(head[off:], sig)
+		if i == -1 {
+			return -1
+		}
+		v := raw[off+i+len(sig):]
+		if len(v) >= 4 && '0' <= v[0] && v[0] <= '9' && v[1] == '.' &&
+			'0' <= v[2] && v[2] <= '9' && (v[3] == '\r' || v[3] == '\n') {
+			return off + i
+		}
+		off += i + len(sig)
+	}
+}
+
+// PdfVersion returns the version written in the header of the PDF file in,
+// such as 1.7, or the empty string when it is missing.
+func PdfVersion(in []byte) string {
+	i := PdfHeader(in)
+	if i == -1 {
+		return ""
+	}
+	v := in[i+len("%PDF-"):]
+	n, dot := 0, false
+	for ; n < len(v) && n < 8; n++ {
+		if v[n] == '.' && !dot && n > 0 {
+			dot = true
+			continue
+		}
+		if v[n] < '0' || v[n] > '9' {
+			break
+		}
+	}
+	if !dot || v[n-1] == '.' {
+		return ""
+	}
+	return string(v[:n])
+}
+
+// PdfLinearized returns true if the PDF file in is linearized, or optimized
+// for the web. The linearization dictionary is the first object of the file.
+func PdfLinearized(in []byte) bool {
+	i := PdfHeader(in)
+	if i == -1 {
+		return false
+	}
+	head := in[i:]
+	if len(head) > pdfMaxJunk {
+		head = head[:pdfMaxJunk]
+	}
+	return pdfHasName(head, "/Linearized")
+}
+
+// PdfActiveContent returns true if in, part of a PDF file, holds scripts,
+// launch actions, embedded files or actions run when the document is opened.
+func PdfActiveContent(in []byte) bool {
+	for _, name := range []string{"/JavaScript", "/Launch", "/EmbeddedFile", "/EmbeddedFiles", "/OpenAction"} {
+		if pdfHasName(in, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// PdfConformance returns the parts of the PDF/A, PDF/X and PDF/UA standards
+// the PDF file in claims to conform to in its XMP metadata, such as 2b for
+// PDF/A-2b, 4 for PDF/X-4 and 1 for PDF/UA-1. The metadata is only found
+// when its stream is not compressed.
+// https://www.pdfa.org/resource/iso-19005-pdfa/
+func PdfConformance(in []byte) (pdfa, pdfx, pdfua string) {
+	if part := xmpProperty(in, "pdfaid:part"); part != "" {
+		pdfa = part + strings.ToLower(xmpProperty(in, "pdfaid:conformance"))
+	}
+	pdfx = xmpProperty(in, "pdfxid:GTS_PDFXVersion")
+	if pdfx == "" {
+		// PDF/X-1a and PDF/X-3 use the older pdfx namespace.
+		pdfx = xmpProperty(in, "pdfx:GTS_PDFXVersion")
+	}
+	pdfx = strings.TrimPrefix(pdfx, "PDF/X-")
+	pdfua = xmpProperty(in, "pdfuaid:part")
+	return pdfa, pdfx, pdfua
+}
+
+// xmpProperty returns the value of the simple XMP property name, written as
+// an attribute or as an element, such as pdfaid:part="1" or
+// <pdfaid:part>1</pdfaid:part>. Values which are not short words are ignored.
+func xmpProperty(in []byte, name string) string {
+	v := xmlAttr(in, name)
+	if v == nil {
+		open := []byte("<" + name + ">")
+		if i := bytes.Index(in, open); i != -1 {
+			v = in[i+len(open):]
+			if end := bytes.IndexByte(v, '<'); end != -1 {
+				v = v[:end]
+			}
+		}
+	}
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 || len(v) > 16 {
+		return ""
+	}
+	for _, c := range v {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+			c == '.' || c == '-' || c == ':' || c == '/') {
+			return ""
+		}
+	}
+	return string(v)
+}
+
 // DjVu matches a DjVu file.
 func DjVu(raw []byte, limit uint32) bool {
 	if len(raw) < 12 {
@@ -60,3 +202,54 @@ func P7s(raw []byte, limit uint32) bool {
 
 	return false
 }
+
+// PdfEncrypted returns true if in, part of a PDF file, holds a trailer or a
+// cross-reference stream dictionary with an /Encrypt entry.
+func PdfEncrypted(in []byte) bool {
+	return pdfHasName(in, "/Encrypt")
+}
+
+// pdfHasName returns true if in holds the PDF name, not followed by other
+// characters, as in /EncryptMetadata for /Encrypt.
+func pdfHasName(in []byte, name string) bool {
+	key := []byte(name)
+	for {
+		i := bytes.Index(in, key)
+		if i == -1 {
+			return false
+		}
+		in = in[i+len(key):]
+		if len(in) > 0 && !pdfRegular(in[0]) {
+			return true
+		}
+	}
+}
+
+// PdfStartXref returns the offset of the last cross-reference section of the
+// PDF file ending with tail, read from the startxref keyword.
+func PdfStartXref(tail []byte) (int64, bool) {
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i == -1 {
+		return 0, false
+	}
+	tail = bytes.TrimLeft(tail[i+len("startxref"):], "\r\n\t ")
+	var off int64
+	n := 0
+	for ; n < len(tail) && '0' <= tail[n] && tail[n] <= '9'; n++ {
+		off = off*10 + int64(tail[n]-'0')
+		if off > 1<<40 {
+			return 0, false
+		}
+	}
+	return off, n > 0
+}
+
+// pdfRegular returns true for the characters which are not white-space or
+// delimiters in PDF syntax, and so are part of names and numbers.
+func pdfRegular(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ', '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return false
+	}
+	return true
+}
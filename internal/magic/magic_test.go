@@ -206,3 +206,148 @@ our final approach into Coruscant.
 		Srt([]byte(subtitle), 0)
 	}
 }
+
+func TestPdfEncrypted(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"trailer\n<< /Size 5 /Root 1 0 R /Encrypt 4 0 R >>", true},
+		{"<< /Type /XRef /Encrypt<< /Filter /Standard >> >>", true},
+		{"<< /Filter /Standard /EncryptMetadata false >>", false},
+		{"trailer\n<< /Size 5 /Root 1 0 R >>", false},
+		{"/Encrypt", false},
+	}
+	for _, tt := range tests {
+		if got := PdfEncrypted([]byte(tt.in)); got != tt.want {
+			t.Errorf("PdfEncrypted(%q): got %t, want %t", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPdfStartXref(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"startxref\n1234\n%%EOF\n", 1234, true},
+		{"startxref\r\n0\r\n%%EOF", 0, true},
+		{"startxref 9\nstartxref\n567\n%%EOF", 567, true},
+		{"startxref\n%%EOF", 0, false},
+		{"%%EOF", 0, false},
+		{"startxref\n99999999999999999999", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := PdfStartXref([]byte(tt.in))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("PdfStartXref(%q): got %d, %t, want %d, %t", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPdfHeader(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"%PDF-1.7\n", 0},
+		{"%PDF-", 0},
+		{"\n%PDF-1.4\n", 1},
+		{"\xef\xbb\xbf%PDF-1.4\n", 3},
+		{"Content-Type: application/pdf\r\n\r\n%PDF-2.0\n", 33},
+		{"junk %PDF- %PDF-1.4\r\n", 11},
+		{strings.Repeat(" ", 1024) + "%PDF-1.7\n", 1024},
+		{strings.Repeat(" ", 1025) + "%PDF-1.7\n", -1},
+		{"<html><body>Save as %PDF-1.4 file</body></html>", -1},
+		{`{"magic": "%PDF-"}`, -1},
+		{"junk %PDF-1.4", -1},
+		{"%FDF-1.2\n", -1},
+	}
+	for _, tt := range tests {
+		if got := PdfHeader([]byte(tt.in)); got != tt.want {
+			t.Errorf("PdfHeader(%q): got %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPdfVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"%PDF-1.7\n", "1.7"},
+		{"junk\n%PDF-2.0\r", "2.0"},
+		{"%PDF-1.", ""},
+		{"%PDF-.4", ""},
+		{"%PDF-1\n", ""},
+		{"%PDF-1.4.5", "1.4"},
+		{"%PDF-", ""},
+	}
+	for _, tt := range tests {
+		if got := PdfVersion([]byte(tt.in)); got != tt.want {
+			t.Errorf("PdfVersion(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPdfLinearized(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"%PDF-1.7\n1 0 obj\n<< /Linearized 1 /L 2000 >>", true},
+		{"%PDF-1.7\n1 0 obj\n<</Linearized/L 2000>>", true},
+		{"%PDF-1.7\n1 0 obj\n<< /LinearizedX 1 >>", false},
+		{"%PDF-1.7\n" + strings.Repeat(" ", 1024) + "<< /Linearized 1 >>", false},
+		{"<< /Linearized 1 >>", false},
+	}
+	for _, tt := range tests {
+		if got := PdfLinearized([]byte(tt.in)); got != tt.want {
+			t.Errorf("PdfLinearized(%q): got %t, want %t", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPdfActiveContent(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"<< /S /JavaScript /JS (app.alert(1);) >>", true},
+		{"<< /S /Launch /F (calc.exe) >>", true},
+		{"<< /Type /EmbeddedFile /Length 5 >>", true},
+		{"<< /Names << /EmbeddedFiles 3 0 R >> >>", true},
+		{"<< /Type /Catalog /OpenAction [3 0 R /Fit] >>", true},
+		{"<< /Type /Catalog /Pages 2 0 R >>", false},
+		{"<< /JavaScripts 1 >>", false},
+	}
+	for _, tt := range tests {
+		if got := PdfActiveContent([]byte(tt.in)); got != tt.want {
+			t.Errorf("PdfActiveContent(%q): got %t, want %t", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPdfConformance(t *testing.T) {
+	tests := []struct {
+		in                string
+		pdfa, pdfx, pdfua string
+	}{
+		{`<rdf:Description pdfaid:part="1" pdfaid:conformance="A"/>`, "1a", "", ""},
+		{`<pdfaid:part>3</pdfaid:part><pdfaid:conformance>u</pdfaid:conformance>`, "3u", "", ""},
+		{`<pdfaid:part>4</pdfaid:part>`, "4", "", ""},
+		{`<rdf:Description pdfxid:GTS_PDFXVersion="PDF/X-4"/>`, "", "4", ""},
+		{`<pdfx:GTS_PDFXVersion>PDF/X-1a:2001</pdfx:GTS_PDFXVersion>`, "", "1a:2001", ""},
+		{`<rdf:Description pdfuaid:part='1'/>`, "", "", "1"},
+		{`<pdfaid:part>1; x="y"</pdfaid:part>`, "", "", ""},
+		{`xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/"`, "", "", ""},
+	}
+	for _, tt := range tests {
+		pdfa, pdfx, pdfua := PdfConformance([]byte(tt.in))
+		if pdfa != tt.pdfa || pdfx != tt.pdfx || pdfua != tt.pdfua {
+			t.Errorf("PdfConformance(%q): got %q, %q, %q, want %q, %q, %q",
+				tt.in, pdfa, pdfx, pdfua, tt.pdfa, tt.pdfx, tt.pdfua)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package magic
 import (
 	"bytes"
 	"encoding/binary"
+	"strings"
 )
 
 var (
@@ -44,26 +45,141 @@ var (
 	}
 )
 
-// Xlsx matches a Microsoft Excel 2007 file.
-func Xlsx(raw []byte, limit uint32) bool {
-	return zipContains(raw, xlsxSigFiles...)
+var (
+	// Xlsx matches a Microsoft Excel 2007 file.
+	Xlsx = ooxml("application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml", xlsxSigFiles...)
+	// Xlsm matches a Microsoft Excel macro-enabled workbook.
+	Xlsm = ooxml("application/vnd.ms-excel.sheet.macroEnabled.main+xml")
+	// Xltx matches a Microsoft Excel template.
+	Xltx = ooxml("application/vnd.openxmlformats-officedocument.spreadsheetml.template.main+xml")
+	// Xltm matches a Microsoft Excel macro-enabled template.
+	Xltm = ooxml("application/vnd.ms-excel.template.macroEnabled.main+xml")
+	// Xlsb matches a Microsoft Excel binary workbook.
+	Xlsb = ooxml("application/vnd.ms-excel.sheet.binary.macroEnabled.main")
+	// Xlam matches a Microsoft Excel add-in.
+	Xlam = ooxml("application/vnd.ms-excel.addin.macroEnabled.main+xml")
+	// Docx matches a Microsoft Word 2007 file.
+	Docx = ooxml("application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml", docxSigFiles...)
+	// Docm matches a Microsoft Word macro-enabled document.
+	Docm = ooxml("application/vnd.ms-word.document.macroEnabled.main+xml")
+	// Dotx matches a Microsoft Word template.
+	Dotx = ooxml("application/vnd.openxmlformats-officedocument.wordprocessingml.template.main+xml")
+	// Dotm matches a Microsoft Word macro-enabled template.
+	Dotm = ooxml("application/vnd.ms-word.template.macroEnabledTemplate.main+xml")
+	// Pptx matches a Microsoft PowerPoint 2007 file.
+	Pptx = ooxml("application/vnd.openxmlformats-officedocument.presentationml.presentation.main+xml", pptxSigFiles...)
+	// Pptm matches a Microsoft PowerPoint macro-enabled presentation.
+	Pptm = ooxml("application/vnd.ms-powerpoint.presentation.macroEnabled.main+xml")
+	// Potx matches a Microsoft PowerPoint template.
+	Potx = ooxml("application/vnd.openxmlformats-officedocument.presentationml.template.main+xml")
+	// Ppsx matches a Microsoft PowerPoint slide show.
+	Ppsx = ooxml("application/vnd.openxmlformats-officedocument.presentationml.slideshow.main+xml")
+	// Ppsm matches a Microsoft PowerPoint macro-enabled slide show.
+	Ppsm = ooxml("application/vnd.ms-powerpoint.slideshow.macroEnabled.main+xml")
+	// Vsdx matches a Microsoft Visio drawing.
+	Vsdx = ooxml("application/vnd.ms-visio.drawing.main+xml")
+)
+
+// ooxmlMainTypes are the content types of the main parts of the OOXML
+// packages, as listed in [Content_Types].xml.
+var ooxmlMainTypes = []string{
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml",
+	"application/vnd.ms-excel.sheet.macroEnabled.main+xml",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.template.main+xml",
+	"application/vnd.ms-excel.template.macroEnabled.main+xml",
+	"application/vnd.ms-excel.sheet.binary.macroEnabled.main",
+	"application/vnd.ms-excel.addin.macroEnabled.main+xml",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml",
+	"application/vnd.ms-word.document.macroEnabled.main+xml",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.template.main+xml",
+	"application/vnd.ms-word.template.macroEnabledTemplate.main+xml",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation.main+xml",
+	"application/vnd.ms-powerpoint.presentation.macroEnabled.main+xml",
+	"application/vnd.openxmlformats-officedocument.presentationml.template.main+xml",
+	"application/vnd.openxmlformats-officedocument.presentationml.slideshow.main+xml",
+	"application/vnd.ms-powerpoint.slideshow.macroEnabled.main+xml",
+	"application/vnd.ms-visio.drawing.main+xml",
 }
 
-// Docx matches a Microsoft Word 2007 file.
-func Docx(raw []byte, limit uint32) bool {
-	return zipContains(raw, docxSigFiles...)
+// ooxml returns a Detector for the OOXML package whose main part has the
+// content type mainType. When the content type of the main part cannot be
+// read from [Content_Types].xml, the package is recognized by any of the
+// paths in sigFiles.
+//
+// https://www.ecma-international.org/publications-and-standards/standards/ecma-376/
+func ooxml(mainType string, sigFiles ...[]byte) Detector {
+	return func(raw []byte, limit uint32) bool {
+		if main := ooxmlMainType(raw); main != "" {
+			return main == mainType
+		}
+		return zipContains(raw, sigFiles...)
+	}
 }
 
-// Pptx matches a Microsoft PowerPoint 2007 file.
-func Pptx(raw []byte, limit uint32) bool {
-	return zipContains(raw, pptxSigFiles...)
+// ooxmlMainType returns the content type of the main part of the OOXML
+// package in, or "" when [Content_Types].xml does not list a known one.
+func ooxmlMainType(in []byte) string {
+	s := sharedOf(in)
+	if s == nil {
+		return readOOXMLMainType(in)
+	}
+	z := &s.zip
+	z.ooxmlOnce.Do(func() {
+		z.ooxmlMain = readOOXMLMainType(in)
+	})
+	return z.ooxmlMain
+}
+
+// readOOXMLMainType is ooxmlMainType for inputs which are not shared.
+func readOOXMLMainType(in []byte) string {
+	types, ok := zipFileContent(in, []byte("[Content_Types].xml"), zipMaxContent)
+	if !ok {
+		return ""
+	}
+	// Content types are case insensitive.
+	types = bytes.ToLower(types)
+	for _, t := range ooxmlMainTypes {
+		i := bytes.Index(types, []byte(strings.ToLower(t)))
+		if i < 1 {
+			continue
+		}
+		end := i + len(t)
+		if q := types[i-1]; (q == '"' || q == '\'') && end < len(types) && types[end] == q {
+			return t
+		}
+	}
+	return ""
+}
+
+// Oxps matches an OpenXPS document. OpenXPS and Microsoft XPS documents
+// share content types, and are told apart by the relationship to their
+// fixed document sequence.
+//
+// https://www.ecma-international.org/publications-and-standards/standards/ecma-388/
+func Oxps(raw []byte, limit uint32) bool {
+	rels, ok := zipFileContent(raw, []byte("_rels/.rels"), zipMaxContent)
+	return ok && bytes.Contains(rels, []byte("http://schemas.openxps.org/oxps/v1.0/fixedrepresentation"))
 }
 
 // Ole matches an Open Linking and Embedding file.
 //
 // https://en.wikipedia.org/wiki/Object_Linking_and_Embedding
 func Ole(raw []byte, limit uint32) bool {
-	return bytes.HasPrefix(raw, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1})
+	return bytes.HasPrefix(raw, oleSig)
+}
+
+// EncryptedOOXML matches an OOXML document encrypted with a password, which
+// is stored in a compound file as the EncryptedPackage stream, next to the
+// EncryptionInfo stream describing the encryption.
+// https://learn.microsoft.com/en-us/openspecs/office_file_formats/ms-offcrypto/3c34d72a-1a61-4b52-a893-196f9157f083
+func EncryptedOOXML(raw []byte, limit uint32) bool {
+	dir, complete := cfbDirectory(raw)
+	if dir.has("EncryptionInfo") && dir.has("EncryptedPackage") {
+		return true
+	}
+	// Parts of the directory can be read even when it is cut short.
+	return !complete && bytes.Contains(raw, []byte(
+		"E\x00n\x00c\x00r\x00y\x00p\x00t\x00e\x00d\x00P\x00a\x00c\x00k\x00a\x00g\x00e\x00"))
 }
 
 // Aaf matches an Advanced Authoring Format file.
@@ -80,6 +196,9 @@ func Aaf(raw []byte, limit uint32) bool {
 // Doc matches a Microsoft Word 97-2003 file.
 // See: https://github.com/decalage2/oletools/blob/412ee36ae45e70f42123e835871bac956d958461/oletools/common/clsid.py
 func Doc(raw []byte, _ uint32) bool {
+	if dir, _ := cfbDirectory(raw); dir.has("WordDocument") {
+		return true
+	}
 	clsids := [][]byte{
 		// Microsoft Word 97-2003 Document (Word.Document.8)
 		{0x06, 0x09, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46},
@@ -100,6 +219,10 @@ func Doc(raw []byte, _ uint32) bool {
 
 // Ppt matches a Microsoft PowerPoint 97-2003 file or a PowerPoint 95 presentation.
 func Ppt(raw []byte, limit uint32) bool {
+	dir, complete := cfbDirectory(raw)
+	if dir.has("PowerPoint Document") {
+		return true
+	}
 	// Root CLSID test is the safest way to detect identify OLE, however, the format
 	// often places the root CLSID at the end of the file.
 	if matchOleClsid(raw, []byte{
@@ -112,8 +235,9 @@ func Ppt(raw []byte, limit uint32) bool {
 		return true
 	}
 
+	// The guesses below are only needed when the directory is cut short.
 	lin := len(raw)
-	if lin < 520 {
+	if complete || lin < 520 {
 		return false
 	}
 	pptSubHeaders := [][]byte{
@@ -138,6 +262,11 @@ func Ppt(raw []byte, limit uint32) bool {
 
 // Xls matches a Microsoft Excel 97-2003 file.
 func Xls(raw []byte, limit uint32) bool {
+	dir, complete := cfbDirectory(raw)
+	// Excel 5.0 and 95 workbooks have a Book stream.
+	if dir.has("Workbook") || dir.has("Book") {
+		return true
+	}
 	// Root CLSID test is the safest way to detect identify OLE, however, the format
 	// often places the root CLSID at the end of the file.
 	if matchOleClsid(raw, []byte{
@@ -148,8 +277,9 @@ func Xls(raw []byte, limit uint32) bool {
 		return true
 	}
 
+	// The guesses below are only needed when the directory is cut short.
 	lin := len(raw)
-	if lin < 520 {
+	if complete || lin < 520 {
 		return false
 	}
 	xlsSubHeaders := [][]byte{
@@ -173,6 +303,9 @@ func Xls(raw []byte, limit uint32) bool {
 
 // Pub matches a Microsoft Publisher file.
 func Pub(raw []byte, limit uint32) bool {
+	if dir, _ := cfbDirectory(raw); dir.has("Quill") {
+		return true
+	}
 	return matchOleClsid(raw, []byte{
 		0x01, 0x12, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00,
 		0x00, 0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46,
@@ -180,13 +313,28 @@ func Pub(raw []byte, limit uint32) bool {
 }
 
 // Msg matches a Microsoft Outlook email file.
+// https://learn.microsoft.com/en-us/openspecs/exchange_server_protocols/ms-oxmsg/b046868c-9fbf-41ae-9ffb-8de2bd4eec82
 func Msg(raw []byte, limit uint32) bool {
+	// Properties are stored in streams named __substg1.0_ followed by
+	// their tag.
+	if dir, _ := cfbDirectory(raw); dir.hasPrefix(cfbStream, "__substg1.0_") {
+		return true
+	}
 	return matchOleClsid(raw, []byte{
 		0x0B, 0x0D, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00,
 		0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46,
 	})
 }
 
+// Oft matches a Microsoft Outlook item template, which is an Outlook message
+// with a different root CLSID.
+func Oft(raw []byte, limit uint32) bool {
+	return matchOleClsid(raw, []byte{
+		0x46, 0xF0, 0x06, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46,
+	})
+}
+
 // Msi matches a Microsoft Windows Installer file.
 // http://fileformats.archiveteam.org/wiki/Microsoft_Compound_File
 func Msi(raw []byte, limit uint32) bool {
@@ -196,6 +344,26 @@ func Msi(raw []byte, limit uint32) bool {
 	})
 }
 
+// Vsd matches a Microsoft Visio 2003-2010 drawing.
+func Vsd(raw []byte, limit uint32) bool {
+	dir, _ := cfbDirectory(raw)
+	return dir.has("VisioDocument")
+}
+
+// Wps matches a Microsoft Works word processor document.
+func Wps(raw []byte, limit uint32) bool {
+	dir, _ := cfbDirectory(raw)
+	return dir.has("MatOST")
+}
+
+// Mpp matches a Microsoft Project file. The project data is in a storage
+// whose name is 3 spaces followed by the file format version, such as
+// "   114" for Project 2010 and later.
+func Mpp(raw []byte, limit uint32) bool {
+	dir, _ := cfbDirectory(raw)
+	return dir.hasPrefix(cfbStorage, "   1")
+}
+
 // Helper to match by a specific CLSID of a compound file.
 //
 // http://fileformats.archiveteam.org/wiki/Microsoft_Compound_File
@@ -223,3 +391,106 @@ func matchOleClsid(in []byte, clsid []byte) bool {
 
 	return bytes.HasPrefix(in[clsidOffset:], clsid)
 }
+
+var (
+	// ooxmlMacroTypes are the content types of the parts holding macros:
+	// VBA projects and Excel 4.0 macro sheets, in XML or binary form.
+	ooxmlMacroTypes = [][]byte{
+		[]byte("application/vnd.ms-office.vbaproject"),
+		[]byte("application/vnd.ms-excel.macrosheet"),
+		[]byte("application/vnd.ms-excel.intlmacrosheet"),
+	}
+	ooxmlMacroFiles = [][]byte{
+		[]byte("word/vbaProject.bin"),
+		[]byte("xl/vbaProject.bin"),
+		[]byte("ppt/vbaProject.bin"),
+		[]byte("visio/vbaProject.bin"),
+		[]byte("xl/macrosheets/"),
+	}
+)
+
+// OOXMLMacros returns true if the OOXML package in holds a VBA project or
+// Excel 4.0 macro sheets, whatever the content type of its main part.
+func OOXMLMacros(in []byte) bool {
+	if types, ok := zipFileContent(in, []byte("[Content_Types].xml"), zipMaxContent); ok {
+		types = bytes.ToLower(types)
+		for _, t := range ooxmlMacroTypes {
+			if bytes.Contains(types, t) {
+				return true
+			}
+		}
+	}
+	return zipContains(in, ooxmlMacroFiles...)
+}
+
+// oleMaxStream caps the bytes of the streams read to look for macros.
+const oleMaxStream = 1 << 20
+
+// OLEMacros returns true if the compound file in holds a VBA project or
+// Excel 4.0 macro sheets. VBA projects are stored in the Macros storage of
+// Word documents, the _VBA_PROJECT_CUR storage of Excel workbooks and inside
+// the PowerPoint Document stream of presentations.
+func OLEMacros(in []byte) bool {
+	dir, _ := cfbDirectory(in)
+	if dir.has("Macros") || dir.has("_VBA_PROJECT_CUR") {
+		return true
+	}
+	if dir.has("Workbook") || dir.has("Book") {
+		wb := dir.stream("Workbook", oleMaxStream)
+		if wb == nil {
+			wb = dir.stream("Book", oleMaxStream)
+		}
+		return xlsMacroSheets(wb)
+	}
+	if dir.has("PowerPoint Document") {
+		return pptMacros(dir.stream("PowerPoint Document", oleMaxStream))
+	}
+	return false
+}
+
+// xlsMacroSheets returns true if the globals substream at the start of the
+// workbook stream wb lists an Excel 4.0 macro sheet or an Excel 5.0 VBA
+// module sheet. See the BoundSheet8 record in [MS-XLS].
+func xlsMacroSheets(wb []byte) bool {
+	const (
+		eof        = 0x000A
+		boundSheet = 0x0085
+	)
+	// Records are their type and size, followed by their data.
+	for len(wb) >= 4 {
+		typ := binary.LittleEndian.Uint16(wb)
+		size := int(binary.LittleEndian.Uint16(wb[2:]))
+		wb = wb[4:]
+		if size > len(wb) || typ == eof {
+			return false
+		}
+		// The type of the sheet is the 6th byte of BoundSheet8.
+		if typ == boundSheet && size >= 6 && (wb[5] == 0x01 || wb[5] == 0x06) {
+			return true
+		}
+		wb = wb[size:]
+	}
+	return false
+}
+
+// pptMacros returns true if the PowerPoint Document stream doc holds a
+// VBAInfoContainer whose VBAInfoAtom has the fHasMacros field set, as
+// described in [MS-PPT].
+func pptMacros(doc []byte) bool {
+	// The headers of the container and of the atom, followed by the
+	// persistIdRef field.
+	vbaInfo := []byte{
+		0x0F, 0x00, 0xFF, 0x03, 0x14, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x00, 0x04, 0x0C, 0x00, 0x00, 0x00,
+	}
+	for {
+		i := bytes.Index(doc, vbaInfo)
+		if i == -1 || i+len(vbaInfo)+8 > len(doc) {
+			return false
+		}
+		doc = doc[i+len(vbaInfo):]
+		if binary.LittleEndian.Uint32(doc[4:]) == 1 {
+			return true
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package magic
+
+import "sync"
+
+// sharedInput holds what was parsed from an input so far, for the detectors
+// of the formats based on the same container to parse it only once.
+type sharedInput struct {
+	refs int
+	zip  sharedZip
+	cfb  sharedCFB
+}
+
+// sharedKey identifies an input by its first byte and its length.
+type sharedKey struct {
+	first *byte
+	n     int
+}
+
+var shared = struct {
+	sync.RWMutex
+	m map[sharedKey]*sharedInput
+}{m: map[sharedKey]*sharedInput{}}
+
+// Share makes the detectors share what they parse from in until done is
+// called. in must not be modified in the meantime. Detectors called outside
+// of Share parse their input each time.
+func Share(in []byte) (done func()) {
+	if len(in) == 0 {
+		return func() {}
+	}
+	k := sharedKey{&in[0], len(in)}
+	shared.Lock()
+	s := shared.m[k]
+	if s == nil {
+		s = &sharedInput{}
+		shared.m[k] = s
+	}
+	s.refs++
+	shared.Unlock()
+
+	return func() {
+		shared.Lock()
+		if s.refs--; s.refs == 0 {
+			delete(shared.m, k)
+		}
+		shared.Unlock()
+	}
+}
+
+// sharedOf returns what was parsed from in so far, or nil when in is not
+// shared.
+func sharedOf(in []byte) *sharedInput {
+	if len(in) == 0 {
+		return nil
+	}
+	shared.RLock()
+	defer shared.RUnlock()
+	return shared.m[sharedKey{&in[0], len(in)}]
+}
@@ -0,0 +1,63 @@
+package magic
+
+import "testing"
+
+func TestShare(t *testing.T) {
+	docx := testZip(t,
+		zipFile{name: "[Content_Types].xml", content: []byte(`<Types><Override PartName="/word/document.xml" ` +
+			`ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`)},
+		zipFile{name: "word/document.xml", content: []byte("<document/>")},
+	)
+	odt := testZip(t,
+		zipFile{name: "META-INF/manifest.xml", content: []byte("<manifest/>")},
+		zipFile{name: "mimetype", content: []byte("application/vnd.oasis.opendocument.text"), store: true},
+	)
+	// The same buffer holds both archives in turn, followed by zeros.
+	buf := make([]byte, len(docx)+len(odt))
+
+	check := func(name string, detector Detector, want bool) {
+		t.Helper()
+		for i := 0; i < 2; i++ {
+			if got := detector(buf, 0); got != want {
+				t.Errorf("%s, call %d: got %t, want %t", name, i, got, want)
+			}
+		}
+	}
+	copy(buf, docx)
+	done := Share(buf)
+	check("docx", Docx, true)
+	check("docx is not xlsx", Xlsx, false)
+	check("docx is not odt", Odt, false)
+	done()
+
+	copy(buf, odt)
+	for i := len(odt); i < len(buf); i++ {
+		buf[i] = 0
+	}
+	done = Share(buf)
+	check("odt", Odt, true)
+	check("odt is not docx", Docx, false)
+	done()
+
+	doc := testCFB(nil, []string{"WordDocument"}, nil)
+	xls := testCFB(nil, []string{"Workbook"}, nil)
+	buf = make([]byte, len(doc)+len(xls))
+	copy(buf, doc)
+	done = Share(buf)
+	check("doc", Doc, true)
+	check("doc is not xls", Xls, false)
+	done()
+
+	copy(buf, xls)
+	for i := len(xls); i < len(buf); i++ {
+		buf[i] = 0
+	}
+	done = Share(buf)
+	check("xls", Xls, true)
+	check("xls is not doc", Doc, false)
+	done()
+
+	if s := sharedOf(buf); s != nil {
+		t.Errorf("input still shared after done")
+	}
+}
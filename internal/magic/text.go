@@ -119,6 +119,21 @@ var (
 		[]byte("/usr/local/bin/wish"),
 		[]byte("/usr/bin/env wish"),
 	)
+	// Shell matches a shell script.
+	Shell = shebang(
+		[]byte("/bin/sh"),
+		[]byte("/bin/bash"),
+		[]byte("/usr/bin/bash"),
+		[]byte("/usr/bin/env sh"),
+		[]byte("/usr/bin/env bash"),
+		[]byte("/bin/dash"),
+		[]byte("/bin/ksh"),
+		[]byte("/usr/bin/ksh"),
+		[]byte("/usr/bin/env ksh"),
+		[]byte("/bin/zsh"),
+		[]byte("/usr/bin/zsh"),
+		[]byte("/usr/bin/env zsh"),
+	)
 	// Rtf matches a Rich Text Format file.
 	Rtf = prefix([]byte("{\\rtf"))
 )
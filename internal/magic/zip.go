@@ -2,34 +2,51 @@ package magic
 
 import (
 	"bytes"
+	"compress/flate"
 	"encoding/binary"
+	"io"
+	"sync"
 )
 
 var (
 	// Odt matches an OpenDocument Text file.
-	Odt = offset([]byte("mimetypeapplication/vnd.oasis.opendocument.text"), 30)
+	Odt = zipMimetype("application/vnd.oasis.opendocument.text")
 	// Ott matches an OpenDocument Text Template file.
-	Ott = offset([]byte("mimetypeapplication/vnd.oasis.opendocument.text-template"), 30)
+	Ott = zipMimetype("application/vnd.oasis.opendocument.text-template")
 	// Ods matches an OpenDocument Spreadsheet file.
-	Ods = offset([]byte("mimetypeapplication/vnd.oasis.opendocument.spreadsheet"), 30)
+	Ods = zipMimetype("application/vnd.oasis.opendocument.spreadsheet")
 	// Ots matches an OpenDocument Spreadsheet Template file.
-	Ots = offset([]byte("mimetypeapplication/vnd.oasis.opendocument.spreadsheet-template"), 30)
+	Ots = zipMimetype("application/vnd.oasis.opendocument.spreadsheet-template")
 	// Odp matches an OpenDocument Presentation file.
-	Odp = offset([]byte("mimetypeapplication/vnd.oasis.opendocument.presentation"), 30)
+	Odp = zipMimetype("application/vnd.oasis.opendocument.presentation")
 	// Otp matches an OpenDocument Presentation Template file.
-	Otp = offset([]byte("mimetypeapplication/vnd.oasis.opendocument.presentation-template"), 30)
+	Otp = zipMimetype("application/vnd.oasis.opendocument.presentation-template")
 	// Odg matches an OpenDocument Drawing file.
-	Odg = offset([]byte("mimetypeapplication/vnd.oasis.opendocument.graphics"), 30)
+	Odg = zipMimetype("application/vnd.oasis.opendocument.graphics")
 	// Otg matches an OpenDocument Drawing Template file.
-	Otg = offset([]byte("mimetypeapplication/vnd.oasis.opendocument.graphics-template"), 30)
+	Otg = zipMimetype("application/vnd.oasis.opendocument.graphics-template")
 	// Odf matches an OpenDocument Formula file.
-	Odf = offset([]byte("mimetypeapplication/vnd.oasis.opendocument.formula"), 30)
+	Odf = zipMimetype("application/vnd.oasis.opendocument.formula")
 	// Odc matches an OpenDocument Chart file.
-	Odc = offset([]byte("mimetypeapplication/vnd.oasis.opendocument.chart"), 30)
+	Odc = zipMimetype("application/vnd.oasis.opendocument.chart")
 	// Epub matches an EPUB file.
-	Epub = offset([]byte("mimetypeapplication/epub+zip"), 30)
+	Epub = zipMimetype("application/epub+zip")
+	// Odb matches an OpenDocument Database file.
+	Odb = zipMimetype("application/vnd.oasis.opendocument.base")
+	// Odm matches an OpenDocument Master Document file.
+	Odm = zipMimetype("application/vnd.oasis.opendocument.text-master")
+	// Oth matches an OpenDocument HTML Template file.
+	Oth = zipMimetype("application/vnd.oasis.opendocument.text-web")
+	// Odi matches an OpenDocument Image file.
+	Odi = zipMimetype("application/vnd.oasis.opendocument.image")
 	// Sxc matches an OpenOffice Spreadsheet file.
-	Sxc = offset([]byte("mimetypeapplication/vnd.sun.xml.calc"), 30)
+	Sxc = zipMimetype("application/vnd.sun.xml.calc")
+	// Sxw matches an OpenOffice Text file.
+	Sxw = zipMimetype("application/vnd.sun.xml.writer")
+	// Sxi matches an OpenOffice Presentation file.
+	Sxi = zipMimetype("application/vnd.sun.xml.impress")
+	// Sxd matches an OpenOffice Drawing file.
+	Sxd = zipMimetype("application/vnd.sun.xml.draw")
 )
 
 // Zip matches a zip archive.
@@ -45,24 +62,371 @@ func Jar(raw []byte, limit uint32) bool {
 	return zipContains(raw, []byte("META-INF/MANIFEST.MF"))
 }
 
+// zipMimetype returns a Detector for the formats which start with a stored
+// file named mimetype holding the MIME type, such as OpenDocument and EPUB.
+// The file is expected first, but it is also looked up in the central
+// directory when the whole archive is available. Documents without a mimetype
+// file are recognized by the media type of the root entry of their manifest.
+func zipMimetype(mime string) Detector {
+	sig := []byte(mime)
+	first := offset(append([]byte("mimetype"), sig...), 30)
+	return func(raw []byte, limit uint32) bool {
+		if first(raw, limit) {
+			return true
+		}
+		if content, ok := zipFileContent(raw, []byte("mimetype"), len(sig)); ok {
+			return bytes.HasPrefix(content, sig)
+		}
+		return bytes.HasPrefix(odfManifestType(raw), sig)
+	}
+}
+
+// odfManifestType returns the media type of the root entry of the
+// META-INF/manifest.xml file of the OpenDocument archive in.
+// https://docs.oasis-open.org/office/OpenDocument/v1.3/os/part2-packages/OpenDocument-v1.3-os-part2-packages.html
+func odfManifestType(in []byte) []byte {
+	manifest, ok := zipFileContent(in, []byte("META-INF/manifest.xml"), zipMaxContent)
+	if !ok {
+		return nil
+	}
+	for {
+		i := bytes.Index(manifest, []byte("file-entry"))
+		if i == -1 {
+			return nil
+		}
+		manifest = manifest[i:]
+		end := bytes.IndexByte(manifest, '>')
+		if end == -1 {
+			return nil
+		}
+		entry := manifest[:end]
+		manifest = manifest[end:]
+		if bytes.Equal(xmlAttr(entry, "full-path"), []byte("/")) {
+			return xmlAttr(entry, "media-type")
+		}
+	}
+}
+
+// xmlAttr returns the value of the attribute named name, with any namespace
+// prefix, from the start tag tag.
+func xmlAttr(tag []byte, name string) []byte {
+	for {
+		i := bytes.Index(tag, []byte(name+"="))
+		if i == -1 {
+			return nil
+		}
+		prev := byte(' ')
+		if i > 0 {
+			prev = tag[i-1]
+		}
+		tag = tag[i+len(name)+1:]
+		if len(tag) == 0 || tag[0] != '"' && tag[0] != '\'' {
+			continue
+		}
+		if prev != ' ' && prev != ':' && prev != '\t' && prev != '\n' && prev != '\r' {
+			continue
+		}
+		end := bytes.IndexByte(tag[1:], tag[0])
+		if end == -1 {
+			return nil
+		}
+		return tag[1 : end+1]
+	}
+}
+
+// Signatures of zip records.
+var (
+	zipLocalSig   = []byte("PK\003\004")
+	zipCentralSig = []byte("PK\001\002")
+	zipEOCDSig    = []byte("PK\005\006")
+	zip64EOCDSig  = []byte("PK\006\006")
+	zip64LocSig   = []byte("PK\006\007")
+)
+
+const (
+	zipEOCDLen       = 22
+	zip64EOCDLen     = 56
+	zip64LocLen      = 20
+	zipCentralLen    = 46
+	zipLocalLen      = 30
+	zipMaxCommentLen = 0xFFFF
+)
+
+// zipDirectoryBounds locates the central directory of the zip archive ending
+// in, from its End Of Central Directory record. The start of the directory is
+// negative when in does not hold all of it. The offset of the directory
+// recorded in the archive is not used, so data prepended to the archive, as
+// in self-extracting executables, does not matter. base is the position in
+// in of the start of the archive, which local header offsets are relative to.
+// https://pkware.cachefly.net/webdocs/casestudies/APPNOTE.TXT
+func zipDirectoryBounds(in []byte) (start, end, base int, ok bool) {
+	// The record is followed by a comment of up to 64KiB.
+	from := len(in) - zipEOCDLen - zipMaxCommentLen
+	if from < 0 {
+		from = 0
+	}
+	// Most archives have no comment.
+	eocd := len(in) - zipEOCDLen
+	if eocd < 0 || !bytes.HasPrefix(in[eocd:], zipEOCDSig) ||
+		binary.LittleEndian.Uint16(in[eocd+20:]) != 0 {
+		eocd = zipLastEOCD(in[from:])
+		if eocd != -1 {
+			eocd += from
+		}
+	}
+	if eocd == -1 {
+		return 0, 0, 0, false
+	}
+
+	size := uint64(binary.LittleEndian.Uint32(in[eocd+12:]))
+	offset := uint64(binary.LittleEndian.Uint32(in[eocd+16:]))
+	end = eocd
+	if size == 0xFFFFFFFF || offset == 0xFFFFFFFF {
+		// ZIP64 archives have their own record, before its locator.
+		loc := eocd - zip64LocLen
+		rec := loc - zip64EOCDLen
+		if rec < 0 || !bytes.HasPrefix(in[loc:], zip64LocSig) {
+			return 0, 0, 0, false
+		}
+		// The record can have extensible data, which is seldom used.
+		if !bytes.HasPrefix(in[rec:], zip64EOCDSig) {
+			if rec = bytes.LastIndex(in[:loc], zip64EOCDSig); rec == -1 || loc-rec < zip64EOCDLen {
+				return 0, 0, 0, false
+			}
+		}
+		size = binary.LittleEndian.Uint64(in[rec+40:])
+		offset = binary.LittleEndian.Uint64(in[rec+48:])
+		end = rec
+	}
+	// Sizes beyond 1TiB are bogus, and would overflow below.
+	if size > 1<<40 || offset > 1<<40 {
+		return 0, 0, 0, false
+	}
+	start = end - int(size)
+
+	return start, end, start - int(offset), true
+}
+
+// sharedZip holds the central directory and the files read from a shared zip
+// archive.
+type sharedZip struct {
+	once sync.Once
+	dir  []byte
+	base int
+	ok   bool
+
+	mu    sync.Mutex
+	files map[string]zipContent
+
+	ooxmlOnce sync.Once
+	ooxmlMain string
+}
+
+// zipContent is the content of a file read by zipFileContent.
+type zipContent struct {
+	content []byte
+	ok      bool
+}
+
+// zipLastEOCD returns the position of the last End Of Central Directory record
+// of in whose comment fits in in, or -1. Searching forward is much faster than
+// searching backward with bytes.LastIndex.
+func zipLastEOCD(in []byte) int {
+	last := -1
+	for i := 0; ; i++ {
+		j := bytes.Index(in[i:], zipEOCDSig)
+		if j == -1 {
+			return last
+		}
+		i += j
+		if i+zipEOCDLen <= len(in) &&
+			i+zipEOCDLen+int(binary.LittleEndian.Uint16(in[i+20:])) <= len(in) {
+			last = i
+		}
+	}
+}
+
+// zipDirectory returns the central directory of the zip archive ending in,
+// and the position of the start of the archive in in.
+func zipDirectory(in []byte) (dir []byte, base int, ok bool) {
+	s := sharedOf(in)
+	if s == nil {
+		return findZipDirectory(in)
+	}
+	z := &s.zip
+	z.once.Do(func() {
+		z.dir, z.base, z.ok = findZipDirectory(in)
+	})
+	return z.dir, z.base, z.ok
+}
+
+// findZipDirectory is zipDirectory for inputs which are not shared.
+func findZipDirectory(in []byte) (dir []byte, base int, ok bool) {
+	start, end, base, ok := zipDirectoryBounds(in)
+	if !ok || start < 0 || !bytes.HasPrefix(in[start:end], zipCentralSig) {
+		return nil, 0, false
+	}
+	return in[start:end], base, true
+}
+
+// ZipTailLen returns the number of bytes at the end of a zip archive which
+// hold its central directory, given the last bytes of the archive in tail.
+// It returns 0 when tail does not hold the end of a zip archive.
+func ZipTailLen(tail []byte) int {
+	start, _, _, ok := zipDirectoryBounds(tail)
+	if !ok {
+		return 0
+	}
+	return len(tail) - start
+}
+
+// zipMaxContent caps the decompressed size of the files read from zip archives.
+const zipMaxContent = 64 << 10
+
+// zipFileContent returns the start of the content of the file named name in
+// the zip archive in, up to max bytes. The file is looked up in the central
+// directory when in holds the whole archive, and in the local file headers
+// otherwise. Only stored and deflated files can be read; a file cut short by
+// the end of in is read as far as possible.
+func zipFileContent(in, name []byte, max int) ([]byte, bool) {
+	s := sharedOf(in)
+	if s == nil || max > zipMaxContent {
+		return readZipFile(in, name, max)
+	}
+	// Shared files are read up to zipMaxContent, whatever max.
+	z := &s.zip
+	z.mu.Lock()
+	f, read := z.files[string(name)]
+	if !read {
+		f.content, f.ok = readZipFile(in, name, zipMaxContent)
+		if z.files == nil {
+			z.files = map[string]zipContent{}
+		}
+		z.files[string(name)] = f
+	}
+	z.mu.Unlock()
+	if len(f.content) > max {
+		f.content = f.content[:max]
+	}
+	return f.content, f.ok
+}
+
+// readZipFile is zipFileContent for inputs which are not shared.
+func readZipFile(in, name []byte, max int) ([]byte, bool) {
+	if dir, base, ok := zipDirectory(in); ok {
+		t := zipTokenizer{in: dir, central: true}
+		for tok := t.next(); len(tok) != 0; tok = t.next() {
+			if !bytes.Equal(tok, name) {
+				continue
+			}
+			h := dir[t.header:]
+			size := int64(binary.LittleEndian.Uint32(h[20:]))
+			if size == 0xFFFFFFFF {
+				size = -1
+			}
+			local := base + int(binary.LittleEndian.Uint32(h[42:]))
+			if local < 0 || local > len(in) {
+				return nil, false
+			}
+			return zipLocalContent(in[local:], size, max)
+		}
+		return nil, false
+	}
+
+	t := zipTokenizer{in: in}
+	for tok := t.next(); len(tok) != 0; tok = t.next() {
+		if bytes.Equal(tok, name) {
+			return zipLocalContent(in[t.header:], -1, max)
+		}
+	}
+	return nil, false
+}
+
+// zipLocalContent returns the start of the content of the file whose local
+// header starts l. size is the compressed size from the central directory, or
+// -1 to take it from the local header.
+func zipLocalContent(l []byte, size int64, max int) ([]byte, bool) {
+	if len(l) < zipLocalLen || !bytes.HasPrefix(l, zipLocalSig) {
+		return nil, false
+	}
+	flags := binary.LittleEndian.Uint16(l[6:])
+	method := binary.LittleEndian.Uint16(l[8:])
+	// Encrypted content cannot be read.
+	if flags&0x1 != 0 {
+		return nil, false
+	}
+	if size == -1 {
+		size = int64(binary.LittleEndian.Uint32(l[18:]))
+		// Sizes are in the data descriptor, after the content, when bit 3
+		// is set, or in the ZIP64 extra field.
+		if flags&0x8 != 0 || size == 0xFFFFFFFF {
+			size = -1
+		}
+	}
+	data := zipLocalLen + int(binary.LittleEndian.Uint16(l[26:])) +
+		int(binary.LittleEndian.Uint16(l[28:]))
+	if data > len(l) {
+		return nil, false
+	}
+	l = l[data:]
+	if size >= 0 && size < int64(len(l)) {
+		l = l[:size]
+	}
+
+	switch method {
+	case 0: // stored
+		if size == -1 {
+			return nil, false
+		}
+		if len(l) > max {
+			l = l[:max]
+		}
+		return l, true
+	case 8: // deflated
+		// Errors are expected for content cut short; whatever was inflated
+		// before the error is still usable.
+		out, _ := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(l)), int64(max)))
+		return out, len(out) > 0
+	}
+	return nil, false
+}
+
 // zipTokenizer holds the source zip file and scanned index.
 type zipTokenizer struct {
 	in []byte
 	i  int // current index
+	// central is true when in holds the central directory, whose headers
+	// are read one after the other, instead of the start of the archive,
+	// which is scanned for local file headers.
+	central bool
+	// header is the index of the header of the last file name.
+	header int
+}
+
+// newZipTokenizer returns a tokenizer of the names of the files of the zip
+// archive in, read from the central directory when in holds the whole archive.
+// Unlike local file headers, the central directory lists every file, even when
+// preceded by large files, data descriptors or data prepended to the archive.
+func newZipTokenizer(in []byte) *zipTokenizer {
+	if dir, _, ok := zipDirectory(in); ok {
+		return &zipTokenizer{in: dir, central: true}
+	}
+	return &zipTokenizer{in: in}
 }
 
 // next returns the next file name from the zip headers.
 // https://web.archive.org/web/20191129114319/https://users.cs.jmu.edu/buchhofp/forensics/formats/pkzip.html
 func (t *zipTokenizer) next() (fileName []byte) {
+	if t.central {
+		return t.nextCentral()
+	}
 	if t.i > len(t.in) {
 		return
 	}
 	in := t.in[t.i:]
-	// pkSig is the signature of the zip local file header.
-	pkSig := []byte("PK\003\004")
-	pkIndex := bytes.Index(in, pkSig)
+	pkIndex := bytes.Index(in, zipLocalSig)
 	// 30 is the offset of the file name in the header.
-	fNameOffset := pkIndex + 30
+	fNameOffset := pkIndex + zipLocalLen
 	// end if signature not found or file name offset outside of file.
 	if pkIndex == -1 || fNameOffset > len(in) {
 		return
@@ -72,13 +436,51 @@ func (t *zipTokenizer) next() (fileName []byte) {
 	if fNameLen <= 0 || fNameOffset+fNameLen > len(in) {
 		return
 	}
+	t.header = t.i + pkIndex
 	t.i += fNameOffset + fNameLen
 	return in[fNameOffset : fNameOffset+fNameLen]
 }
 
+// nextCentral returns the file name from the next central directory header.
+func (t *zipTokenizer) nextCentral() []byte {
+	if t.i+zipCentralLen > len(t.in) || !bytes.HasPrefix(t.in[t.i:], zipCentralSig) {
+		return nil
+	}
+	in := t.in[t.i:]
+	nameLen := int(binary.LittleEndian.Uint16(in[28:]))
+	extraLen := int(binary.LittleEndian.Uint16(in[30:]))
+	commentLen := int(binary.LittleEndian.Uint16(in[32:]))
+	if nameLen == 0 || zipCentralLen+nameLen > len(in) {
+		return nil
+	}
+	t.header = t.i
+	t.i += zipCentralLen + nameLen + extraLen + commentLen
+	return in[zipCentralLen : zipCentralLen+nameLen]
+}
+
+// ZipEncrypted returns true if any file of the zip archive in has the
+// encryption flag set.
+func ZipEncrypted(in []byte) bool {
+	t := newZipTokenizer(in)
+	for tok := t.next(); len(tok) != 0; tok = t.next() {
+		if t.flags()&0x1 != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// flags returns the general purpose flags of the last file name.
+func (t *zipTokenizer) flags() uint16 {
+	if t.central {
+		return binary.LittleEndian.Uint16(t.in[t.header+8:])
+	}
+	return binary.LittleEndian.Uint16(t.in[t.header+6:])
+}
+
 // zipContains returns true if the zip file headers from in contain any of the paths.
 func zipContains(in []byte, paths ...[]byte) bool {
-	t := zipTokenizer{in: in}
+	t := newZipTokenizer(in)
 	for tok := t.next(); len(tok) != 0; tok = t.next() {
 		for p := range paths {
 			if bytes.HasPrefix(tok, paths[p]) {
@@ -0,0 +1,263 @@
+package magic
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+type zipFile struct {
+	name    string
+	content []byte
+	store   bool
+}
+
+func testZip(t *testing.T, files ...zipFile) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, f := range files {
+		h := &zip.FileHeader{Name: f.name, Method: zip.Deflate}
+		if f.store {
+			h.Method = zip.Store
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// toZip64 rewrites the end of central directory record of z, without a
+// comment, as the records of a ZIP64 archive.
+func toZip64(z []byte) []byte {
+	eocd := z[len(z)-22:]
+	entries := binary.LittleEndian.Uint16(eocd[10:])
+	size := binary.LittleEndian.Uint32(eocd[12:])
+	offset := binary.LittleEndian.Uint32(eocd[16:])
+	out := append([]byte(nil), z[:len(z)-22]...)
+
+	rec := make([]byte, 56)
+	copy(rec, "PK\x06\x06")
+	binary.LittleEndian.PutUint64(rec[4:], 44)
+	binary.LittleEndian.PutUint64(rec[24:], uint64(entries))
+	binary.LittleEndian.PutUint64(rec[32:], uint64(entries))
+	binary.LittleEndian.PutUint64(rec[40:], uint64(size))
+	binary.LittleEndian.PutUint64(rec[48:], uint64(offset))
+	loc := make([]byte, 20)
+	copy(loc, "PK\x06\x07")
+	binary.LittleEndian.PutUint64(loc[8:], uint64(len(out)))
+	binary.LittleEndian.PutUint32(loc[16:], 1)
+	end := make([]byte, 22)
+	copy(end, "PK\x05\x06")
+	binary.LittleEndian.PutUint16(end[8:], 0xFFFF)
+	binary.LittleEndian.PutUint16(end[10:], 0xFFFF)
+	binary.LittleEndian.PutUint32(end[12:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(end[16:], 0xFFFFFFFF)
+
+	return append(append(append(out, rec...), loc...), end...)
+}
+
+func TestZipCentralDirectory(t *testing.T) {
+	random := make([]byte, 8000)
+	rand.New(rand.NewSource(1)).Read(random)
+	docx := testZip(t,
+		zipFile{name: "big.bin", content: random},
+		zipFile{name: "[Content_Types].xml", content: []byte("<Types/>")},
+		zipFile{name: "word/document.xml", content: []byte("<document/>")},
+	)
+	odt := testZip(t,
+		zipFile{name: "META-INF/manifest.xml", content: []byte("<manifest/>")},
+		zipFile{name: "mimetype", content: []byte("application/vnd.oasis.opendocument.text"), store: true},
+	)
+	ott := testZip(t,
+		zipFile{name: "content.xml", content: []byte("<content/>")},
+		zipFile{name: "mimetype", content: []byte("application/vnd.oasis.opendocument.text-template"), store: true},
+	)
+	withComment := append(docx[:len(docx)-2:len(docx)-2], 5, 0, 'h', 'e', 'l', 'l', 'o')
+	manifest := []byte(`<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0">` +
+		`<manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>` +
+		`<manifest:file-entry manifest:media-type='application/vnd.oasis.opendocument.text' manifest:full-path='/'/>` +
+		`</manifest:manifest>`)
+	manifestOdt := testZip(t,
+		zipFile{name: "META-INF/manifest.xml", content: manifest},
+		zipFile{name: "content.xml", content: []byte("<content/>")},
+	)
+
+	tcs := []struct {
+		name     string
+		in       []byte
+		detector Detector
+		want     bool
+	}{
+		{"docx after a large file", docx, Docx, true},
+		{"docx truncated", docx[:3072], Docx, false},
+		{"docx with prepended data", append(bytes.Repeat([]byte("MZ"), 500), docx...), Docx, true},
+		{"docx with comment", withComment, Docx, true},
+		{"docx zip64", toZip64(docx), Docx, true},
+		{"xlsx is not docx", docx, Xlsx, false},
+		{"odt with mimetype last", odt, Odt, true},
+		{"odt is not ods", odt, Ods, false},
+		{"ott is odt", ott, Odt, true},
+		{"ott", ott, Ott, true},
+		{"odt without mimetype", manifestOdt, Odt, true},
+		{"odt without mimetype is not ods", manifestOdt, Ods, false},
+		{"odt without mimetype from the local header", manifestOdt[:bytes.LastIndex(manifestOdt, zipLocalSig)], Odt, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.detector(tc.in, 0); got != tc.want {
+				t.Errorf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestZipTailLen(t *testing.T) {
+	random := make([]byte, 8000)
+	rand.New(rand.NewSource(1)).Read(random)
+	z := testZip(t,
+		zipFile{name: "big.bin", content: random},
+		zipFile{name: "[Content_Types].xml", content: []byte("<Types/>")},
+		zipFile{name: "word/document.xml", content: []byte("<document/>")},
+	)
+	for _, in := range [][]byte{z, toZip64(z)} {
+		n := ZipTailLen(in[len(in)-100:])
+		if n <= 100 || n >= len(in) {
+			t.Fatalf("got %d, want the length of the central directory and end records", n)
+		}
+		// The head and tail of the archive are enough for detection.
+		joined := append(in[:100:100], in[len(in)-n:]...)
+		if !Docx(joined, 0) {
+			t.Errorf("head and tail of the archive not detected as docx")
+		}
+	}
+	if n := ZipTailLen([]byte("not a zip archive")); n != 0 {
+		t.Errorf("got %d for a non zip input, want 0", n)
+	}
+}
+
+func TestOoxmlContentTypes(t *testing.T) {
+	types := func(mainType string) []byte {
+		return []byte(`<Types><Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/word/document.xml" ContentType="` + mainType + `"/></Types>`)
+	}
+	random := make([]byte, 8000)
+	rand.New(rand.NewSource(1)).Read(random)
+	docm := testZip(t,
+		zipFile{name: "[Content_Types].xml", content: types("application/vnd.ms-word.document.macroEnabled.main+xml")},
+		zipFile{name: "big.bin", content: random},
+		zipFile{name: "word/document.xml", content: []byte("<document/>")},
+	)
+	storedDotx := testZip(t,
+		zipFile{name: "[Content_Types].xml", store: true,
+			content: types("application/vnd.openxmlformats-officedocument.wordprocessingml.template.main+xml")},
+		zipFile{name: "word/document.xml", content: []byte("<document/>")},
+	)
+	lowerXlsm := testZip(t,
+		zipFile{name: "[Content_Types].xml", content: []byte(`<Types><Override PartName="/xl/workbook.xml" ` +
+			`ContentType='application/vnd.ms-excel.sheet.macroenabled.main+xml'/></Types>`)},
+	)
+	unknown := testZip(t,
+		zipFile{name: "[Content_Types].xml", content: types("application/xml")},
+		zipFile{name: "word/document.xml", content: []byte("<document/>")},
+	)
+	oxps := testZip(t,
+		zipFile{name: "_rels/.rels", content: []byte(`<Relationships><Relationship ` +
+			`Type="http://schemas.openxps.org/oxps/v1.0/fixedrepresentation" Target="/doc.fdseq"/></Relationships>`)},
+	)
+
+	tcs := []struct {
+		name     string
+		in       []byte
+		detector Detector
+		want     bool
+	}{
+		{"docm", docm, Docm, true},
+		{"docm is not docx", docm, Docx, false},
+		{"docm from the local header", docm[:3072], Docm, true},
+		{"stored dotx", storedDotx, Dotx, true},
+		{"stored dotx is not docx", storedDotx, Docx, false},
+		{"lower case xlsm", lowerXlsm, Xlsm, true},
+		{"unknown main type falls back to paths", unknown, Docx, true},
+		{"unknown main type", unknown, Docm, false},
+		{"oxps", oxps, Oxps, true},
+		{"docm is not oxps", docm, Oxps, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.detector(tc.in, 0); got != tc.want {
+				t.Errorf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOOXMLMacros(t *testing.T) {
+	types := func(extra string) []byte {
+		return []byte(`<Types><Override PartName="/xl/workbook.bin" ` +
+			`ContentType="application/vnd.ms-excel.sheet.binary.macroEnabled.main"/>` + extra + `</Types>`)
+	}
+	tcs := []struct {
+		name string
+		in   []byte
+		want bool
+	}{{
+		"vba project content type",
+		testZip(t, zipFile{name: "[Content_Types].xml",
+			content: types(`<Default Extension="bin" ContentType="application/vnd.ms-office.vbaProject"/>`)}),
+		true,
+	}, {
+		"binary macro sheet",
+		testZip(t, zipFile{name: "[Content_Types].xml",
+			content: types(`<Override PartName="/xl/macrosheets/sheet1.bin" ContentType="application/vnd.ms-excel.macrosheet"/>`)}),
+		true,
+	}, {
+		"vba project without content type",
+		testZip(t,
+			zipFile{name: "[Content_Types].xml", content: types("")},
+			zipFile{name: "word/vbaProject.bin", content: []byte("vba")}),
+		true,
+	}, {
+		"no macros",
+		testZip(t,
+			zipFile{name: "[Content_Types].xml", content: types("")},
+			zipFile{name: "xl/workbook.bin", content: []byte("workbook")}),
+		false,
+	}}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := OOXMLMacros(tc.in); got != tc.want {
+				t.Errorf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestXMLAttr(t *testing.T) {
+	tcs := []struct {
+		tag, name, want string
+	}{
+		{`<a b="1" c="2"`, "c", "2"},
+		{`<a b='1'`, "b", "1"},
+		{`<m:a m:b="1"`, "b", "1"},
+		{`<a xb="1" b="2"`, "b", "2"},
+		{`<a b=1`, "b", ""},
+		{`<a b="1`, "b", ""},
+		{`<a`, "b", ""},
+	}
+	for _, tc := range tcs {
+		if got := string(xmlAttr([]byte(tc.tag), tc.name)); got != tc.want {
+			t.Errorf("xmlAttr(%q, %q) = %q, want %q", tc.tag, tc.name, got, tc.want)
+		}
+	}
+}
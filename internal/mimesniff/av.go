@@ -0,0 +1,156 @@
+package mimesniff
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// isMP4 is the algorithm for matching the signature for MP4. §6.2.1
+func isMP4(in []byte) bool {
+	if len(in) < 12 {
+		return false
+	}
+	boxSize := binary.BigEndian.Uint32(in)
+	if uint64(len(in)) < uint64(boxSize) || boxSize%4 != 0 {
+		return false
+	}
+	if !bytes.Equal(in[4:8], []byte("ftyp")) {
+		return false
+	}
+	if bytes.Equal(in[8:11], []byte("mp4")) {
+		return true
+	}
+	// Skip the major brand and minor version, then check the compatible brands.
+	for read := 16; read+3 <= int(boxSize); read += 4 {
+		if bytes.Equal(in[read:read+3], []byte("mp4")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isWebM is the algorithm for matching the signature for WebM. §6.2.2
+func isWebM(in []byte) bool {
+	if !bytes.HasPrefix(in, []byte{0x1A, 0x45, 0xDF, 0xA3}) {
+		return false
+	}
+	for iter := 4; iter < len(in) && iter < 38; iter++ {
+		// 0x4282 is the DocType element ID.
+		if !bytes.HasPrefix(in[iter:], []byte{0x42, 0x82}) {
+			continue
+		}
+		iter += 2
+		if iter >= len(in) {
+			break
+		}
+		iter += vintSize(in, iter)
+		if iter >= len(in)-4 {
+			break
+		}
+		if matchesPadded(in, []byte("webm"), iter, len(in)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// vintSize returns the size of the EBML variable size integer found at offset
+// i in the input. §6.2.2.1
+func vintSize(in []byte, i int) int {
+	mask := byte(0x80)
+	size := 1
+	for size < 8 && size < len(in)-i {
+		if in[i]&mask != 0 {
+			break
+		}
+		mask >>= 1
+		size++
+	}
+
+	return size
+}
+
+// matchesPadded reports whether in contains pat starting at offset, after
+// any number of 0x00 padding bytes, and ending before end. §6.2.2.2
+func matchesPadded(in, pat []byte, offset, end int) bool {
+	s := offset
+	for s < end && in[s] == 0x00 {
+		s++
+	}
+
+	return s+len(pat) <= end && bytes.Equal(in[s:s+len(pat)], pat)
+}
+
+var (
+	mp3Rates  = [...]int{0, 32000, 40000, 48000, 56000, 64000, 80000, 96000, 112000, 128000, 160000, 192000, 224000, 256000, 320000}
+	mp25Rates = [...]int{0, 8000, 16000, 24000, 32000, 40000, 48000, 56000, 64000, 80000, 96000, 112000, 128000, 144000, 160000}
+	// sampleRates are indexed by the sample rate bits of the frame header.
+	sampleRates = [...]int{44100, 48000, 32000}
+)
+
+// isMP3WithoutID3 is the algorithm for matching the signature for MP3
+// without ID3. §6.2.3
+func isMP3WithoutID3(in []byte) bool {
+	s := 0
+	if !mp3Header(in, s) {
+		return false
+	}
+	version, bitRate, freq, pad := mp3Frame(in, s)
+	skipped := mp3FrameSize(version, bitRate, freq, pad)
+	if skipped < 4 || skipped > len(in)-s {
+		return false
+	}
+	s += skipped
+
+	return mp3Header(in, s)
+}
+
+// mp3Header is the algorithm to match an mp3 header. §6.2.3.1
+func mp3Header(in []byte, s int) bool {
+	if len(in)-s < 4 {
+		return false
+	}
+	if in[s] != 0xFF || in[s+1]&0xE0 != 0xE0 {
+		return false
+	}
+	if layer := in[s+1] & 0x06 >> 1; layer == 0 {
+		return false
+	}
+	if bitRate := in[s+2] & 0xF0 >> 4; bitRate == 15 {
+		return false
+	}
+	sampleRate := in[s+2] & 0x0C >> 2
+
+	return sampleRate != 3
+}
+
+// mp3Frame is the algorithm to parse an mp3 frame. §6.2.3.2
+func mp3Frame(in []byte, s int) (version, bitRate, freq, pad int) {
+	version = int(in[s+1] & 0x18 >> 3)
+	bitRateIndex := in[s+2] & 0xF0 >> 4
+	if version&0x01 != 0 {
+		bitRate = mp3Rates[bitRateIndex]
+	} else {
+		bitRate = mp25Rates[bitRateIndex]
+	}
+	freq = sampleRates[in[s+2]&0x0C>>2]
+	pad = int(in[s+2] & 0x02 >> 1)
+
+	return version, bitRate, freq, pad
+}
+
+// mp3FrameSize is the algorithm to compute an mp3 frame size. §6.2.3.3
+func mp3FrameSize(version, bitRate, freq, pad int) int {
+	scale := 144
+	if version == 1 {
+		scale = 72
+	}
+	size := bitRate * scale / freq
+	if pad != 0 {
+		size++
+	}
+
+	return size
+}
@@ -0,0 +1,481 @@
+// Package mimesniff implements the algorithms of the WHATWG MIME Sniffing
+// Standard: https://mimesniff.spec.whatwg.org/
+//
+// Section numbers in comments refer to the standard.
+package mimesniff
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+)
+
+// HeaderLen is the maximum number of bytes of a resource header. §5.2
+const HeaderLen = 1445
+
+// Context is the context in which a resource is used. §8
+type Context uint8
+
+const (
+	// Browsing context, ex: a resource loaded in a browser tab. §8.1
+	Browsing Context = iota
+	// Image context, ex: the src of an <img> element. §8.2
+	Image
+	// AudioVideo context, ex: the src of an <audio> or <video> element. §8.3
+	AudioVideo
+	// Plugin context, ex: the data of an <object> element. §8.4
+	Plugin
+	// Style context, ex: a stylesheet. §8.5
+	Style
+	// Script context, ex: the src of a <script> element. §8.6
+	Script
+	// Font context, ex: a @font-face src. §8.7
+	Font
+	// TextTrack context, ex: the src of a <track> element. §8.8
+	TextTrack
+	// CacheManifest context. §8.9
+	CacheManifest
+)
+
+// pattern is a byte pattern with a mask, as defined in §6. Bytes from ignored
+// are skipped from the start of the input before matching.
+type pattern struct {
+	pat, mask []byte
+	ignored   []byte
+	// terminated patterns must be followed by a tag-terminating byte: space or >.
+	terminated bool
+	mime       string
+}
+
+// matches is the pattern matching algorithm. §6
+func (p pattern) matches(in []byte) bool {
+	if len(in) < len(p.pat) {
+		return false
+	}
+	s := 0
+	for s < len(in) && bytes.IndexByte(p.ignored, in[s]) != -1 {
+		s++
+	}
+	if len(in)-s < len(p.pat) {
+		return false
+	}
+	for i := range p.pat {
+		if in[s+i]&p.mask[i] != p.pat[i] {
+			return false
+		}
+	}
+	if p.terminated {
+		t := s + len(p.pat)
+		return t < len(in) && (in[t] == ' ' || in[t] == '>')
+	}
+
+	return true
+}
+
+func matchTable(table []pattern, in []byte) string {
+	for _, p := range table {
+		if p.matches(in) {
+			return p.mime
+		}
+	}
+
+	return ""
+}
+
+// whitespace bytes as defined in §3.
+var whitespace = []byte{'\t', '\n', '\x0c', '\r', ' '}
+
+// all returns a mask which checks all bytes of a n bytes long pattern.
+func all(n int) []byte {
+	return bytes.Repeat([]byte{0xFF}, n)
+}
+
+// imageTable is the image type pattern matching table. §6.1
+var imageTable = []pattern{
+	{pat: []byte{0x00, 0x00, 0x01, 0x00}, mask: all(4), mime: "image/x-icon"},
+	{pat: []byte{0x00, 0x00, 0x02, 0x00}, mask: all(4), mime: "image/x-icon"},
+	{pat: []byte("BM"), mask: all(2), mime: "image/bmp"},
+	{pat: []byte("GIF87a"), mask: all(6), mime: "image/gif"},
+	{pat: []byte("GIF89a"), mask: all(6), mime: "image/gif"},
+	{
+		pat:  []byte("RIFF\x00\x00\x00\x00WEBPVP"),
+		mask: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		mime: "image/webp",
+	},
+	{pat: []byte("\x89PNG\r\n\x1a\n"), mask: all(8), mime: "image/png"},
+	{pat: []byte{0xFF, 0xD8, 0xFF}, mask: all(3), mime: "image/jpeg"},
+}
+
+// audioVideoTable is the audio or video type pattern matching table. §6.2
+var audioVideoTable = []pattern{
+	{
+		pat:  []byte("FORM\x00\x00\x00\x00AIFF"),
+		mask: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0xFF},
+		mime: "audio/aiff",
+	},
+	{pat: []byte("ID3"), mask: all(3), mime: "audio/mpeg"},
+	{pat: []byte("OggS\x00"), mask: all(5), mime: "application/ogg"},
+	{pat: []byte("MThd\x00\x00\x00\x06"), mask: all(8), mime: "audio/midi"},
+	{
+		pat:  []byte("RIFF\x00\x00\x00\x00AVI "),
+		mask: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0xFF},
+		mime: "video/avi",
+	},
+	{
+		pat:  []byte("RIFF\x00\x00\x00\x00WAVE"),
+		mask: []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0xFF},
+		mime: "audio/wave",
+	},
+}
+
+// fontTable is the font type pattern matching table. §6.3
+var fontTable = []pattern{
+	{
+		pat:  append(make([]byte, 34), "LP"...),
+		mask: append(make([]byte, 34), 0xFF, 0xFF),
+		mime: "application/vnd.ms-fontobject",
+	},
+	{pat: []byte{0x00, 0x01, 0x00, 0x00}, mask: all(4), mime: "font/ttf"},
+	{pat: []byte("OTTO"), mask: all(4), mime: "font/otf"},
+	{pat: []byte("ttcf"), mask: all(4), mime: "font/collection"},
+	{pat: []byte("wOFF"), mask: all(4), mime: "font/woff"},
+	{pat: []byte("wOF2"), mask: all(4), mime: "font/woff2"},
+}
+
+// archiveTable is the archive type pattern matching table. §6.4
+var archiveTable = []pattern{
+	{pat: []byte{0x1F, 0x8B, 0x08}, mask: all(3), mime: "application/x-gzip"},
+	{pat: []byte("PK\x03\x04"), mask: all(4), mime: "application/zip"},
+	// The space in "Rar " is part of the standard.
+	{pat: []byte("Rar \x1A\x07\x00"), mask: all(7), mime: "application/x-rar-compressed"},
+}
+
+// htmlPattern creates a case insensitive pattern for an HTML tag, followed by
+// a tag-terminating byte. §7.1
+func htmlPattern(tag string) pattern {
+	p := pattern{
+		pat:        []byte(tag),
+		mask:       all(len(tag)),
+		ignored:    whitespace,
+		terminated: true,
+		mime:       "text/html",
+	}
+	for i := 0; i < len(tag); i++ {
+		if 'A' <= tag[i] && tag[i] <= 'Z' {
+			p.mask[i] = 0xDF
+		}
+	}
+
+	return p
+}
+
+// scriptableTable holds the patterns checked only when the sniff-scriptable
+// flag is set. §7.1
+var scriptableTable = func() []pattern {
+	var ret []pattern
+	for _, tag := range []string{
+		"<!DOCTYPE HTML", "<HTML", "<HEAD", "<SCRIPT", "<IFRAME", "<H1", "<DIV",
+		"<FONT", "<TABLE", "<A", "<STYLE", "<TITLE", "<B", "<BODY", "<BR", "<P",
+		"<!--",
+	} {
+		ret = append(ret, htmlPattern(tag))
+	}
+
+	return append(ret,
+		pattern{pat: []byte("<?xml"), mask: all(5), ignored: whitespace, mime: "text/xml"},
+		pattern{pat: []byte("%PDF-"), mask: all(5), mime: "application/pdf"},
+	)
+}()
+
+// unknownTable holds the patterns checked regardless of the sniff-scriptable
+// flag. §7.1
+var unknownTable = []pattern{
+	{pat: []byte("%!PS-Adobe-"), mask: all(11), mime: "application/postscript"},
+	{pat: []byte{0xFE, 0xFF, 0x00, 0x00}, mask: []byte{0xFF, 0xFF, 0x00, 0x00}, mime: "text/plain"},
+	{pat: []byte{0xFF, 0xFE, 0x00, 0x00}, mask: []byte{0xFF, 0xFF, 0x00, 0x00}, mime: "text/plain"},
+	{pat: []byte{0xEF, 0xBB, 0xBF, 0x00}, mask: []byte{0xFF, 0xFF, 0xFF, 0x00}, mime: "text/plain"},
+}
+
+// ImageType is the image type pattern matching algorithm. §6.1
+func ImageType(in []byte) string {
+	return matchTable(imageTable, in)
+}
+
+// AudioVideoType is the audio or video type pattern matching algorithm. §6.2
+func AudioVideoType(in []byte) string {
+	if m := matchTable(audioVideoTable, in); m != "" {
+		return m
+	}
+	switch {
+	case isMP4(in):
+		return "video/mp4"
+	case isWebM(in):
+		return "video/webm"
+	case isMP3WithoutID3(in):
+		return "audio/mpeg"
+	}
+
+	return ""
+}
+
+// FontType is the font type pattern matching algorithm. §6.3
+func FontType(in []byte) string {
+	return matchTable(fontTable, in)
+}
+
+// ArchiveType is the archive type pattern matching algorithm. §6.4
+func ArchiveType(in []byte) string {
+	return matchTable(archiveTable, in)
+}
+
+// isBinaryDataByte reports whether b is a binary data byte. §3
+func isBinaryDataByte(b byte) bool {
+	return b <= 0x08 || b == 0x0B || 0x0E <= b && b <= 0x1A || 0x1C <= b && b <= 0x1F
+}
+
+func hasBinaryDataBytes(in []byte) bool {
+	for _, b := range in {
+		if isBinaryDataByte(b) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Unknown is the algorithm for identifying an unknown MIME type. §7.1
+func Unknown(in []byte, sniffScriptable bool) string {
+	if sniffScriptable {
+		if m := matchTable(scriptableTable, in); m != "" {
+			return m
+		}
+	}
+	if m := matchTable(unknownTable, in); m != "" {
+		return m
+	}
+	if m := ImageType(in); m != "" {
+		return m
+	}
+	if m := AudioVideoType(in); m != "" {
+		return m
+	}
+	if m := ArchiveType(in); m != "" {
+		return m
+	}
+	if !hasBinaryDataBytes(in) {
+		return "text/plain"
+	}
+
+	return "application/octet-stream"
+}
+
+// TextOrBinary is the algorithm for sniffing a mislabeled binary resource. §7.2
+func TextOrBinary(in []byte) string {
+	if bytes.HasPrefix(in, []byte{0xFE, 0xFF}) ||
+		bytes.HasPrefix(in, []byte{0xFF, 0xFE}) ||
+		bytes.HasPrefix(in, []byte{0xEF, 0xBB, 0xBF}) {
+		return "text/plain"
+	}
+	if !hasBinaryDataBytes(in) {
+		return "text/plain"
+	}
+
+	return "application/octet-stream"
+}
+
+// FeedOrHTML is the algorithm for sniffing a mislabeled feed. It returns
+// text/html unless in is an RSS or Atom feed. §7.3
+func FeedOrHTML(in []byte) string {
+	const html = "text/html"
+	s := 0
+	if bytes.HasPrefix(in, []byte{0xEF, 0xBB, 0xBF}) {
+		s = 3
+	}
+	at := func(str string) bool {
+		return bytes.HasPrefix(in[s:], []byte(str))
+	}
+	// skipPast advances s past the first occurrence of str. It returns false
+	// when str is not found.
+	skipPast := func(str string) bool {
+		i := bytes.Index(in[s:], []byte(str))
+		if i == -1 {
+			return false
+		}
+		s += i + len(str)
+		return true
+	}
+
+	for {
+		// Loop L1: skip whitespace up to the next "<".
+		for {
+			if s >= len(in) {
+				return html
+			}
+			if in[s] == '<' {
+				s++
+				break
+			}
+			if bytes.IndexByte(whitespace, in[s]) == -1 {
+				return html
+			}
+			s++
+		}
+		if s >= len(in) {
+			return html
+		}
+		switch {
+		case at("!--"):
+			s += 3
+			if !skipPast("-->") {
+				return html
+			}
+		case at("!"):
+			s++
+			if !skipPast(">") {
+				return html
+			}
+		case at("?"):
+			s++
+			if !skipPast("?>") {
+				return html
+			}
+		case at("rss"):
+			return "application/rss+xml"
+		case at("feed"):
+			return "application/atom+xml"
+		case at("rdf:RDF"):
+			s += 7
+			rest := in[s:]
+			rss := bytes.Index(rest, []byte("http://purl.org/rss/1.0/"))
+			rdf := bytes.Index(rest, []byte("http://www.w3.org/1999/02/22-rdf-syntax-ns#"))
+			if rss != -1 && rdf != -1 {
+				return "application/rss+xml"
+			}
+			return html
+		default:
+			return html
+		}
+	}
+}
+
+// Resource holds the metadata of a resource relevant for sniffing. §5.1
+type Resource struct {
+	// Supplied is the MIME type supplied by the server, usually the value of
+	// the Content-Type header. The empty string means undefined.
+	Supplied string
+	// NoSniff is set when the X-Content-Type-Options header is nosniff.
+	NoSniff bool
+}
+
+// checkForApacheBug reports whether the supplied Content-Type is one of the
+// values Apache used to send for any unknown resource. §5.1
+func (r Resource) checkForApacheBug() bool {
+	switch r.Supplied {
+	case "text/plain",
+		"text/plain; charset=ISO-8859-1",
+		"text/plain; charset=iso-8859-1",
+		"text/plain; charset=UTF-8":
+		return true
+	}
+
+	return false
+}
+
+// essence returns the lowercase type/subtype of the supplied MIME type, or
+// the empty string when the supplied MIME type is undefined or invalid.
+func (r Resource) essence() string {
+	e, _, err := mime.ParseMediaType(r.Supplied)
+	if err != nil || !strings.Contains(e, "/") {
+		return ""
+	}
+
+	return e
+}
+
+// isXML reports whether essence is an XML MIME type. §4.6
+func isXML(essence string) bool {
+	return strings.HasSuffix(essence, "+xml") ||
+		essence == "text/xml" || essence == "application/xml"
+}
+
+func isAudioVideo(essence string) bool {
+	return strings.HasPrefix(essence, "audio/") ||
+		strings.HasPrefix(essence, "video/") ||
+		essence == "application/ogg"
+}
+
+// Computed is the algorithm for determining the computed MIME type of a
+// resource, used in a browsing context. §7
+func Computed(in []byte, r Resource) string {
+	essence := r.essence()
+	switch essence {
+	case "", "unknown/unknown", "application/unknown", "*/*":
+		return Unknown(in, !r.NoSniff)
+	}
+	if r.NoSniff {
+		return r.Supplied
+	}
+	if r.checkForApacheBug() {
+		return TextOrBinary(in)
+	}
+	if isXML(essence) {
+		return r.Supplied
+	}
+	if essence == "text/html" {
+		if m := FeedOrHTML(in); m != "text/html" {
+			return m
+		}
+		return r.Supplied
+	}
+	// All image, audio and video formats are considered supported.
+	if strings.HasPrefix(essence, "image/") {
+		if m := ImageType(in); m != "" {
+			return m
+		}
+	}
+	if isAudioVideo(essence) {
+		if m := AudioVideoType(in); m != "" {
+			return m
+		}
+	}
+
+	return r.Supplied
+}
+
+// InContext is the context specific sniffing algorithm. §8
+func InContext(ctx Context, in []byte, r Resource) string {
+	essence := r.essence()
+	// contextual runs the pattern matching for contexts which use the supplied
+	// MIME type unless it is an XML MIME type.
+	contextual := func(match func([]byte) string) string {
+		if isXML(essence) {
+			return r.Supplied
+		}
+		if m := match(in); m != "" {
+			return m
+		}
+		return r.Supplied
+	}
+
+	switch ctx {
+	case Image:
+		return contextual(ImageType)
+	case AudioVideo:
+		return contextual(AudioVideoType)
+	case Font:
+		return contextual(FontType)
+	case Plugin:
+		if essence == "" {
+			return "application/octet-stream"
+		}
+		return r.Supplied
+	case Style, Script:
+		return r.Supplied
+	case TextTrack:
+		return "text/vtt"
+	case CacheManifest:
+		return "text/cache-manifest"
+	default:
+		return Computed(in, r)
+	}
+}
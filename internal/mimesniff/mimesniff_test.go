@@ -0,0 +1,222 @@
+package mimesniff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatternTables(t *testing.T) {
+	tcs := []struct {
+		name  string
+		match func([]byte) string
+		in    string
+		want  string
+	}{
+		{"ico", ImageType, "\x00\x00\x01\x00rest", "image/x-icon"},
+		{"cur", ImageType, "\x00\x00\x02\x00rest", "image/x-icon"},
+		{"bmp", ImageType, "BMxxxx", "image/bmp"},
+		{"gif87a", ImageType, "GIF87a...", "image/gif"},
+		{"gif89a", ImageType, "GIF89a...", "image/gif"},
+		{"webp", ImageType, "RIFF\x12\x34\x56\x78WEBPVP8 ", "image/webp"},
+		{"png", ImageType, "\x89PNG\r\n\x1a\n....", "image/png"},
+		{"jpeg", ImageType, "\xFF\xD8\xFF\xE0", "image/jpeg"},
+		{"image no leading whitespace allowed", ImageType, " GIF89a", ""},
+		{"image too short", ImageType, "GIF89", ""},
+		{"aiff", AudioVideoType, "FORM\x00\x00\x00\x00AIFF", "audio/aiff"},
+		{"id3", AudioVideoType, "ID3\x03", "audio/mpeg"},
+		{"ogg", AudioVideoType, "OggS\x00\x02", "application/ogg"},
+		{"midi", AudioVideoType, "MThd\x00\x00\x00\x06\x00\x01", "audio/midi"},
+		{"avi", AudioVideoType, "RIFF\x00\x01\x02\x03AVI LIST", "video/avi"},
+		{"wave", AudioVideoType, "RIFF\x00\x01\x02\x03WAVEfmt ", "audio/wave"},
+		{"mp4 major brand", AudioVideoType, "\x00\x00\x00\x10ftypmp42\x00\x00\x00\x00", "video/mp4"},
+		{"mp4 compatible brand", AudioVideoType, "\x00\x00\x00\x18ftypisom\x00\x00\x00\x00avc1mp41", "video/mp4"},
+		{"mp4 no brand", AudioVideoType, "\x00\x00\x00\x14ftypisom\x00\x00\x00\x00avc1", ""},
+		{"mp4 box size not multiple of 4", AudioVideoType, "\x00\x00\x00\x11ftypmp42\x00\x00\x00\x00\x00", ""},
+		{"mp4 box size larger than input", AudioVideoType, "\x00\x00\x01\x00ftypmp42\x00\x00\x00\x00", ""},
+		{"webm", AudioVideoType, "\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x84webm\x42\x87", "video/webm"},
+		{"matroska", AudioVideoType, "\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x88matroska", ""},
+		// Two consecutive MPEG-1 Layer III frames of 128kbps at 44.1kHz.
+		{"mp3 without id3", AudioVideoType, "\xFF\xFB\x90\x00" + strings.Repeat("\x00", 413) + "\xFF\xFB\x90\x00", "audio/mpeg"},
+		{"mp3 single frame", AudioVideoType, "\xFF\xFB\x90\x00" + strings.Repeat("\x00", 413), ""},
+		{"mp3 bad bit rate", AudioVideoType, "\xFF\xFB\xF0\x00" + strings.Repeat("\x00", 413) + "\xFF\xFB\x90\x00", ""},
+		{"eot", FontType, strings.Repeat("\x01", 34) + "LP", "application/vnd.ms-fontobject"},
+		{"ttf", FontType, "\x00\x01\x00\x00\x00\x10", "font/ttf"},
+		{"otf", FontType, "OTTO\x00\x10", "font/otf"},
+		{"ttc", FontType, "ttcf\x00\x01", "font/collection"},
+		{"woff", FontType, "wOFF\x00\x01", "font/woff"},
+		{"woff2", FontType, "wOF2\x00\x01", "font/woff2"},
+		{"gzip", ArchiveType, "\x1F\x8B\x08\x00", "application/x-gzip"},
+		{"zip", ArchiveType, "PK\x03\x04\x14\x00", "application/zip"},
+		{"rar", ArchiveType, "Rar \x1A\x07\x00\x01", "application/x-rar-compressed"},
+		{"rar without space", ArchiveType, "Rar!\x1A\x07\x00\x01", ""},
+	}
+	for _, tc := range tcs {
+		if got := tc.match([]byte(tc.in)); got != tc.want {
+			t.Errorf("%s: expected: %q, got: %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	tcs := []struct {
+		in         string
+		scriptable bool
+		want       string
+	}{
+		{"<!DOCTYPE html>", true, "text/html"},
+		{"  \n<!doctype HTML>", true, "text/html"},
+		{"<html ", true, "text/html"},
+		{"<HtMl>", true, "text/html"},
+		{"<htmlx>", true, "text/plain"},
+		{"<html", true, "text/plain"},
+		{"<!-- comment -->", true, "text/html"},
+		{"<p>paragraph</p>", true, "text/html"},
+		{"<br/>", true, "text/plain"},
+		{"<html>", false, "text/plain"},
+		{" <?xml version", true, "text/xml"},
+		{"<?XML version", true, "text/plain"},
+		{"%PDF-1.7", true, "application/pdf"},
+		{" %PDF-1.7", true, "text/plain"},
+		{"%PDF-1.7", false, "text/plain"},
+		{"%!PS-Adobe-3.0", false, "application/postscript"},
+		{"\xFE\xFF\x00h", false, "text/plain"},
+		{"\xFF\xFEh\x00", false, "text/plain"},
+		{"\xEF\xBB\xBFhello", false, "text/plain"},
+		{"GIF89a\x00\x00", true, "image/gif"},
+		{"ID3\x03\x00", true, "audio/mpeg"},
+		{"PK\x03\x04\x00", true, "application/zip"},
+		{"plain\ttext\r\n", true, "text/plain"},
+		{"\x1B escape is text", true, "text/plain"},
+		{"binary\x00", true, "application/octet-stream"},
+		{"", true, "text/plain"},
+	}
+	for _, tc := range tcs {
+		if got := Unknown([]byte(tc.in), tc.scriptable); got != tc.want {
+			t.Errorf("Unknown(%q, %t); expected: %s, got: %s", tc.in, tc.scriptable, tc.want, got)
+		}
+	}
+}
+
+func TestFeedOrHTML(t *testing.T) {
+	tcs := []struct {
+		in   string
+		want string
+	}{
+		{`<rss version="2.0">`, "application/rss+xml"},
+		{"\xEF\xBB\xBF<?xml version=\"1.0\"?>\n<rss>", "application/rss+xml"},
+		{`<?xml version="1.0"?><!-- a <comment> --><!DOCTYPE feed><feed xmlns="http://www.w3.org/2005/Atom">`, "application/atom+xml"},
+		{`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">`, "application/rss+xml"},
+		{`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">`, "text/html"},
+		{`<html><rss>`, "text/html"},
+		{`text <rss>`, "text/html"},
+		{`<!-- unterminated comment <rss>`, "text/html"},
+		{``, "text/html"},
+	}
+	for _, tc := range tcs {
+		if got := FeedOrHTML([]byte(tc.in)); got != tc.want {
+			t.Errorf("FeedOrHTML(%q); expected: %s, got: %s", tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestComputed(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n...."
+	tcs := []struct {
+		in       string
+		supplied string
+		noSniff  bool
+		want     string
+	}{
+		{png, "", false, "image/png"},
+		{"<html>", "", false, "text/html"},
+		{"<html>", "", true, "text/plain"},
+		{"<html>", "*/*", false, "text/html"},
+		{"<html>", "unknown/unknown", false, "text/html"},
+		{"<html>", "application/unknown", false, "text/html"},
+		{"<html>", "not a mime", false, "text/html"},
+		{png, "image/gif", true, "image/gif"},
+		// Check for the apache bug: only exact header values count.
+		{png, "text/plain", false, "application/octet-stream"},
+		{png, "text/plain; charset=UTF-8", false, "application/octet-stream"},
+		{"text", "text/plain; charset=iso-8859-1", false, "text/plain"},
+		{png, "text/plain; charset=utf-8", false, "text/plain; charset=utf-8"},
+		{png, "text/plain;charset=UTF-8", false, "text/plain;charset=UTF-8"},
+		{png, "image/svg+xml", false, "image/svg+xml"},
+		{png, "application/xml", false, "application/xml"},
+		{"<rss>", "text/html", false, "application/rss+xml"},
+		{"<html>", "text/html; charset=utf-8", false, "text/html; charset=utf-8"},
+		{png, "image/jpeg", false, "image/png"},
+		{"not an image", "image/jpeg", false, "image/jpeg"},
+		{"ID3\x03", "video/mp4", false, "audio/mpeg"},
+		{"ID3\x03", "application/ogg", false, "audio/mpeg"},
+		{png, "application/json", false, "application/json"},
+	}
+	for _, tc := range tcs {
+		r := Resource{Supplied: tc.supplied, NoSniff: tc.noSniff}
+		if got := Computed([]byte(tc.in), r); got != tc.want {
+			t.Errorf("Computed(%q, %+v); expected: %s, got: %s", tc.in, r, tc.want, got)
+		}
+	}
+}
+
+func TestInContext(t *testing.T) {
+	tcs := []struct {
+		ctx      Context
+		in       string
+		supplied string
+		want     string
+	}{
+		{Image, "GIF89a", "image/png", "image/gif"},
+		{Image, "GIF89a", "image/svg+xml", "image/svg+xml"},
+		{Image, "not an image", "image/png", "image/png"},
+		{Image, "not an image", "", ""},
+		{AudioVideo, "OggS\x00", "audio/mpeg", "application/ogg"},
+		{AudioVideo, "OggS\x00", "application/smil+xml", "application/smil+xml"},
+		{Font, "wOF2", "application/octet-stream", "font/woff2"},
+		{Font, "wOF2", "image/svg+xml", "image/svg+xml"},
+		{Font, "not a font", "font/ttf", "font/ttf"},
+		{Plugin, "GIF89a", "", "application/octet-stream"},
+		{Plugin, "GIF89a", "application/x-foo", "application/x-foo"},
+		{Style, "GIF89a", "text/css", "text/css"},
+		{Script, "GIF89a", "text/javascript", "text/javascript"},
+		{TextTrack, "GIF89a", "text/plain", "text/vtt"},
+		{CacheManifest, "GIF89a", "text/plain", "text/cache-manifest"},
+		{Browsing, "GIF89a", "", "image/gif"},
+	}
+	for _, tc := range tcs {
+		if got := InContext(tc.ctx, []byte(tc.in), Resource{Supplied: tc.supplied}); got != tc.want {
+			t.Errorf("InContext(%d, %q, %s); expected: %s, got: %s", tc.ctx, tc.in, tc.supplied, tc.want, got)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	files := map[string]string{
+		"webm.webm":        "video/webm",
+		"mp4.mp4":          "video/mp4",
+		"mp3.v1.notag.mp3": "audio/mpeg",
+		"mp3.v2.notag.mp3": "audio/mpeg",
+		"wav.wav":          "audio/wave",
+		"avi.avi":          "video/avi",
+		"midi.midi":        "audio/midi",
+		"ogg.oga":          "application/ogg",
+		"pdf.pdf":          "application/pdf",
+		"html.html":        "text/html",
+		"gz.gz":            "application/x-gzip",
+		"woff2.woff2":      "application/octet-stream",
+	}
+	for f, want := range files {
+		in, err := os.ReadFile(filepath.Join("..", "..", "testdata", f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(in) > HeaderLen {
+			in = in[:HeaderLen]
+		}
+		if got := Unknown(in, true); got != want {
+			t.Errorf("%s: expected: %s, got: %s", f, want, got)
+		}
+	}
+}
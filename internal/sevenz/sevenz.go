@@ -0,0 +1,566 @@
+// Package sevenz reads the headers of 7z archives, which list the coders of
+// their streams and their files. Headers are often compressed, in which case
+// they are preceded by an encoded header describing how to decode them.
+// See 7zFormat.txt in the documentation of 7-Zip.
+package sevenz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+
+	"github.com/gabriel-vasile/mimetype/internal/decompress"
+)
+
+// Property IDs of 7z headers.
+const (
+	idEnd              = 0x00
+	idHeader           = 0x01
+	idArchiveProps     = 0x02
+	idAdditionalStream = 0x03
+	idMainStreams      = 0x04
+	idFilesInfo        = 0x05
+	idPackInfo         = 0x06
+	idUnpackInfo       = 0x07
+	idSubStreamsInfo   = 0x08
+	idSize             = 0x09
+	idCRC              = 0x0A
+	idFolders          = 0x0B
+	idCodersUnpackSize = 0x0C
+	idNumUnpackStream  = 0x0D
+	idEmptyStream      = 0x0E
+	idEmptyFile        = 0x0F
+	idName             = 0x11
+	idEncodedHeader    = 0x17
+)
+
+// maxCount is the maximum count of items in a header.
+const maxCount = 64 << 20
+
+var (
+	// ErrCorrupt is returned for headers which cannot be read.
+	ErrCorrupt = errors.New("sevenz: corrupt header")
+	// ErrUnsupported is returned for headers using features not implemented.
+	ErrUnsupported = errors.New("sevenz: unsupported header")
+)
+
+// aes is the ID of the AES-256 coder.
+var aes = []byte{0x06, 0xF1, 0x07, 0x01}
+
+// Header holds what was read from the header of an archive, including the
+// encoded headers preceding it. When reading fails, it holds what was read
+// up to the failure.
+type Header struct {
+	// Encoded holds the streams of the encoded headers, in order.
+	Encoded []*Streams
+	// Main holds the streams of the content of the archive.
+	Main *Streams
+	// Files holds the regular files of the archive.
+	Files []File
+}
+
+// Encrypted returns true if the AES-256 coder is among the coders read, for
+// the encoded headers or for the content.
+func (h *Header) Encrypted() bool {
+	streams := h.Encoded
+	if h.Main != nil {
+		streams = append(streams[:len(streams):len(streams)], h.Main)
+	}
+	for _, s := range streams {
+		for _, f := range s.Folders {
+			for _, c := range f.Coders {
+				if bytes.Equal(c.ID, aes) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// ReadHeader reads the header hdr. Encoded headers are decompressed with
+// decode, at most 4 times, before the header is read. The header is returned
+// even when an error is, with what was read before it.
+func ReadHeader(hdr []byte, decode func(*Streams) ([]byte, error)) (*Header, error) {
+	h := &Header{}
+	for i := 0; len(hdr) > 0 && hdr[0] == idEncodedHeader; i++ {
+		if i == 4 {
+			return h, ErrCorrupt
+		}
+		r := &reader{b: hdr[1:]}
+		s := r.streams()
+		h.Encoded = append(h.Encoded, s)
+		if r.err != nil {
+			return h, r.err
+		}
+		var err error
+		if hdr, err = decode(s); err != nil {
+			return h, err
+		}
+	}
+	r := &reader{b: hdr}
+	if r.byte() != idHeader {
+		return h, ErrCorrupt
+	}
+	r.header(h)
+
+	return h, r.err
+}
+
+// Decode decompresses the header described by the encoded header s, with its
+// packed stream read from the archive r. The packed stream and the header
+// must be at most max bytes.
+func Decode(r io.ReaderAt, s *Streams, max uint64) ([]byte, error) {
+	if len(s.Folders) != 1 || len(s.PackSizes) != 1 || len(s.Folders[0].Coders) != 1 {
+		return nil, ErrUnsupported
+	}
+	// Packed streams follow the 32 bytes of the signature header.
+	n := s.PackSizes[0]
+	if n > max || s.PackPos > 1<<62 {
+		return nil, ErrCorrupt
+	}
+	packed := make([]byte, n)
+	if _, err := r.ReadAt(packed, int64(32+s.PackPos)); err != nil {
+		return nil, ErrCorrupt
+	}
+
+	f := s.Folders[0]
+	unpacked := f.UnpackSize()
+	if unpacked > max {
+		return nil, ErrCorrupt
+	}
+	c := f.Coders[0]
+	var out []byte
+	var err error
+	switch {
+	case bytes.Equal(c.ID, []byte{0x00}):
+		out = packed
+	case bytes.Equal(c.ID, []byte{0x03, 0x01, 0x01}) && len(c.Props) == 5:
+		out, err = decompress.LZMA(packed, c.Props[0], int(unpacked))
+	case bytes.Equal(c.ID, []byte{0x21}):
+		out, err = decompress.LZMA2(packed, int(unpacked))
+	default:
+		return nil, fmt.Errorf("%w: coder %x", ErrUnsupported, c.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(out)) != unpacked {
+		return nil, ErrCorrupt
+	}
+
+	return out, nil
+}
+
+// reader reads the fields of 7z headers. Reading past the end of the header
+// sets err.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) byte() byte {
+	if len(r.b) == 0 {
+		r.err = ErrCorrupt
+		return 0
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+func (r *reader) bytes(n uint64) []byte {
+	if n > uint64(len(r.b)) {
+		r.err = ErrCorrupt
+		r.b = nil
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+// number reads a variable length number. The count of high bits set in the
+// first byte is the number of bytes following it.
+func (r *reader) number() uint64 {
+	first := r.byte()
+	var v uint64
+	mask := byte(0x80)
+	for i := 0; i < 8; i++ {
+		if first&mask == 0 {
+			return v | uint64(first&(mask-1))<<(8*i)
+		}
+		v |= uint64(r.byte()) << (8 * i)
+		mask >>= 1
+	}
+
+	return v
+}
+
+// count reads a number used as a count of items, which cannot exceed the size
+// of the header.
+func (r *reader) count() int {
+	n := r.number()
+	if n > maxCount {
+		r.err = ErrCorrupt
+		return 0
+	}
+	return int(n)
+}
+
+// bits reads a bit field of n items, most significant bit first.
+func (r *reader) bits(n int) []bool {
+	b := r.bytes(uint64(n+7) / 8)
+	if b == nil && n > 0 {
+		return make([]bool, n)
+	}
+	v := make([]bool, n)
+	for i := range v {
+		v[i] = b[i/8]&(0x80>>(i%8)) != 0
+	}
+	return v
+}
+
+// defined reads the bit field telling which of n items are defined, preceded
+// by a byte set when all are.
+func (r *reader) defined(n int) []bool {
+	if r.byte() == 0 {
+		return r.bits(n)
+	}
+	v := make([]bool, n)
+	for i := range v {
+		v[i] = true
+	}
+	return v
+}
+
+// digests skips the CRCs of n items.
+func (r *reader) digests(n int) []bool {
+	defined := r.defined(n)
+	for _, d := range defined {
+		if d {
+			r.bytes(4)
+		}
+	}
+	return defined
+}
+
+// skipProps skips the properties up to the end marker.
+func (r *reader) skipProps() {
+	for r.err == nil {
+		if r.byte() == idEnd {
+			return
+		}
+		r.bytes(r.number())
+	}
+}
+
+// Coder is a compression, filter or encryption method of a folder.
+type Coder struct {
+	ID       []byte
+	Props    []byte
+	In, Outs int
+}
+
+// Folder is a set of coders bound together, which decode packed streams.
+type Folder struct {
+	Coders []Coder
+	// bound tells which output streams are bound to the input of a coder.
+	bound       []bool
+	unpackSizes []uint64
+	hasCRC      bool
+}
+
+// UnpackSize returns the size of the output of the folder, which is the
+// output stream not bound to a coder.
+func (f *Folder) UnpackSize() uint64 {
+	for i, s := range f.unpackSizes {
+		if !f.bound[i] {
+			return s
+		}
+	}
+	return 0
+}
+
+// Streams describes the packed streams of an archive and their folders.
+type Streams struct {
+	PackPos   uint64
+	PackSizes []uint64
+	Folders   []*Folder
+	// sizes holds the sizes of the files stored in the folders.
+	sizes []uint64
+}
+
+// streams reads a streams info structure.
+func (r *reader) streams() *Streams {
+	s := &Streams{}
+	var numStreams []int
+	var sizesRead bool
+	for r.err == nil {
+		switch r.byte() {
+		case idEnd:
+			if !sizesRead {
+				for i, f := range s.Folders {
+					if numStreams != nil && numStreams[i] != 1 {
+						if numStreams[i] != 0 {
+							r.err = ErrCorrupt
+						}
+						continue
+					}
+					s.sizes = append(s.sizes, f.UnpackSize())
+				}
+			}
+			return s
+		case idPackInfo:
+			s.PackPos = r.number()
+			n := r.count()
+			for id := r.byte(); id != idEnd && r.err == nil; id = r.byte() {
+				switch id {
+				case idSize:
+					for i := 0; i < n && r.err == nil; i++ {
+						s.PackSizes = append(s.PackSizes, r.number())
+					}
+				case idCRC:
+					r.digests(n)
+				default:
+					r.bytes(r.number())
+				}
+			}
+		case idUnpackInfo:
+			s.Folders = r.folders()
+		case idSubStreamsInfo:
+			numStreams = make([]int, len(s.Folders))
+			for i := range numStreams {
+				numStreams[i] = 1
+			}
+			for id := r.byte(); id != idEnd && r.err == nil; id = r.byte() {
+				switch id {
+				case idNumUnpackStream:
+					for i := range numStreams {
+						numStreams[i] = r.count()
+					}
+				case idSize:
+					sizesRead = true
+					for i, f := range s.Folders {
+						if numStreams[i] == 0 {
+							continue
+						}
+						var sum uint64
+						for j := 1; j < numStreams[i] && r.err == nil; j++ {
+							size := r.number()
+							s.sizes = append(s.sizes, size)
+							sum += size
+						}
+						if sum > f.UnpackSize() {
+							r.err = ErrCorrupt
+						}
+						s.sizes = append(s.sizes, f.UnpackSize()-sum)
+					}
+				case idCRC:
+					n := 0
+					for i, f := range s.Folders {
+						if numStreams[i] != 1 || !f.hasCRC {
+							n += numStreams[i]
+						}
+					}
+					r.digests(n)
+				default:
+					r.err = ErrCorrupt
+				}
+			}
+		default:
+			r.err = ErrCorrupt
+		}
+	}
+
+	return s
+}
+
+// folders reads the coders info structure. The folders read are returned
+// even when reading fails.
+func (r *reader) folders() []*Folder {
+	if r.byte() != idFolders {
+		r.err = ErrCorrupt
+		return nil
+	}
+	n := r.count()
+	if r.byte() != 0 {
+		r.err = ErrUnsupported
+		return nil
+	}
+	var folders []*Folder
+	for i := 0; i < n && r.err == nil; i++ {
+		folders = append(folders, r.folder())
+	}
+	if r.byte() != idCodersUnpackSize {
+		r.err = ErrCorrupt
+		return folders
+	}
+	for _, f := range folders {
+		for range f.bound {
+			f.unpackSizes = append(f.unpackSizes, r.number())
+		}
+	}
+	for id := r.byte(); id != idEnd && r.err == nil; id = r.byte() {
+		if id != idCRC {
+			r.err = ErrCorrupt
+			break
+		}
+		for i, d := range r.digests(len(folders)) {
+			folders[i].hasCRC = d
+		}
+	}
+
+	return folders
+}
+
+func (r *reader) folder() *Folder {
+	f := &Folder{}
+	var ins, outs int
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		flags := r.byte()
+		c := Coder{ID: r.bytes(uint64(flags & 0x0F)), In: 1, Outs: 1}
+		if flags&0x10 != 0 {
+			c.In, c.Outs = r.count(), r.count()
+		}
+		if flags&0x20 != 0 {
+			c.Props = r.bytes(r.number())
+		}
+		if flags&0x80 != 0 {
+			// Alternative methods are not used by any archiver.
+			r.err = ErrUnsupported
+		}
+		ins += c.In
+		outs += c.Outs
+		f.Coders = append(f.Coders, c)
+	}
+	if outs == 0 || outs > 64 || ins > 64 {
+		r.err = ErrCorrupt
+		return f
+	}
+	f.bound = make([]bool, outs)
+	for i := 0; i < outs-1 && r.err == nil; i++ {
+		r.number() // Input index.
+		if out := r.number(); out < uint64(outs) {
+			f.bound[out] = true
+		}
+	}
+	if packed := ins - (outs - 1); packed > 1 {
+		for i := 0; i < packed; i++ {
+			r.number()
+		}
+	}
+
+	return f
+}
+
+// File is a regular file listed in the header of an archive.
+type File struct {
+	Name string
+	Size uint64
+}
+
+// header reads the header into h.
+func (r *reader) header(h *Header) {
+	for r.err == nil {
+		switch r.byte() {
+		case idEnd:
+			return
+		case idArchiveProps:
+			r.skipProps()
+		case idAdditionalStream:
+			r.streams()
+		case idMainStreams:
+			h.Main = r.streams()
+		case idFilesInfo:
+			h.Files = r.files(h.Main)
+		default:
+			r.err = ErrCorrupt
+		}
+	}
+}
+
+func (r *reader) files(s *Streams) []File {
+	n := r.count()
+	var emptyStream, emptyFile []bool
+	var names []string
+	for r.err == nil {
+		typ := r.byte()
+		if typ == idEnd {
+			break
+		}
+		prop := &reader{b: r.bytes(r.number())}
+		switch typ {
+		case idEmptyStream:
+			emptyStream = prop.bits(n)
+		case idEmptyFile:
+			empty := 0
+			for _, e := range emptyStream {
+				if e {
+					empty++
+				}
+			}
+			emptyFile = prop.bits(empty)
+		case idName:
+			if prop.byte() != 0 {
+				r.err = ErrUnsupported
+				break
+			}
+			names = decodeNames(prop.b)
+		}
+		if prop.err != nil {
+			r.err = prop.err
+		}
+	}
+	if r.err != nil {
+		return nil
+	}
+
+	var files []File
+	var stream, empty int
+	for i := 0; i < n; i++ {
+		f := File{}
+		if i < len(names) {
+			f.Name = names[i]
+		}
+		if i < len(emptyStream) && emptyStream[i] {
+			// Empty streams are directories, unless marked as empty files.
+			isFile := empty < len(emptyFile) && emptyFile[empty]
+			empty++
+			if isFile {
+				files = append(files, f)
+			}
+			continue
+		}
+		if s == nil || stream >= len(s.sizes) {
+			r.err = ErrCorrupt
+			return nil
+		}
+		f.Size = s.sizes[stream]
+		stream++
+		files = append(files, f)
+	}
+
+	return files
+}
+
+// decodeNames decodes the null terminated UTF-16LE names of files.
+func decodeNames(b []byte) []string {
+	var names []string
+	var name []uint16
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			names = append(names, string(utf16.Decode(name)))
+			name = name[:0]
+			continue
+		}
+		name = append(name, c)
+	}
+
+	return names
+}
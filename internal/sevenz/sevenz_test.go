@@ -0,0 +1,65 @@
+package sevenz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadHeader(t *testing.T) {
+	tests := []struct {
+		file      string
+		encrypted bool
+	}{
+		{"7z.7z", false},
+		{"7z.password.7z", true},
+		{"7z.encrypted.7z", true},
+	}
+	for _, tt := range tests {
+		in, err := os.ReadFile(filepath.Join("..", "..", "testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		off := 32 + binary.LittleEndian.Uint64(in[12:])
+		n := binary.LittleEndian.Uint64(in[20:])
+		h, err := ReadHeader(in[off:off+n], func(s *Streams) ([]byte, error) {
+			return Decode(bytes.NewReader(in), s, 1<<20)
+		})
+		if got := h.Encrypted(); got != tt.encrypted {
+			t.Errorf("%s: encrypted %t, want %t", tt.file, got, tt.encrypted)
+		}
+		// The header of archives with encrypted headers cannot be decoded.
+		if tt.file == "7z.encrypted.7z" {
+			if !errors.Is(err, ErrUnsupported) {
+				t.Errorf("%s: got %v, want %v", tt.file, err, ErrUnsupported)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+		}
+		if len(h.Files) == 0 {
+			t.Errorf("%s: no files", tt.file)
+		}
+	}
+}
+
+func TestReadHeaderCorrupt(t *testing.T) {
+	decode := func(*Streams) ([]byte, error) {
+		t.Fatal("decode called")
+		return nil, nil
+	}
+	for _, hdr := range []string{
+		"",
+		"\x02",
+		"\x01\x04\x06\x00\x01\x09\x30\x00",
+		"\x17\x06\x00\x01\x09\x30\x00\x07\x0b\x01\x00\x01",
+	} {
+		if _, err := ReadHeader([]byte(hdr), decode); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%q: got %v, want %v", hdr, err, ErrCorrupt)
+		}
+	}
+}
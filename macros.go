@@ -0,0 +1,11 @@
+package mimetype
+
+import "github.com/gabriel-vasile/mimetype/internal/magic"
+
+// macroChecks holds the functions reporting whether the input of some formats
+// carries macros, keyed by MIME type. Inputs with macros are detected with the
+// macros=true MIME parameter, whatever the type of document they claim to be.
+var macroChecks = map[string]func([]byte) bool{
+	"application/zip":           magic.OOXMLMacros,
+	"application/x-ole-storage": magic.OLEMacros,
+}
@@ -1,7 +1,12 @@
 package mimetype
 
 import (
+	"errors"
 	"mime"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gabriel-vasile/mimetype/internal/charset"
 	"github.com/gabriel-vasile/mimetype/internal/magic"
@@ -18,6 +23,9 @@ type MIME struct {
 	detector magic.Detector
 	children []*MIME
 	parent   *MIME
+	// primary is the node of the same format m is another entry of, checked
+	// at another place in the tree. Such nodes are not listed by Types.
+	primary *MIME
 }
 
 // String returns the string representation of the MIME type, e.g., "application/zip".
@@ -32,6 +40,12 @@ func (m *MIME) Extension() string {
 	return m.extension
 }
 
+// Aliases returns the other names the MIME type is known by, ex: text/xml for
+// application/xml. The returned slice is a copy and can be modified.
+func (m *MIME) Aliases() []string {
+	return append([]string(nil), m.aliases...)
+}
+
 // Parent returns the parent MIME type from the hierarchy.
 // Each MIME type has a non-nil parent, except for the root MIME type.
 //
@@ -43,11 +57,46 @@ func (m *MIME) Parent() *MIME {
 	return m.parent
 }
 
+// Suffix returns the structured syntax suffix of the MIME type, as defined in
+// RFC 6839. It includes the leading plus, as in "+xml". When the MIME type does
+// not have a suffix, the empty string is returned.
+func (m *MIME) Suffix() string {
+	found, _, _ := mime.ParseMediaType(m.mime)
+	return suffix(found)
+}
+
+// MatchOption changes the way MIME types are compared by IsWith and
+// EqualsAnyWith.
+// Options can be combined using the bitwise OR operator.
+type MatchOption uint8
+
+const (
+	// MatchSuffix makes a MIME type with a structured syntax suffix equal to the
+	// MIME type the suffix stands for. For example, image/svg+xml is considered
+	// equal to application/xml and application/epub+zip is considered equal to
+	// application/zip.
+	MatchSuffix MatchOption = 1 << iota
+)
+
+// suffixTypes holds the MIME types each structured syntax suffix stands for.
+// The first MIME type in each list is the one registered in RFC 6839.
+var suffixTypes = map[string][]string{
+	"+xml":  {"application/xml", "text/xml"},
+	"+json": {"application/json"},
+	"+zip":  {"application/zip"},
+}
+
 // Is checks whether this MIME type, or any of its aliases, is equal to the
 // expected MIME type. MIME type equality test is done on the "type/subtype"
 // section, ignores any optional MIME parameters, ignores any leading and
 // trailing whitespace, and is case insensitive.
 func (m *MIME) Is(expectedMIME string) bool {
+	return m.IsWith(expectedMIME, 0)
+}
+
+// IsWith is like Is, but the equality test can be relaxed using opt. For
+// example, IsWith("application/xml", MatchSuffix) returns true for SVG files.
+func (m *MIME) IsWith(expectedMIME string, opt MatchOption) bool {
 	// Parsing is needed because some detected MIME types contain parameters
 	// that need to be stripped for the comparison.
 	expectedMIME, _, _ = mime.ParseMediaType(expectedMIME)
@@ -63,6 +112,29 @@ func (m *MIME) Is(expectedMIME string) bool {
 		}
 	}
 
+	return opt&MatchSuffix != 0 && suffixEquals(found, expectedMIME)
+}
+
+// suffix returns the structured syntax suffix of the already parsed s MIME.
+func suffix(s string) string {
+	slash := strings.IndexByte(s, '/')
+	plus := strings.LastIndexByte(s, '+')
+	if slash == -1 || plus < slash {
+		return ""
+	}
+
+	return s[plus:]
+}
+
+// suffixEquals reports whether the suffix of s stands for the expected MIME.
+// Both s and expected must be already parsed.
+func suffixEquals(s, expected string) bool {
+	for _, t := range suffixTypes[suffix(s)] {
+		if t == expected {
+			return true
+		}
+	}
+
 	return false
 }
 
@@ -84,6 +156,12 @@ func newMIME(
 	return m
 }
 
+// entryOf makes m another entry of the format of primary.
+func (m *MIME) entryOf(primary *MIME) *MIME {
+	m.primary = primary
+	return m
+}
+
 func (m *MIME) alias(aliases ...string) *MIME {
 	m.aliases = aliases
 	return m
@@ -92,26 +170,177 @@ func (m *MIME) alias(aliases ...string) *MIME {
 // match does a depth-first search on the signature tree. It returns the deepest
 // successful node for which all the children detection functions fail.
 func (m *MIME) match(in []byte, readLimit uint32) *MIME {
-	for _, c := range m.children {
-		if c.detector(in, readLimit) {
-			return c.match(in, readLimit)
+	found, _ := m.matchE(in, readLimit)
+	return found
+}
+
+// matchE is like match, but it also returns the panics recovered from the
+// detectors. A detector which panics is treated as not matching the input.
+func (m *MIME) matchE(in []byte, readLimit uint32) (*MIME, error) {
+	var errs []error
+	if sharedContainers[m.mime] {
+		defer magic.Share(in)()
+	}
+	for {
+		next := (*MIME)(nil)
+		for _, c := range m.children {
+			ok, err := c.detect(in, readLimit)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if ok {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			break
 		}
+		if sharedContainers[next.mime] {
+			defer magic.Share(in)()
+		}
+		m = next
 	}
 
-	needsCharset := map[string]func([]byte) string{
-		"text/plain": charset.FromPlain,
-		"text/html":  charset.FromHTML,
-		"text/xml":   charset.FromXML,
-	}
-	// ps holds optional MIME parameters.
+	// ps holds optional MIME parameters. The checks adding them run like
+	// detectors, with their panics recovered and their calls observed.
 	ps := map[string]string{}
+	param := func(p *MIME, check string, f func([]byte) bool) bool {
+		ok, err := p.check(check, in, f)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return ok
+	}
 	if f, ok := needsCharset[m.mime]; ok {
-		if cset := f(in); cset != "" {
+		var cset string
+		if param(m, "charset", func(in []byte) bool { cset = f(in); return cset != "" }) {
 			ps["charset"] = cset
 		}
 	}
+	if p, f := inheritedCheck(encryptionChecks, m); f != nil && param(p, "encrypted", f) {
+		ps["encrypted"] = "true"
+	}
+	if p, f := inheritedCheck(macroChecks, m); f != nil && param(p, "macros", f) {
+		ps["macros"] = "true"
+	}
+	for p := m; p != nil; p = p.parent {
+		if p.mime == "application/pdf" {
+			pps := map[string]string{}
+			if param(p, "pdf", func(in []byte) bool { pdfParams(in, pps); return len(pps) > 0 }) {
+				for k, v := range pps {
+					ps[k] = v
+				}
+			}
+			break
+		}
+	}
+
+	return m.cloneHierarchy(ps), errors.Join(errs...)
+}
+
+// needsCharset holds the functions returning the charset of the formats
+// detected with the charset MIME parameter.
+var needsCharset = map[string]func([]byte) string{
+	"text/plain": charset.FromPlain,
+	"text/html":  charset.FromHTML,
+	"text/xml":   charset.FromXML,
+}
+
+// sharedContainers holds the MIME types of the containers whose parsing is
+// shared by the detectors of their children and by the checks of the MIME
+// parameters, instead of being repeated by each of them.
+var sharedContainers = map[string]bool{
+	"application/zip":           true,
+	"application/x-ole-storage": true,
+}
+
+// inheritedCheck returns the check of m or of its closest ancestor which has
+// one in checks, so that the formats based on another format are checked too,
+// along with the node it belongs to.
+func inheritedCheck(checks map[string]func([]byte) bool, m *MIME) (*MIME, func([]byte) bool) {
+	for ; m != nil; m = m.parent {
+		if f, ok := checks[m.mime]; ok {
+			return m, f
+		}
+	}
+	return nil, nil
+}
+
+// detect runs the detector of m and reports the call to the Observer, if any.
+func (m *MIME) detect(in []byte, readLimit uint32) (bool, error) {
+	o := loadObserver()
+	if o == nil {
+		return m.runDetector(in, readLimit)
+	}
+
+	start := time.Now()
+	ok, err := m.runDetector(in, readLimit)
+	o.ObserveDetector(DetectorEvent{
+		MIME:     m.mime,
+		Node:     m,
+		InputLen: len(in),
+		Duration: time.Since(start),
+		Matched:  ok,
+		Err:      err,
+	})
+
+	return ok, err
+}
+
+// runDetector runs the detector of m, recovering from panics.
+func (m *MIME) runDetector(in []byte, readLimit uint32) (ok bool, err error) {
+	defer m.recoverPanic("", &ok, &err)
+	return m.detector(in, readLimit), nil
+}
+
+// check runs f, the check of the MIME parameter named check of m, like detect
+// runs detectors.
+func (m *MIME) check(check string, in []byte, f func([]byte) bool) (bool, error) {
+	o := loadObserver()
+	if o == nil {
+		return m.runCheck(check, in, f)
+	}
 
-	return m.cloneHierarchy(ps)
+	start := time.Now()
+	ok, err := m.runCheck(check, in, f)
+	o.ObserveDetector(DetectorEvent{
+		MIME:     m.mime,
+		Node:     m,
+		Check:    check,
+		InputLen: len(in),
+		Duration: time.Since(start),
+		Matched:  ok,
+		Err:      err,
+	})
+
+	return ok, err
+}
+
+// runCheck runs f, the check of the MIME parameter named check of m,
+// recovering from panics.
+func (m *MIME) runCheck(check string, in []byte, f func([]byte) bool) (ok bool, err error) {
+	defer m.recoverPanic(check, &ok, &err)
+	return f(in), nil
+}
+
+// recoverPanic recovers from the panic of the detector of m, or of its check
+// of a MIME parameter, and reports it in ok and err. Memory faults are not
+// recovered: they are raised by reading a memory mapped file which was
+// truncated, and detectMmap falls back to reading the file for them.
+func (m *MIME) recoverPanic(check string, ok *bool, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if _, fault := r.(interface{ Addr() uintptr }); fault {
+		panic(r)
+	}
+	perr := &DetectorPanicError{MIME: m.mime, Check: check, Value: r, Stack: debug.Stack()}
+	if h, _ := panicHandler.Load().(func(*DetectorPanicError)); h != nil {
+		h(perr)
+	}
+	*ok, *err = false, perr
 }
 
 // flatten transforms an hierarchy of MIMEs into a slice of MIMEs.
@@ -128,7 +357,7 @@ func (m *MIME) flatten() []*MIME {
 func (m *MIME) clone(ps map[string]string) *MIME {
 	clonedMIME := m.mime
 	if len(ps) > 0 {
-		clonedMIME = mime.FormatMediaType(m.mime, ps)
+		clonedMIME = formatMediaType(m.mime, ps)
 	}
 
 	return &MIME{
@@ -138,6 +367,31 @@ func (m *MIME) clone(ps map[string]string) *MIME {
 	}
 }
 
+// withParams returns a copy of m, whose MIME parameters are those of m and ps.
+func (m *MIME) withParams(ps map[string]string) *MIME {
+	_, old, err := mime.ParseMediaType(m.mime)
+	if err != nil {
+		return m
+	}
+	for k, v := range ps {
+		old[k] = v
+	}
+	t, _, _ := strings.Cut(m.mime, ";")
+	c := *m
+	c.mime = formatMediaType(strings.TrimSpace(t), old)
+	return &c
+}
+
+// formatMediaType is like mime.FormatMediaType, but it keeps the case of t,
+// as in application/vnd.ms-word.document.macroEnabled.12.
+func formatMediaType(t string, ps map[string]string) string {
+	formatted := mime.FormatMediaType(t, ps)
+	if len(formatted) < len(t) {
+		return formatted
+	}
+	return t + formatted[len(t):]
+}
+
 // cloneHierarchy creates a clone of m and all its ancestors. The optional MIME
 // parameters are set on the last child of the hierarchy.
 func (m *MIME) cloneHierarchy(ps map[string]string) *MIME {
@@ -182,5 +436,6 @@ func (m *MIME) Extend(detector func(raw []byte, limit uint32) bool, mime, extens
 
 	mu.Lock()
 	m.children = append([]*MIME{c}, m.children...)
+	atomic.AddUint64(&treeGeneration, 1)
 	mu.Unlock()
 }
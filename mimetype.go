@@ -6,10 +6,14 @@
 package mimetype
 
 import (
+	"fmt"
 	"io"
+	"io/fs"
 	"mime"
 	"os"
 	"sync/atomic"
+
+	"github.com/gabriel-vasile/mimetype/internal/magic"
 )
 
 var defaultLimit uint32 = 3072
@@ -17,6 +21,19 @@ var defaultLimit uint32 = 3072
 // readLimit is the maximum number of bytes from the input used when detecting.
 var readLimit uint32 = defaultLimit
 
+// useMmap is 1 when DetectFile should memory map files, see SetMmap.
+var useMmap uint32
+
+const defaultTailLimit uint32 = 4 << 20
+
+// tailLimit is the maximum number of bytes DetectFile reads from the end of
+// files larger than the read limit, see SetTailLimit.
+var tailLimit uint32 = defaultTailLimit
+
+// wholeFileLimit is the size of the largest compound file DetectFile reads
+// whole, see SetWholeFileLimit.
+var wholeFileLimit uint32
+
 // Detect returns the MIME type found from the provided byte slice.
 //
 // The result is always a valid MIME type, with application/octet-stream
@@ -32,6 +49,57 @@ func Detect(in []byte) *MIME {
 	return root.match(in, l)
 }
 
+// DetectE is like Detect, but it also reports the detectors which panicked
+// while checking the input. Detectors which panic are treated as not matching,
+// and the checks of MIME parameters which panic add no parameter, so the
+// returned MIME type is valid even when the error is not nil. The error wraps
+// one *DetectorPanicError for each panic.
+func DetectE(in []byte) (*MIME, error) {
+	l := atomic.LoadUint32(&readLimit)
+	if l > 0 && len(in) > int(l) {
+		in = in[:l]
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	return root.matchE(in, l)
+}
+
+// DetectorPanicError is the error reported when a detector panics, most
+// likely a buggy detector added with Extend, or when the check of a MIME
+// parameter panics.
+type DetectorPanicError struct {
+	// MIME is the MIME type the detector is for.
+	MIME string
+	// Check is the MIME parameter checked, for the panics of checks: charset,
+	// encrypted, macros or pdf, which stands for the parameters of PDF files.
+	// It is empty for the panics of detectors.
+	Check string
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine at the time of the panic.
+	Stack []byte
+}
+
+func (e *DetectorPanicError) Error() string {
+	if e.Check != "" {
+		return fmt.Sprintf("mimetype: %s check for %s panicked: %v", e.Check, e.MIME, e.Value)
+	}
+	return fmt.Sprintf("mimetype: detector for %s panicked: %v", e.MIME, e.Value)
+}
+
+// panicHandler holds the func(*DetectorPanicError) set by SetPanicHandler.
+var panicHandler atomic.Value
+
+// SetPanicHandler sets a function called each time a detector panics, during
+// any detection. Detection goes on once the handler returns, with the detector
+// treated as not matching. A nil handler removes the previous one.
+//
+// The handler is called with the MIME tree locked for reading, so it must not
+// call Extend.
+func SetPanicHandler(handler func(*DetectorPanicError)) {
+	panicHandler.Store(handler)
+}
+
 // DetectReader returns the MIME type of the provided reader.
 //
 // The result is always a valid MIME type, with application/octet-stream
@@ -70,8 +138,26 @@ func DetectReader(r io.Reader) (*MIME, error) {
 	return root.match(in, l), nil
 }
 
+// readHead reads the first l bytes from r, or all of r when l is 0.
+func readHead(r io.Reader, l uint32) ([]byte, error) {
+	if l == 0 {
+		return io.ReadAll(r)
+	}
+	in := make([]byte, l)
+	n, err := io.ReadFull(r, in)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return in[:n], nil
+}
+
 // DetectFile returns the MIME type of the provided file.
 //
+// Besides the start of the file, up to the limit set by SetLimit, DetectFile
+// reads the end of zip archives, 7z archives and PDF files larger than that
+// limit, up to the limit set by SetTailLimit. Compound files are read whole
+// when enabled with SetWholeFileLimit.
+//
 // The result is always a valid MIME type, with application/octet-stream
 // returned when identification failed with or without an error.
 // Any error returned is related to the opening and reading from the input file.
@@ -82,7 +168,176 @@ func DetectFile(path string) (*MIME, error) {
 	}
 	defer f.Close()
 
-	return DetectReader(f)
+	return detectFile(f)
+}
+
+// detectFile returns the MIME type of the opened file f.
+func detectFile(f *os.File) (*MIME, error) {
+	l := atomic.LoadUint32(&readLimit)
+	m, err := errMIME, error(nil)
+	ok := false
+	if atomic.LoadUint32(&useMmap) == 1 {
+		m, ok = detectMmap(f, l)
+	}
+	if !ok {
+		if m, err = DetectReader(f); err != nil {
+			return m, err
+		}
+	}
+	if t := atomic.LoadUint32(&tailLimit); l > 0 && t > 0 {
+		if m.Is("application/zip") {
+			m = detectZipTail(f, l, t, m)
+		}
+		m = detectEncryptedTail(f, l, t, m)
+		m = detectPdfTail(f, l, t, m)
+	}
+	for p := m; l > 0 && p != nil; p = p.parent {
+		if p.Is("application/x-ole-storage") {
+			if w := atomic.LoadUint32(&wholeFileLimit); w > 0 {
+				m = detectCompoundFile(f, l, w, m)
+			}
+			break
+		}
+	}
+
+	return m, nil
+}
+
+// zipTailLen is the size of the end of zip archives read to find their
+// central directory: a record of 22 bytes and a comment up to 64KiB.
+const zipTailLen = 22 + 0xFFFF
+
+// detectZipTail retries the detection of the zip archive f, larger than the
+// read limit l, with the end of the archive. Formats based on zip are then
+// detected from the names in the central directory of the archive, even when
+// the files they are recognized by are not at the start of the archive.
+// m is returned when the central directory cannot be read or when it is
+// larger than the tail limit t.
+func detectZipTail(f *os.File, l, t uint32, m *MIME) *MIME {
+	fi, err := f.Stat()
+	if err != nil || fi.Size() <= int64(l) {
+		return m
+	}
+	size := fi.Size()
+	n := int64(zipTailLen)
+	if n > int64(t) {
+		n = int64(t)
+	}
+	if n > size-int64(l) {
+		n = size - int64(l)
+	}
+	tail := make([]byte, n)
+	if _, err := f.ReadAt(tail, size-n); err != nil {
+		return m
+	}
+	dirLen := int64(magic.ZipTailLen(tail))
+	if dirLen == 0 || dirLen > int64(t) {
+		return m
+	}
+
+	var in []byte
+	switch {
+	case dirLen <= n:
+		// The tail already holds the central directory.
+		in = make([]byte, int64(l)+dirLen)
+		if _, err := f.ReadAt(in[:l], 0); err != nil {
+			return m
+		}
+		copy(in[l:], tail[n-dirLen:])
+	case dirLen > size-int64(l):
+		// The central directory starts before the end of the head.
+		in = make([]byte, size)
+		if _, err := f.ReadAt(in, 0); err != nil {
+			return m
+		}
+	default:
+		in = make([]byte, int64(l)+dirLen)
+		if _, err := f.ReadAt(in[:l], 0); err != nil {
+			return m
+		}
+		// The central directory is located from the end of the input, so
+		// it is found even though the middle of the archive is missing.
+		if _, err := f.ReadAt(in[l:], size-dirLen); err != nil {
+			return m
+		}
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	return root.match(in, l)
+}
+
+// detectCompoundFile retries the detection of the compound file f, larger than
+// the read limit l, with the whole file. The directory of compound files and
+// the streams holding macros can be anywhere in the file, and are often past
+// the read limit. Only the formats based on compound files are checked again.
+// m is returned when the file is larger than the whole file limit w.
+func detectCompoundFile(f *os.File, l, w uint32, m *MIME) *MIME {
+	fi, err := f.Stat()
+	if err != nil || fi.Size() <= int64(l) || fi.Size() > int64(w) {
+		return m
+	}
+	in := make([]byte, fi.Size())
+	if _, err := f.ReadAt(in, 0); err != nil {
+		return m
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	return ole.match(in, l)
+}
+
+// PathOption changes the way DetectPath handles the file at the path.
+type PathOption uint8
+
+const (
+	// FollowSymlinks makes DetectPath describe the file a symbolic link points
+	// to, instead of returning inode/symlink.
+	FollowSymlinks PathOption = 1 << iota
+)
+
+// DetectPath is like DetectFile, but it checks the type of file first, the way
+// file(1) does. Directories, symbolic links, named pipes, sockets and devices
+// are not read and result in inode/directory, inode/symlink, inode/fifo,
+// inode/socket, inode/chardevice and inode/blockdevice. Empty regular files
+// result in application/x-empty. Only the other regular files are read.
+func DetectPath(path string, opts ...PathOption) (*MIME, error) {
+	var o PathOption
+	for _, opt := range opts {
+		o |= opt
+	}
+	stat := os.Lstat
+	if o&FollowSymlinks != 0 {
+		stat = os.Stat
+	}
+	fi, err := stat(path)
+	if err != nil {
+		return errMIME, err
+	}
+
+	var m *MIME
+	switch mode := fi.Mode(); {
+	case mode.IsDir():
+		m = inodeDir
+	case mode&fs.ModeSymlink != 0:
+		m = inodeSymlink
+	case mode&fs.ModeNamedPipe != 0:
+		m = inodeFifo
+	case mode&fs.ModeSocket != 0:
+		m = inodeSocket
+	case mode&fs.ModeCharDevice != 0:
+		m = inodeCharDevice
+	case mode&fs.ModeDevice != 0:
+		m = inodeBlockDevice
+	case mode.IsRegular() && fi.Size() == 0:
+		m = emptyFile
+	default:
+		return DetectFile(path)
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	return m.cloneHierarchy(nil), nil
 }
 
 // EqualsAny reports whether s MIME type is equal to any MIME type in mimes.
@@ -101,26 +356,110 @@ func EqualsAny(s string, mimes ...string) bool {
 	return false
 }
 
+// EqualsAnyWith is like EqualsAny, but the equality test can be relaxed using
+// opt. For example, EqualsAnyWith(MatchSuffix, "image/svg+xml", "application/xml")
+// returns true.
+func EqualsAnyWith(opt MatchOption, s string, mimes ...string) bool {
+	s, _, _ = mime.ParseMediaType(s)
+	for _, m := range mimes {
+		m, _, _ = mime.ParseMediaType(m)
+		if s == m || opt&MatchSuffix != 0 && suffixEquals(s, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // SetLimit sets the maximum number of bytes read from input when detecting the MIME type.
 // Increasing the limit provides better detection for file formats which store
 // their magical numbers towards the end of the file: docx, pptx, xlsx, etc.
 // During detection data is read in a single block of size limit, i.e. it is not buffered.
 // A limit of 0 means the whole input file will be used.
+// DetectFile may read more of files too, see SetTailLimit and SetWholeFileLimit.
 func SetLimit(limit uint32) {
 	// Using atomic because readLimit can be read at the same time in other goroutine.
 	atomic.StoreUint32(&readLimit, limit)
 }
 
+// SetTailLimit sets the maximum number of bytes DetectFile reads from the end
+// of files larger than the limit set by SetLimit, for the formats which keep
+// part of what identifies them there: the central directory of zip archives,
+// which tells Office documents, jars and EPUBs apart, the header of 7z
+// archives, with its packed stream when compressed, and the trailer of PDF
+// files, which tell whether they are encrypted. At most limit bytes are read for each of these structures, and
+// central directories larger than limit are not read. The default is 4 MiB.
+// A limit of 0 disables these reads, so that DetectFile reads no more than the
+// limit set by SetLimit.
+func SetTailLimit(limit uint32) {
+	atomic.StoreUint32(&tailLimit, limit)
+}
+
+// SetWholeFileLimit sets the size of the largest compound file DetectFile
+// reads whole when it is larger than the limit set by SetLimit. Compound
+// files, such as Microsoft Office 97-2003 documents and Outlook messages, can
+// keep their directory and their macros anywhere in the file, so the type of
+// document and the macros=true parameter are often only found this way. The
+// default is 0, which disables it.
+func SetWholeFileLimit(limit uint32) {
+	atomic.StoreUint32(&wholeFileLimit, limit)
+}
+
+// SetMmap enables or disables memory mapping the files passed to DetectFile.
+// When enabled, the detectors receive a read-only mapping of the file instead
+// of a copy of its content, which saves large allocations when the limit set by
+// SetLimit is high or 0. Files which cannot be mapped are read as usual.
+// Memory mapping is only supported on Linux; on other systems SetMmap has no
+// effect.
+//
+// Detectors added with Extend must not keep the input slice after returning,
+// because the mapping is removed once detection is done.
+func SetMmap(enabled bool) {
+	var v uint32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreUint32(&useMmap, v)
+}
+
 // Extend adds detection for other file formats.
 // It is equivalent to calling Extend() on the root mime type "application/octet-stream".
 func Extend(detector func(raw []byte, limit uint32) bool, mime, extension string, aliases ...string) {
 	root.Extend(detector, mime, extension, aliases...)
 }
 
+// Types returns all the MIME types from the hierarchy, starting with the root
+// application/octet-stream, in depth-first order: each MIME type is followed by
+// its descendants, and siblings are in the order they are checked in. Formats
+// checked at several places in the hierarchy are listed once.
+func Types() []*MIME {
+	mu.RLock()
+	defer mu.RUnlock()
+	var types []*MIME
+	for _, m := range root.flatten() {
+		if m.primary == nil {
+			types = append(types, m)
+		}
+	}
+	return types
+}
+
 // Lookup finds a MIME object by its string representation.
 // The representation can be the main mime type, or any of its aliases.
+// A MIME type which is not known, but has a structured syntax suffix, resolves
+// to the MIME type the suffix stands for: application/foo+json resolves to
+// application/json.
 func Lookup(mime string) *MIME {
 	mu.RLock()
 	defer mu.RUnlock()
-	return root.lookup(mime)
+	if m := root.lookup(mime); m != nil {
+		return m
+	}
+	for _, t := range suffixTypes[suffix(mime)] {
+		if m := root.lookup(t); m != nil {
+			return m
+		}
+	}
+
+	return nil
 }
@@ -1,17 +1,24 @@
 package mimetype
 
 import (
+	archivezip "archive/zip"
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"math/rand"
 	"mime"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+
+	"github.com/gabriel-vasile/mimetype/internal/iana"
 )
 
 const testDataDir = "testdata"
@@ -22,6 +29,8 @@ var files = map[string]string{
 	"3gp.3gp":            "video/3gpp",
 	"3mf.3mf":            "application/vnd.ms-package.3dmanufacturing-3dmodel+xml",
 	"7z.7z":              "application/x-7z-compressed",
+	"7z.encrypted.7z":    "application/x-7z-compressed; encrypted=true",
+	"7z.password.7z":     "application/x-7z-compressed; encrypted=true",
 	"a.a":                "application/x-archive",
 	"aac.aac":            "audio/aac",
 	"aaf.aaf":            "application/octet-stream",
@@ -52,11 +61,17 @@ var files = map[string]string{
 	"deb.deb":            "application/vnd.debian.binary-package",
 	"djvu.djvu":          "image/vnd.djvu",
 	"doc.doc":            "application/msword",
+	"doc.macros.doc":     "application/msword; macros=true",
+	"docm.docm":          "application/vnd.ms-word.document.macroEnabled.12",
 	"docx.1.docx":        "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
 	"docx.docx":          "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"docx.macros.docx":   "application/vnd.openxmlformats-officedocument.wordprocessingml.document; macros=true",
+	"dotm.dotm":          "application/vnd.ms-word.template.macroEnabled.12",
+	"dotx.dotx":          "application/vnd.openxmlformats-officedocument.wordprocessingml.template",
 	"drpm.rpm":           "application/x-rpm",
 	"dwg.1.dwg":          "image/vnd.dwg",
 	"dwg.dwg":            "image/vnd.dwg",
+	"encryptedooxml":     "application/x-ms-encrypted-ooxml",
 	"eot.eot":            "application/vnd.ms-fontobject",
 	"epub.epub":          "application/epub+zip",
 	"exe.exe":            "application/vnd.microsoft.portable-executable",
@@ -93,6 +108,39 @@ var files = map[string]string{
 	"jpm.jpm":            "image/jpm",
 	"jxl.jxl":            "image/jxl",
 	"jxr.jxr":            "image/jxr",
+	"mpp.mpp":            "application/vnd.ms-project",
+	"odb.odb":            "application/vnd.oasis.opendocument.base",
+	"odi.odi":            "application/vnd.oasis.opendocument.image",
+	"odm.odm":            "application/vnd.oasis.opendocument.text-master",
+	"ods.1.ods":          "application/vnd.oasis.opendocument.spreadsheet",
+	"odt.1.odt":          "application/vnd.oasis.opendocument.text",
+	"oft.oft":            "application/vnd.ms-outlook-template",
+	"oth.oth":            "application/vnd.oasis.opendocument.text-web",
+	"oxps.oxps":          "application/oxps",
+	"pdf.encrypted.pdf":  "application/pdf; encrypted=true; version=1.4",
+	"potx.potx":          "application/vnd.openxmlformats-officedocument.presentationml.template",
+	"ppsm.ppsm":          "application/vnd.ms-powerpoint.slideshow.macroEnabled.12",
+	"ppsx.ppsx":          "application/vnd.openxmlformats-officedocument.presentationml.slideshow",
+	"pptm.pptm":          "application/vnd.ms-powerpoint.presentation.macroEnabled.12",
+	"rar.encrypted.rar":  "application/x-rar-compressed; encrypted=true",
+	"sxd.sxd":            "application/vnd.sun.xml.draw",
+	"sxi.sxi":            "application/vnd.sun.xml.impress",
+	"sxw.sxw":            "application/vnd.sun.xml.writer",
+	"tbz2.tar.bz2":       "application/x-bzip2-compressed-tar",
+	"tgz.tar.gz":         "application/x-compressed-tar",
+	"tlz.tar.lz":         "application/x-lzip-compressed-tar",
+	"txz.tar.xz":         "application/x-xz-compressed-tar",
+	"tzst.tar.zst":       "application/x-zstd-compressed-tar",
+	"vsd.vsd":            "application/vnd.visio",
+	"vsdx.vsdx":          "application/vnd.ms-visio.drawing.main+xml",
+	"wps.wps":            "application/vnd.ms-works",
+	"xlam.xlam":          "application/vnd.ms-excel.addin.macroEnabled.12",
+	"xls.macros.xls":     "application/vnd.ms-excel; macros=true",
+	"xlsb.xlsb":          "application/vnd.ms-excel.sheet.binary.macroEnabled.12",
+	"xlsm.macros.xlsm":   "application/vnd.ms-excel.sheet.macroEnabled.12; macros=true",
+	"xlsm.xlsm":          "application/vnd.ms-excel.sheet.macroEnabled.12",
+	"xltm.xltm":          "application/vnd.ms-excel.template.macroEnabled.12",
+	"xltx.xltx":          "application/vnd.openxmlformats-officedocument.spreadsheetml.template",
 	"xpm.xpm":            "image/x-xpixmap",
 	"js.js":              "application/javascript",
 	"json.json":          "application/json",
@@ -151,7 +199,10 @@ var files = map[string]string{
 	"odc.odc":            "application/vnd.oasis.opendocument.chart",
 	"owl2.owl":           "application/owl+xml",
 	"pat.pat":            "image/x-gimp-pat",
-	"pdf.pdf":            "application/pdf",
+	"pdf.javascript.pdf": "application/pdf; active-content=true; version=1.7",
+	"pdf.junk.pdf":       "application/pdf; version=1.7",
+	"pdf.pdf":            "application/pdf; version=1.4",
+	"pdf.pdfa.pdf":       "application/pdf; linearized=true; pdfa=2b; pdfua=1; version=1.7",
 	"php.php":            "text/x-php",
 	"pl.pl":              "text/x-perl",
 	"png.png":            "image/png",
@@ -171,6 +222,7 @@ var files = map[string]string{
 	"rtf.rtf":            "text/rtf",
 	"sample32.macho":     "application/x-mach-binary",
 	"sample64.macho":     "application/x-mach-binary",
+	"sh.sh":              "text/x-shellscript",
 	"shp.shp":            "application/vnd.shp",
 	"shx.shx":            "application/vnd.shx",
 	"so.so":              "application/x-sharedlib",
@@ -188,49 +240,50 @@ var files = map[string]string{
 	"tar.ustar.tar": "application/x-tar",
 	"tar.v7.tar":    "application/x-tar",
 	// tar.v7-gnu.tar is a v7 tar archive generated with GNU tar 1.29.
-	"tar.v7-gnu.tar":  "application/x-tar",
-	"tcl.tcl":         "text/x-tcl",
-	"tcx.tcx":         "application/vnd.garmin.tcx+xml",
-	"tiff.tiff":       "image/tiff",
-	"torrent.torrent": "application/x-bittorrent",
-	"tsv.tsv":         "text/tab-separated-values",
-	"ttc.ttc":         "font/collection",
-	"ttf.ttf":         "font/ttf",
-	"tzfile":          "application/tzif",
-	"utf16bebom.txt":  "text/plain; charset=utf-16be",
-	"utf16lebom.txt":  "text/plain; charset=utf-16le",
-	"utf32bebom.txt":  "text/plain; charset=utf-32be",
-	"utf32lebom.txt":  "text/plain; charset=utf-32le",
-	"utf8.txt":        "text/plain; charset=utf-8",
-	"utf8ctrlchars":   "application/octet-stream",
-	"vcf.dos.vcf":     "text/vcard",
-	"vcf.vcf":         "text/vcard",
-	"voc.voc":         "audio/x-unknown",
-	"vtt.vtt":         "text/vtt",
-	"vtt.space.vtt":   "text/vtt",
-	"vtt.tab.vtt":     "text/vtt",
-	"vtt.eof.vtt":     "text/vtt",
-	"warc.warc":       "application/warc",
-	"wasm.wasm":       "application/wasm",
-	"wav.wav":         "audio/wav",
-	"webm.webm":       "video/webm",
-	"webp.webp":       "image/webp",
-	"woff.woff":       "font/woff",
-	"woff2.woff2":     "font/woff2",
-	"x3d.x3d":         "model/x3d+xml",
-	"xar.xar":         "application/x-xar",
-	"xcf.xcf":         "image/x-xcf",
-	"xfdf.xfdf":       "application/vnd.adobe.xfdf",
-	"xlf.xlf":         "application/x-xliff+xml",
-	"xls.xls":         "application/vnd.ms-excel",
-	"xlsx.1.xlsx":     "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
-	"xlsx.2.xlsx":     "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
-	"xlsx.xlsx":       "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
-	"xml.xml":         "text/xml; charset=utf-8",
-	"xml.withbr.xml":  "text/xml; charset=utf-8",
-	"xz.xz":           "application/x-xz",
-	"zip.zip":         "application/zip",
-	"zst.zst":         "application/zstd",
+	"tar.v7-gnu.tar":    "application/x-tar",
+	"tcl.tcl":           "text/x-tcl",
+	"tcx.tcx":           "application/vnd.garmin.tcx+xml",
+	"tiff.tiff":         "image/tiff",
+	"torrent.torrent":   "application/x-bittorrent",
+	"tsv.tsv":           "text/tab-separated-values",
+	"ttc.ttc":           "font/collection",
+	"ttf.ttf":           "font/ttf",
+	"tzfile":            "application/tzif",
+	"utf16bebom.txt":    "text/plain; charset=utf-16be",
+	"utf16lebom.txt":    "text/plain; charset=utf-16le",
+	"utf32bebom.txt":    "text/plain; charset=utf-32be",
+	"utf32lebom.txt":    "text/plain; charset=utf-32le",
+	"utf8.txt":          "text/plain; charset=utf-8",
+	"utf8ctrlchars":     "application/octet-stream",
+	"vcf.dos.vcf":       "text/vcard",
+	"vcf.vcf":           "text/vcard",
+	"voc.voc":           "audio/x-unknown",
+	"vtt.vtt":           "text/vtt",
+	"vtt.space.vtt":     "text/vtt",
+	"vtt.tab.vtt":       "text/vtt",
+	"vtt.eof.vtt":       "text/vtt",
+	"warc.warc":         "application/warc",
+	"wasm.wasm":         "application/wasm",
+	"wav.wav":           "audio/wav",
+	"webm.webm":         "video/webm",
+	"webp.webp":         "image/webp",
+	"woff.woff":         "font/woff",
+	"woff2.woff2":       "font/woff2",
+	"x3d.x3d":           "model/x3d+xml",
+	"xar.xar":           "application/x-xar",
+	"xcf.xcf":           "image/x-xcf",
+	"xfdf.xfdf":         "application/vnd.adobe.xfdf",
+	"xlf.xlf":           "application/x-xliff+xml",
+	"xls.xls":           "application/vnd.ms-excel",
+	"xlsx.1.xlsx":       "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"xlsx.2.xlsx":       "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"xlsx.xlsx":         "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"xml.xml":           "text/xml; charset=utf-8",
+	"xml.withbr.xml":    "text/xml; charset=utf-8",
+	"xz.xz":             "application/x-xz",
+	"zip.encrypted.zip": "application/zip; encrypted=true",
+	"zip.zip":           "application/zip",
+	"zst.zst":           "application/zstd",
 }
 
 func TestDetect(t *testing.T) {
@@ -262,7 +315,7 @@ func TestDetect(t *testing.T) {
 
 		if mtype, err := DetectFile(fileName); mtype.String() != expected {
 			t.Errorf(errStr, fName, expected, mtype.String(), err)
-		} else if mtype.Extension() != filepath.Ext(fName) {
+		} else if ext := mtype.Extension(); ext == "" && filepath.Ext(fName) != "" || !strings.HasSuffix(fName, ext) {
 			t.Errorf(extStr, fName, filepath.Ext(fName), mtype.Extension())
 		}
 	}
@@ -276,7 +329,7 @@ func TestGenerateSupportedFormats(t *testing.T) {
 	}
 	defer f.Close()
 
-	nodes := root.flatten()
+	nodes := builtinNodes
 	header := fmt.Sprintf(`## %d Supported MIME types
 This file is automatically generated when running tests. Do not edit manually.
 
@@ -327,6 +380,141 @@ func TestEqualsAny(t *testing.T) {
 	}
 }
 
+func TestEqualsAnyWith(t *testing.T) {
+	type ss []string
+	testCases := []struct {
+		m1  string
+		m2  ss
+		opt MatchOption
+		res bool
+	}{
+		{"image/svg+xml", ss{"application/xml"}, 0, false},
+		{"image/svg+xml", ss{"application/xml"}, MatchSuffix, true},
+		{"image/svg+xml", ss{"text/xml"}, MatchSuffix, true},
+		{"IMAGE/SVG+XML; charset=utf-8", ss{"application/xml"}, MatchSuffix, true},
+		{"application/geo+json", ss{"application/json"}, MatchSuffix, true},
+		{"application/epub+zip", ss{"application/zip"}, MatchSuffix, true},
+		{"application/epub+zip", ss{"application/json"}, MatchSuffix, false},
+		// The suffix only widens the suffixed type, not the other way around.
+		{"application/xml", ss{"image/svg+xml"}, MatchSuffix, false},
+		{"application/foo+bar", ss{"application/bar"}, MatchSuffix, false},
+		{"foo/bar", ss{"foo/bar"}, MatchSuffix, true},
+	}
+	for _, tc := range testCases {
+		if EqualsAnyWith(tc.opt, tc.m1, tc.m2...) != tc.res {
+			t.Errorf("Equality test failed for %+v", tc)
+		}
+	}
+}
+
+func TestSuffix(t *testing.T) {
+	testCases := []struct {
+		m      *MIME
+		suffix string
+	}{
+		{svg, "+xml"},
+		{geoJSON, "+json"},
+		{epub, "+zip"},
+		{threemf, "+xml"},
+		{xml, ""},
+		{root, ""},
+	}
+	for _, tc := range testCases {
+		if got := tc.m.Suffix(); got != tc.suffix {
+			t.Errorf("%s suffix; expected: %q, got: %q", tc.m, tc.suffix, got)
+		}
+	}
+
+	if !rss.IsWith("application/xml", MatchSuffix) {
+		t.Errorf("%s should be application/xml when matching suffixes", rss)
+	}
+	if rss.Is("application/xml") {
+		t.Errorf("%s should not be application/xml without matching suffixes", rss)
+	}
+	if !xml.Is("application/xml") {
+		t.Errorf("%s should be application/xml", xml)
+	}
+	if d := Detect([]byte(`{"type":"FeatureCollection","features":[]}`)); !d.IsWith("application/json", MatchSuffix) {
+		t.Errorf("%s should be application/json when matching suffixes", d)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	testCases := []struct {
+		in, canonical string
+		status        IANAStatus
+	}{
+		{"application/zip", "application/zip", IANARegistered},
+		{"Application/X-Zip-Compressed; foo=bar", "application/zip", IANAUnregistered},
+		{"gzip/document", "application/gzip", IANAUnregistered},
+		{"application/x-rar-compressed", "application/vnd.rar", IANAUnregistered},
+		{"application/javascript", "text/javascript", IANADeprecated},
+		{"application/font-sfnt", "font/sfnt", IANADeprecated},
+		{"audio/x-midi", "audio/midi", IANAUnregistered},
+		// Aliases of a node with no registered name resolve to the node MIME.
+		{"application/x-unix-archive", "application/x-archive", IANAUnregistered},
+		{"TEXT/X-PHP", "text/x-php", IANAUnregistered},
+		{"foo/bar", "foo/bar", IANAUnregistered},
+		{"not a mime", "", IANAUnregistered},
+	}
+	for _, tc := range testCases {
+		if got := Canonical(tc.in); got != tc.canonical {
+			t.Errorf("Canonical(%s); expected: %s, got: %s", tc.in, tc.canonical, got)
+		}
+		if got := Registration(tc.in); got != tc.status {
+			t.Errorf("Registration(%s); expected: %s, got: %s", tc.in, tc.status, got)
+		}
+	}
+}
+
+// builtinNodes holds the nodes of the tree before tests extend it with
+// made-up MIME types, listing each format once.
+var builtinNodes = Types()
+
+// The registry snapshot must know the registration status of every MIME type
+// in the tree, and canonicalization must not move names out of their node.
+func TestCanonicalTree(t *testing.T) {
+	for _, n := range builtinNodes {
+		names := append([]string{n.mime}, n.aliases...)
+		for _, name := range names {
+			if _, ok := iana.Lookup(name); !ok {
+				t.Errorf("%s is missing from the registry snapshot", name)
+			}
+			c := Canonical(name)
+			if m := Lookup(c); m == nil || !m.Is(name) {
+				t.Errorf("Canonical(%s) = %s is not an alias of %s", name, c, name)
+			}
+			if Registration(c) == IANADeprecated {
+				t.Errorf("Canonical(%s) = %s is deprecated", name, c)
+			}
+		}
+	}
+}
+
+func TestTypes(t *testing.T) {
+	types := Types()
+	if len(types) == 0 || types[0].String() != "application/octet-stream" {
+		t.Fatalf("Types must start with the root")
+	}
+	seen := map[*MIME]bool{}
+	for _, m := range types {
+		if p := m.Parent(); p != nil && !seen[p] {
+			t.Errorf("%s listed before its parent %s", m, p)
+		}
+		seen[m] = true
+	}
+
+	xml := Lookup("text/xml")
+	aliases := xml.Aliases()
+	if len(aliases) != 1 || aliases[0] != "application/xml" {
+		t.Fatalf("text/xml aliases: got %v", aliases)
+	}
+	aliases[0] = "changed"
+	if xml.Aliases()[0] != "application/xml" {
+		t.Errorf("Aliases must return a copy")
+	}
+}
+
 func TestDetectReader(t *testing.T) {
 	errStr := "File: %s; Mime: %s != DetectedMime: %s; err: %v"
 	for fName, expected := range files {
@@ -369,6 +557,199 @@ func (b *breakReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
+func TestDetectFileMmap(t *testing.T) {
+	SetMmap(true)
+	defer SetMmap(false)
+	for _, limit := range []uint32{defaultLimit, 0} {
+		SetLimit(limit)
+		for fName, expected := range files {
+			mtype, err := DetectFile(filepath.Join(testDataDir, fName))
+			if err != nil || mtype.String() != expected {
+				t.Errorf("limit %d, %s: expected %s, got %s, err: %v", limit, fName, expected, mtype, err)
+			}
+		}
+	}
+	SetLimit(defaultLimit)
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if mtype, err := DetectFile(empty); err != nil || !mtype.Is("text/plain") {
+		t.Errorf("empty file: expected text/plain, got %s, err: %v", mtype, err)
+	}
+}
+
+func TestDetectFileZipTail(t *testing.T) {
+	// The files docx is recognized by come after a file larger than the read
+	// limit, so they are only found in the central directory.
+	random := make([]byte, 2*defaultLimit)
+	rand.New(rand.NewSource(1)).Read(random)
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"big.bin", random},
+		{"[Content_Types].xml", []byte("<Types/>")},
+		{"word/document.xml", []byte("<document/>")},
+	}
+	for _, encrypted := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		zw := archivezip.NewWriter(buf)
+		if encrypted {
+			// The encryption parameter added from the first file must not
+			// prevent reading the central directory.
+			fh := &archivezip.FileHeader{Name: "secret.txt", Flags: 0x1}
+			if _, err := zw.CreateHeader(fh); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, f := range files {
+			w, err := zw.Create(f.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(f.content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		docx := filepath.Join(t.TempDir(), "a.docx")
+		if err := os.WriteFile(docx, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		const want = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+		if mtype := Detect(buf.Bytes()); !mtype.Is("application/zip") {
+			t.Errorf("encrypted %t: Detect: expected application/zip, got %s", encrypted, mtype)
+		}
+		for _, mmap := range []bool{false, true} {
+			SetMmap(mmap)
+			if mtype, err := DetectFile(docx); err != nil || !mtype.Is(want) {
+				t.Errorf("encrypted %t, mmap %t: expected %s, got %s, err: %v", encrypted, mmap, want, mtype, err)
+			}
+		}
+		SetMmap(false)
+
+		// The central directory is not read past the tail limit.
+		for _, limit := range []uint32{0, 100} {
+			SetTailLimit(limit)
+			if mtype, err := DetectFile(docx); err != nil || mtype.Is(want) || !mtype.Is("application/zip") {
+				t.Errorf("encrypted %t, tail limit %d: expected application/zip, got %s, err: %v", encrypted, limit, mtype, err)
+			}
+		}
+		SetTailLimit(defaultTailLimit)
+	}
+}
+
+func TestDetectFileCompoundFile(t *testing.T) {
+	orig, err := os.ReadFile(filepath.Join(testDataDir, "doc.macros.doc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Move the directory, which follows the FAT sector, past the read limit.
+	const pad = 8
+	dir := orig[1024:]
+	in := append([]byte(nil), orig[:1024]...)
+	binary.LittleEndian.PutUint32(in[48:], 1+pad)
+	fat := in[512:1024]
+	for i := 1; i < 128; i++ {
+		binary.LittleEndian.PutUint32(fat[4*i:], 0xFFFFFFFF)
+	}
+	for i, n := 0, len(dir)/512; i < n; i++ {
+		next := uint32(1 + pad + i + 1)
+		if i == n-1 {
+			next = 0xFFFFFFFE
+		}
+		binary.LittleEndian.PutUint32(fat[4*(1+pad+i):], next)
+	}
+	in = append(append(in, make([]byte, pad*512)...), dir...)
+	doc := filepath.Join(t.TempDir(), "a.doc")
+	if err := os.WriteFile(doc, in, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const want = "application/msword; macros=true"
+	if mtype := Detect(in); mtype.String() != "application/x-ole-storage" {
+		t.Errorf("Detect: expected application/x-ole-storage, got %s", mtype)
+	}
+	// Compound files are only read whole when enabled.
+	if mtype, err := DetectFile(doc); err != nil || mtype.String() != "application/x-ole-storage" {
+		t.Errorf("disabled: expected application/x-ole-storage, got %s, err: %v", mtype, err)
+	}
+	SetWholeFileLimit(uint32(len(in)) - 1)
+	if mtype, err := DetectFile(doc); err != nil || mtype.String() != "application/x-ole-storage" {
+		t.Errorf("too large: expected application/x-ole-storage, got %s, err: %v", mtype, err)
+	}
+	SetWholeFileLimit(16 << 20)
+	defer SetWholeFileLimit(0)
+	for _, mmap := range []bool{false, true} {
+		SetMmap(mmap)
+		if mtype, err := DetectFile(doc); err != nil || mtype.String() != want {
+			t.Errorf("mmap %t: expected %s, got %s, err: %v", mmap, want, mtype, err)
+		}
+	}
+	SetMmap(false)
+}
+
+func TestDetectPath(t *testing.T) {
+	dir := t.TempDir()
+	gif := filepath.Join(dir, "a.gif")
+	if err := os.WriteFile(gif, []byte("GIF89a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type pathCase struct {
+		path string
+		opts []PathOption
+		want string
+	}
+	tcases := []pathCase{
+		{gif, nil, "image/gif"},
+		{empty, nil, "application/x-empty"},
+		{dir, nil, "inode/directory"},
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(gif, link); err == nil {
+		tcases = append(tcases,
+			pathCase{link, nil, "inode/symlink"},
+			pathCase{link, []PathOption{FollowSymlinks}, "image/gif"})
+	}
+	sock := filepath.Join(dir, "sock")
+	if l, err := net.Listen("unix", sock); err == nil {
+		defer l.Close()
+		tcases = append(tcases, pathCase{sock, nil, "inode/socket"})
+	}
+	if _, err := os.Stat(os.DevNull); err == nil && os.DevNull == "/dev/null" {
+		tcases = append(tcases, pathCase{os.DevNull, nil, "inode/chardevice"})
+	}
+
+	for _, tc := range tcases {
+		m, err := DetectPath(tc.path, tc.opts...)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.path, err)
+			continue
+		}
+		if !m.Is(tc.want) {
+			t.Errorf("%s: got %s, want %s", tc.path, m, tc.want)
+		}
+	}
+
+	if _, err := DetectPath(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+	// Special MIME types are never detected from content.
+	if m := Detect(nil); !m.Is("text/plain") {
+		t.Errorf("empty input: got %s, want text/plain", m)
+	}
+}
+
 func TestFaultyInput(t *testing.T) {
 	inexistent := "inexistent.file"
 	if mtype, err := DetectFile(inexistent); err == nil {
@@ -534,6 +915,33 @@ func BenchmarkFiles(b *testing.B) {
 	}
 }
 
+// BenchmarkDetectFileNoLimit compares the heap usage of reading and memory
+// mapping a large file when the whole file is used for detection.
+func BenchmarkDetectFileNoLimit(b *testing.B) {
+	name := filepath.Join(b.TempDir(), "large.bin")
+	data := make([]byte, 16<<20)
+	copy(data, "GIF89a")
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+	SetLimit(0)
+	defer SetLimit(defaultLimit)
+
+	for _, mmap := range []bool{false, true} {
+		b.Run(fmt.Sprintf("mmap=%t", mmap), func(b *testing.B) {
+			SetMmap(mmap)
+			defer SetMmap(false)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, err := DetectFile(name); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkAll(b *testing.B) {
 	r := rand.New(rand.NewSource(0))
 	data := make([]byte, defaultLimit)
@@ -625,6 +1033,11 @@ func TestLookup(t *testing.T) {
 		{zip.mime, zip},
 		{zip.aliases[0], zip},
 		{xlsx.mime, xlsx},
+		{"application/xml", xml},
+		// Unknown MIME types with a structured syntax suffix.
+		{"application/vnd.foo+json", json},
+		{"application/vnd.foo+xml", xml},
+		{"application/vnd.foo+zip", zip},
 	}
 
 	for _, tt := range data {
@@ -634,6 +1047,43 @@ func TestLookup(t *testing.T) {
 			}
 		})
 	}
+
+	if m := Lookup("application/vnd.foo+bar"); m != nil {
+		t.Fatalf("unknown suffix should not be found, got: %s", m)
+	}
+}
+
+func TestSniffHTTP(t *testing.T) {
+	png, err := os.ReadFile(filepath.Join(testDataDir, "png.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The <html> tag is found after the resource header length.
+	lateHTML := append(bytes.Repeat([]byte(" "), 1500), "<html>"...)
+	testCases := []struct {
+		ctx      SniffContext
+		in       []byte
+		supplied string
+		noSniff  bool
+		want     string
+	}{
+		{SniffBrowsing, png, "", false, "image/png"},
+		{SniffBrowsing, png, "text/plain", false, "application/octet-stream"},
+		{SniffBrowsing, png, "text/plain", true, "text/plain"},
+		{SniffBrowsing, png, "image/gif", false, "image/png"},
+		{SniffBrowsing, lateHTML, "", false, "text/plain"},
+		{SniffImage, png, "image/gif", false, "image/png"},
+		{SniffFont, png, "font/ttf", false, "font/ttf"},
+	}
+	for _, tc := range testCases {
+		got := SniffHTTPContext(tc.ctx, tc.in, tc.supplied)
+		if tc.ctx == SniffBrowsing {
+			got = SniffHTTP(tc.in, tc.supplied, tc.noSniff)
+		}
+		if got != tc.want {
+			t.Errorf("sniff %q in context %d; expected: %s, got: %s", tc.supplied, tc.ctx, tc.want, got)
+		}
+	}
 }
 
 func TestExtend(t *testing.T) {
@@ -656,7 +1106,11 @@ func TestExtend(t *testing.T) {
 				tt.parent = root
 			}
 
+			gen := atomic.LoadUint64(&treeGeneration)
 			extend(func(raw []byte, limit uint32) bool { return false }, tt.mime, tt.ext)
+			if atomic.LoadUint64(&treeGeneration) == gen {
+				t.Errorf("extending to %s did not change the tree generation", tt.mime)
+			}
 			m := Lookup(tt.mime)
 			if m == nil {
 				t.Fatalf("mime %s not found", tt.mime)
@@ -705,3 +1159,146 @@ func FuzzMimetype(f *testing.F) {
 		}
 	})
 }
+
+func TestDetectE(t *testing.T) {
+	var handled []*DetectorPanicError
+	SetPanicHandler(func(err *DetectorPanicError) { handled = append(handled, err) })
+	defer SetPanicHandler(nil)
+
+	trigger := []byte("\x00panic\x00")
+	gif.Extend(func(raw []byte, limit uint32) bool {
+		if bytes.Contains(raw, trigger) {
+			return raw[len(raw)] == 0
+		}
+		return false
+	}, "image/x-panicking", ".panic")
+	t.Cleanup(func() { removeExtension(gif, "image/x-panicking") })
+
+	m, err := DetectE(append([]byte("GIF89a"), trigger...))
+	if !m.Is("image/gif") {
+		t.Errorf("a panicking detector must be treated as not matching, got %s", m)
+	}
+	var perr *DetectorPanicError
+	if !errors.As(err, &perr) || perr.MIME != "image/x-panicking" || len(perr.Stack) == 0 {
+		t.Fatalf("expected a *DetectorPanicError, got %v", err)
+	}
+	if len(handled) != 1 || handled[0] != perr {
+		t.Errorf("expected the panic handler to be called once, got %d calls", len(handled))
+	}
+
+	if m := Detect(append([]byte("GIF89a"), trigger...)); !m.Is("image/gif") {
+		t.Errorf("Detect: got %s, want image/gif", m)
+	}
+	if m, err := DetectE([]byte("GIF89a")); err != nil || !m.Is("image/gif") {
+		t.Errorf("DetectE without panics: got %s, err: %v", m, err)
+	}
+}
+
+func TestDetectECheckPanic(t *testing.T) {
+	var handled []*DetectorPanicError
+	SetPanicHandler(func(err *DetectorPanicError) { handled = append(handled, err) })
+	defer SetPanicHandler(nil)
+	o := &recordingObserver{}
+	SetObserver(o)
+	defer SetObserver(nil)
+
+	mu.Lock()
+	encryptionChecks["image/gif"] = func(in []byte) bool { return in[len(in)] == 0 }
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(encryptionChecks, "image/gif")
+		mu.Unlock()
+	})
+
+	m, err := DetectE([]byte("GIF89a"))
+	if m.String() != "image/gif" {
+		t.Errorf("a panicking check must add no parameter, got %s", m)
+	}
+	var perr *DetectorPanicError
+	if !errors.As(err, &perr) || perr.MIME != "image/gif" || perr.Check != "encrypted" {
+		t.Fatalf("expected a *DetectorPanicError for the encrypted check, got %v", err)
+	}
+	if len(handled) != 1 || handled[0] != perr {
+		t.Errorf("expected the panic handler to be called once, got %d calls", len(handled))
+	}
+	if m := Detect([]byte("GIF89a")); m.String() != "image/gif" {
+		t.Errorf("Detect: got %s, want image/gif", m)
+	}
+	var checks int
+	for _, e := range o.events() {
+		if e.Check == "encrypted" && e.MIME == "image/gif" && e.Err != nil {
+			checks++
+		}
+	}
+	if checks != 2 {
+		t.Errorf("expected 2 observed calls of the check, got %d", checks)
+	}
+}
+
+// recordingObserver is an Observer keeping all the events.
+type recordingObserver struct {
+	mu sync.Mutex
+	es []DetectorEvent
+}
+
+func (o *recordingObserver) ObserveDetector(e DetectorEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.es = append(o.es, e)
+}
+
+func (o *recordingObserver) events() []DetectorEvent {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]DetectorEvent(nil), o.es...)
+}
+
+// removeExtension undoes the Extend call which added mime under m, so that
+// the MIME types made up by a test do not leak into the others.
+func removeExtension(m *MIME, mime string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, c := range m.children {
+		if c.mime == mime {
+			m.children = append(m.children[:i:i], m.children[i+1:]...)
+			break
+		}
+	}
+	atomic.AddUint64(&treeGeneration, 1)
+}
+
+// FuzzDetectors calls each detector and each check of MIME parameters
+// directly, so that panics are not recovered, with inputs seeded from all the
+// test files and various limits.
+func FuzzDetectors(f *testing.F) {
+	for fName := range files {
+		data, err := os.ReadFile(filepath.Join(testDataDir, fName))
+		if err != nil {
+			f.Fatal(err)
+		}
+		if len(data) > 1024 {
+			data = data[:1024]
+		}
+		f.Add(data, uint32(len(data)))
+		f.Add(data, uint32(len(data)/2))
+	}
+	detectors := root.flatten()[1:]
+	f.Fuzz(func(t *testing.T, data []byte, limit uint32) {
+		for _, d := range detectors {
+			d.detector(data, limit)
+			d.detector(data, 0)
+		}
+		// The checks of MIME parameters run on the inputs of any detector.
+		for _, c := range needsCharset {
+			c(data)
+		}
+		for _, c := range encryptionChecks {
+			c(data)
+		}
+		for _, c := range macroChecks {
+			c(data)
+		}
+		pdfParams(data, map[string]string{})
+	})
+}
@@ -0,0 +1,135 @@
+// Package mimetypehttp provides net/http middleware which uses mimetype to
+// set the Content-Type of responses and to check the content of requests.
+package mimetypehttp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// sniffLen is the number of bytes buffered before detecting the MIME type of
+// a response. It is the same as the default read limit of mimetype.
+const sniffLen = 3072
+
+// Handler returns a handler which sets the Content-Type header of the
+// responses written by h, when h does not set it.
+//
+// The first bytes written by h are buffered, together with the status code,
+// until enough data is available for detection, until h flushes the response
+// or until h returns. Responses with a Content-Encoding header are not sniffed,
+// because their body is not the content itself. To prevent the detection for
+// a response, h can set the Content-Type header to nil.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &sniffWriter{ResponseWriter: w}
+		defer sw.commit()
+		h.ServeHTTP(sw, r)
+	})
+}
+
+// sniffWriter buffers the beginning of a response until its MIME type can be
+// detected.
+type sniffWriter struct {
+	http.ResponseWriter
+	buf bytes.Buffer
+	// status is the code passed to WriteHeader, 0 when not called yet.
+	status int
+	// committed is true after the header was written to the ResponseWriter.
+	committed bool
+}
+
+func (w *sniffWriter) WriteHeader(code int) {
+	if w.committed || w.status != 0 {
+		return
+	}
+	// Informational responses are sent right away and do not end the header.
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+	if !bodyAllowed(code) {
+		w.commit()
+	}
+}
+
+func (w *sniffWriter) Write(p []byte) (int, error) {
+	if w.committed {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n := sniffLen - w.buf.Len()
+	if len(p) < n {
+		return w.buf.Write(p)
+	}
+
+	w.buf.Write(p[:n])
+	if err := w.commit(); err != nil {
+		return 0, err
+	}
+	m, err := w.ResponseWriter.Write(p[n:])
+	return n + m, err
+}
+
+// commit sets the Content-Type header, if needed, and writes the header and the
+// buffered data to the underlying ResponseWriter.
+func (w *sniffWriter) commit() error {
+	if w.committed {
+		return nil
+	}
+	w.committed = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	h := w.Header()
+	_, hasType := h["Content-Type"]
+	if !hasType && h.Get("Content-Encoding") == "" && w.buf.Len() > 0 && bodyAllowed(w.status) {
+		h.Set("Content-Type", mimetype.Detect(w.buf.Bytes()).String())
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+
+	return err
+}
+
+// Flush sends the buffered data to the client, even if the MIME type is
+// detected from fewer bytes than usual.
+func (w *sniffWriter) Flush() {
+	w.commit()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection, as in http.Hijacker.
+func (w *sniffWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("mimetypehttp: ResponseWriter does not implement http.Hijacker")
+	}
+	w.committed = true
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying ResponseWriter, for use by http.ResponseController.
+func (w *sniffWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// bodyAllowed reports whether a response with the status code can have a body.
+func bodyAllowed(code int) bool {
+	return code != http.StatusNoContent && code != http.StatusNotModified &&
+		(code < 100 || code > 199)
+}
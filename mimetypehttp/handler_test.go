@@ -0,0 +1,129 @@
+package mimetypehttp
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	png, err := os.ReadFile("../testdata/png.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := append([]byte("%PDF-"), bytes.Repeat([]byte{'a'}, 2*sniffLen)...)
+
+	tcases := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		cType   string
+		body    []byte
+	}{{
+		name: "small write",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Write(png)
+		},
+		status: http.StatusOK,
+		cType:  "image/png",
+		body:   png,
+	}, {
+		name: "many small writes",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			for _, b := range big {
+				w.Write([]byte{b})
+			}
+		},
+		status: http.StatusOK,
+		cType:  "application/pdf",
+		body:   big,
+	}, {
+		name: "write larger than the buffer",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Write(big)
+		},
+		status: http.StatusOK,
+		cType:  "application/pdf",
+		body:   big,
+	}, {
+		name: "status kept",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"a":1}`))
+		},
+		status: http.StatusCreated,
+		cType:  "application/json",
+		body:   []byte(`{"a":1}`),
+	}, {
+		name: "Content-Type set by handler",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(png)
+		},
+		status: http.StatusOK,
+		cType:  "text/plain",
+		body:   png,
+	}, {
+		name: "Content-Encoding set by handler",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "identity")
+			w.Write(png)
+		},
+		status: http.StatusOK,
+		cType:  "",
+		body:   png,
+	}, {
+		name: "no content",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		},
+		status: http.StatusNoContent,
+		cType:  "",
+		body:   nil,
+	}, {
+		name: "flush before enough data",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<html>"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("%PDF-"))
+		},
+		status: http.StatusOK,
+		cType:  "text/html; charset=utf-8",
+		body:   []byte("<html>%PDF-"),
+	}}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Handler(tc.handler).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+			if rec.Code != tc.status {
+				t.Errorf("status: got %d, want %d", rec.Code, tc.status)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tc.cType {
+				t.Errorf("Content-Type: got %q, want %q", got, tc.cType)
+			}
+			if !bytes.Equal(rec.Body.Bytes(), tc.body) {
+				t.Errorf("body: got %d bytes, want %d bytes", rec.Body.Len(), len(tc.body))
+			}
+		})
+	}
+}
+
+func TestHandlerServer(t *testing.T) {
+	s := httptest.NewServer(Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("GIF89a"))
+	})))
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if got := res.Header.Get("Content-Type"); got != "image/gif" {
+		t.Errorf("Content-Type: got %q, want %q", got, "image/gif")
+	}
+}
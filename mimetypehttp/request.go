@@ -0,0 +1,123 @@
+package mimetypehttp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// RequireTypes returns a handler which detects the MIME type of request bodies
+// and calls next only when the detected type is one of allowed.
+//
+// For multipart/form-data requests, the content of each file part is checked
+// instead of the body as a whole; form fields without a filename are not
+// checked. Requests with an empty body are passed to next unchanged.
+//
+// Requests with a disallowed body are rejected with 415 Unsupported Media
+// Type and malformed multipart bodies with 400 Bad Request. The bytes read for
+// detection are kept in memory and handed to next together with the rest of
+// the body, so next reads the full body as sent by the client. Multipart
+// bodies are read entirely before next is called; use http.MaxBytesHandler to
+// bound their size, in which case oversized requests are rejected with 413
+// Request Entity Too Large.
+func RequireTypes(next http.Handler, allowed ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var head bytes.Buffer
+		tee := io.TeeReader(r.Body, &head)
+		var ok bool
+		var err error
+		if boundary, isMultipart := formBoundary(r); isMultipart {
+			ok, err = checkParts(tee, boundary, allowed)
+		} else {
+			ok, err = checkBody(tee, allowed)
+		}
+
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxErr):
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		case !ok:
+			http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		r.Body = &replayBody{Reader: io.MultiReader(&head, r.Body), Closer: r.Body}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// replayBody serves the bytes already read for detection before the rest of
+// the original request body.
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// formBoundary returns the boundary of multipart/form-data requests.
+func formBoundary(r *http.Request) (string, bool) {
+	mediatype, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediatype != "multipart/form-data" || params["boundary"] == "" {
+		return "", false
+	}
+	return params["boundary"], true
+}
+
+// checkBody reports whether the content read from r is one of allowed.
+// Empty content is always allowed.
+func checkBody(r io.Reader, allowed []string) (bool, error) {
+	// Read one byte first to tell empty bodies apart.
+	var first [1]byte
+	n, err := io.ReadFull(r, first[:])
+	if n == 0 {
+		if err == io.EOF {
+			return true, nil
+		}
+		return false, err
+	}
+
+	m, err := mimetype.DetectReader(io.MultiReader(bytes.NewReader(first[:]), r))
+	if err != nil {
+		return false, err
+	}
+	return mimetype.EqualsAny(m.String(), allowed...), nil
+}
+
+// checkParts reports whether the content of every file in the multipart body
+// read from r is one of allowed. All parts are consumed, so the whole body
+// goes through r.
+func checkParts(r io.Reader, boundary string, allowed []string) (bool, error) {
+	mr := multipart.NewReader(r, boundary)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if p.FileName() == "" {
+			continue
+		}
+		m, err := mimetype.DetectReader(p)
+		if err != nil {
+			return false, err
+		}
+		if !mimetype.EqualsAny(m.String(), allowed...) {
+			return false, nil
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package mimetypehttp
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRequireTypes(t *testing.T) {
+	png, err := os.ReadFile("../testdata/png.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf, err := os.ReadFile("../testdata/pdf.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := append(append([]byte{}, png...), bytes.Repeat([]byte{0}, 10000)...)
+
+	type file struct {
+		field, name string
+		content     []byte
+	}
+	form := func(files ...file) (string, []byte) {
+		b := &bytes.Buffer{}
+		mw := multipart.NewWriter(b)
+		mw.WriteField("title", "not a file")
+		for _, f := range files {
+			fw, _ := mw.CreateFormFile(f.field, f.name)
+			fw.Write(f.content)
+		}
+		mw.Close()
+		return mw.FormDataContentType(), b.Bytes()
+	}
+	okType, okBody := form(file{"a", "a.png", png}, file{"b", "b.png", big})
+	badType, badBody := form(file{"a", "a.png", png}, file{"b", "b.pdf", pdf})
+
+	tcases := []struct {
+		name   string
+		cType  string
+		body   []byte
+		status int
+	}{
+		{"allowed body", "", png, http.StatusOK},
+		{"allowed large body", "", big, http.StatusOK},
+		{"disallowed body", "", pdf, http.StatusUnsupportedMediaType},
+		{"empty body", "", nil, http.StatusOK},
+		{"allowed multipart", okType, okBody, http.StatusOK},
+		{"disallowed multipart", badType, badBody, http.StatusUnsupportedMediaType},
+		{"malformed multipart", okType, okBody[:len(okBody)/2], http.StatusBadRequest},
+		{"multipart without boundary", "multipart/form-data", okBody, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []byte
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = io.ReadAll(r.Body)
+			})
+			var body io.Reader
+			if tc.body != nil {
+				body = bytes.NewReader(tc.body)
+			}
+			req := httptest.NewRequest("POST", "/", body)
+			if tc.cType != "" {
+				req.Header.Set("Content-Type", tc.cType)
+			}
+			rec := httptest.NewRecorder()
+			RequireTypes(next, "image/png").ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("status: got %d, want %d", rec.Code, tc.status)
+			}
+			if tc.status == http.StatusOK && !bytes.Equal(got, tc.body) {
+				t.Errorf("forwarded body: got %d bytes, want %d bytes", len(got), len(tc.body))
+			}
+		})
+	}
+}
+
+func TestRequireTypesParseForm(t *testing.T) {
+	png, err := os.ReadFile("../testdata/png.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	mw := multipart.NewWriter(b)
+	fw, _ := mw.CreateFormFile("upload", "a.png")
+	fw.Write(png)
+	mw.WriteField("title", "image")
+	mw.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.FormValue("title"); got != "image" {
+			t.Errorf("title: got %q, want %q", got, "image")
+		}
+		f, _, err := r.FormFile("upload")
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(f)
+		if !bytes.Equal(content, png) {
+			t.Errorf("upload: got %d bytes, want %d bytes", len(content), len(png))
+		}
+	})
+	req := httptest.NewRequest("POST", "/", b)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	RequireTypes(next, "image/png").ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status: got %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestRequireTypesMaxBytes(t *testing.T) {
+	b := &bytes.Buffer{}
+	mw := multipart.NewWriter(b)
+	fw, _ := mw.CreateFormFile("upload", "a.txt")
+	fw.Write([]byte(strings.Repeat("a", 1000)))
+	mw.Close()
+
+	h := http.MaxBytesHandler(RequireTypes(http.NotFoundHandler(), "text/plain"), 100)
+	req := httptest.NewRequest("POST", "/", b)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status: got %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
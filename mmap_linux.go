@@ -0,0 +1,47 @@
+package mimetype
+
+import (
+	"os"
+	"runtime/debug"
+	"syscall"
+)
+
+// detectMmap detects the MIME type of f using a read-only memory mapping of
+// its first limit bytes, or of the whole file when limit is 0. It returns false
+// when f cannot be mapped, in which case f must be read instead.
+func detectMmap(f *os.File, limit uint32) (m *MIME, ok bool) {
+	fi, err := f.Stat()
+	// Empty files cannot be mapped and other kinds of files have no fixed size.
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() == 0 {
+		return nil, false
+	}
+	size := fi.Size()
+	if limit > 0 && int64(limit) < size {
+		size = int64(limit)
+	}
+	if int64(int(size)) != size {
+		return nil, false
+	}
+
+	in, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, false
+	}
+	defer syscall.Munmap(in)
+
+	// Reading pages of a file truncated by another process after it was mapped
+	// raises SIGBUS. Turn it into a recoverable panic and fall back to reading.
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if _, fault := r.(interface{ Addr() uintptr }); !fault {
+				panic(r)
+			}
+			m, ok = nil, false
+		}
+	}()
+
+	mu.RLock()
+	defer mu.RUnlock()
+	return root.match(in, limit), true
+}
@@ -0,0 +1,50 @@
+package mimetype
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectFileMmapTruncated(t *testing.T) {
+	// The file is truncated while it is mapped, so reading its end raises
+	// SIGBUS. DetectFile must then read the file again, and not treat the
+	// fault as a panic of the detector.
+	page := os.Getpagesize()
+	path := filepath.Join(t.TempDir(), "a.gif")
+	in := append([]byte("GIF89a"), make([]byte, 3*page)...)
+	in[len(in)-1] = 1
+	if err := os.WriteFile(path, in, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gif.Extend(func(raw []byte, limit uint32) bool {
+		return len(raw) > 2*page
+	}, "image/x-big", ".big")
+	t.Cleanup(func() { removeExtension(gif, "image/x-big") })
+	gif.Extend(func(raw []byte, limit uint32) bool {
+		if len(raw) <= 2*page {
+			return false
+		}
+		if err := os.Truncate(path, 6); err != nil {
+			return false
+		}
+		return raw[len(raw)-1] == 1
+	}, "image/x-truncating", ".truncating")
+	t.Cleanup(func() { removeExtension(gif, "image/x-truncating") })
+
+	var handled []*DetectorPanicError
+	SetPanicHandler(func(err *DetectorPanicError) { handled = append(handled, err) })
+	defer SetPanicHandler(nil)
+	SetLimit(0)
+	defer SetLimit(defaultLimit)
+	SetMmap(true)
+	defer SetMmap(false)
+
+	if m, err := DetectFile(path); err != nil || m.String() != "image/gif" {
+		t.Errorf("got %s, err: %v, want image/gif", m, err)
+	}
+	if len(handled) != 0 {
+		t.Errorf("the fault was handled as a detector panic: %v", handled[0])
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package mimetype
+
+import "os"
+
+// detectMmap is not supported on this system, f is always read.
+func detectMmap(f *os.File, limit uint32) (*MIME, bool) {
+	return nil, false
+}
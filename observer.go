@@ -0,0 +1,184 @@
+package mimetype
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DetectorEvent describes one call of a detector, or of the check of a MIME
+// parameter.
+type DetectorEvent struct {
+	// MIME is the MIME type the detector is for.
+	MIME string
+	// Node is the node of the MIME type hierarchy the detector belongs to, as
+	// returned by Types and Lookup. Nodes can share a MIME type, ex: JSON and
+	// HAR files are both application/json, and Node tells them apart.
+	Node *MIME
+	// Check is the MIME parameter checked, as in DetectorPanicError, or empty
+	// for detectors.
+	Check string
+	// InputLen is the length of the input passed to the detector.
+	InputLen int
+	// Duration is the time the detector took.
+	Duration time.Duration
+	// Matched is true when the input matched the detector.
+	Matched bool
+	// Err is a *DetectorPanicError when the detector panicked.
+	Err error
+}
+
+// Observer is notified of each detector call, from all detections.
+// ObserveDetector is called synchronously from the goroutine doing the
+// detection, so it must be fast and safe for concurrent use.
+type Observer interface {
+	ObserveDetector(DetectorEvent)
+}
+
+// observerBox lets observers of different types be stored in one atomic.Pointer.
+type observerBox struct{ o Observer }
+
+var observer atomic.Pointer[observerBox]
+
+// SetObserver sets the Observer notified of detector calls. A nil Observer
+// removes the previous one. Without an Observer, detectors are not timed.
+func SetObserver(o Observer) {
+	if o == nil {
+		observer.Store(nil)
+		return
+	}
+	observer.Store(&observerBox{o})
+}
+
+func loadObserver() Observer {
+	if b := observer.Load(); b != nil {
+		return b.o
+	}
+	return nil
+}
+
+// DefaultBuckets are the upper bounds of the duration histogram buckets used
+// by NewMetrics when none are given.
+var DefaultBuckets = []time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// Metrics is an Observer which aggregates detector calls in memory, so that
+// they can be exported to a metrics system.
+type Metrics struct {
+	buckets []time.Duration
+	mu      sync.Mutex
+	stats   map[statsKey]*DetectorStats
+}
+
+// statsKey identifies a detector, or the check of a MIME parameter.
+type statsKey struct {
+	node        *MIME
+	mime, check string
+}
+
+// DetectorStats holds the aggregated calls of one detector, or of the check
+// of one MIME parameter.
+type DetectorStats struct {
+	// MIME is the MIME type the detector is for.
+	MIME string
+	// Node is the node the detector belongs to, as in DetectorEvent. The
+	// detectors of nodes sharing a MIME type have separate statistics.
+	Node *MIME
+	// Check is the MIME parameter checked, as in DetectorEvent.
+	Check string
+	// Calls, Matches and Panics count the detector calls, the calls which
+	// matched the input and the calls which panicked.
+	Calls, Matches, Panics uint64
+	// Bytes is the sum of the input lengths.
+	Bytes uint64
+	// Duration is the total time spent in the detector.
+	Duration time.Duration
+	// Buckets counts the calls by duration: Buckets[i] counts the calls which
+	// took at most Bounds[i] and more than Bounds[i-1]. The last bucket, with
+	// no bound, counts the slower calls.
+	Buckets []uint64
+	// Bounds are the upper bounds of the buckets.
+	Bounds []time.Duration
+}
+
+// NewMetrics returns a Metrics using the given, increasing, upper bounds for
+// its duration histograms, or DefaultBuckets when none are given.
+func NewMetrics(buckets ...time.Duration) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Metrics{
+		buckets: append([]time.Duration(nil), buckets...),
+		stats:   map[statsKey]*DetectorStats{},
+	}
+}
+
+// ObserveDetector implements Observer.
+func (m *Metrics) ObserveDetector(e DetectorEvent) {
+	i := sort.Search(len(m.buckets), func(i int) bool { return e.Duration <= m.buckets[i] })
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := statsKey{e.Node, e.MIME, e.Check}
+	s, ok := m.stats[k]
+	if !ok {
+		s = &DetectorStats{
+			MIME:    e.MIME,
+			Node:    e.Node,
+			Check:   e.Check,
+			Buckets: make([]uint64, len(m.buckets)+1),
+			Bounds:  m.buckets,
+		}
+		m.stats[k] = s
+	}
+	s.Calls++
+	if e.Matched {
+		s.Matches++
+	}
+	if e.Err != nil {
+		s.Panics++
+	}
+	s.Bytes += uint64(e.InputLen)
+	s.Duration += e.Duration
+	s.Buckets[i]++
+}
+
+// Snapshot returns a copy of the statistics of all the detectors called so
+// far, sorted by total duration, slowest first.
+func (m *Metrics) Snapshot() []DetectorStats {
+	m.mu.Lock()
+	out := make([]DetectorStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		c := *s
+		c.Buckets = append([]uint64(nil), s.Buckets...)
+		c.Bounds = append([]time.Duration(nil), s.Bounds...)
+		out = append(out, c)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Duration != out[j].Duration {
+			return out[i].Duration > out[j].Duration
+		}
+		if out[i].MIME != out[j].MIME {
+			return out[i].MIME < out[j].MIME
+		}
+		return out[i].Check < out[j].Check
+	})
+
+	return out
+}
+
+// Reset discards all the statistics.
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats = map[statsKey]*DetectorStats{}
+}
@@ -0,0 +1,103 @@
+package mimetype
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	SetObserver(m)
+	defer SetObserver(nil)
+
+	for i := 0; i < 3; i++ {
+		Detect([]byte("GIF89a"))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Detect([]byte("GIF89a"))
+		}()
+	}
+	wg.Wait()
+
+	stats := map[string]DetectorStats{}
+	for _, s := range m.Snapshot() {
+		stats[s.MIME] = s
+		var inBuckets uint64
+		for _, b := range s.Buckets {
+			inBuckets += b
+		}
+		if inBuckets != s.Calls || len(s.Buckets) != len(DefaultBuckets)+1 {
+			t.Errorf("%s: %d calls, but %d in %d buckets", s.MIME, s.Calls, inBuckets, len(s.Buckets))
+		}
+	}
+	if s := stats["image/gif"]; s.Calls != 7 || s.Matches != 7 || s.Bytes != 7*6 {
+		t.Errorf("image/gif: got %+v", s)
+	}
+	// png is checked before gif and never matches.
+	if s := stats["image/png"]; s.Calls != 7 || s.Matches != 0 {
+		t.Errorf("image/png: got %+v", s)
+	}
+	if _, ok := stats["text/plain"]; ok {
+		t.Errorf("text/plain is checked after image/gif and must not be called")
+	}
+
+	SetObserver(nil)
+	Detect([]byte("GIF89a"))
+	for _, s := range m.Snapshot() {
+		if s.MIME == "image/gif" && s.Calls != 7 {
+			t.Errorf("detectors observed after SetObserver(nil)")
+		}
+	}
+
+	m.Reset()
+	if len(m.Snapshot()) != 0 {
+		t.Errorf("expected no statistics after Reset")
+	}
+}
+
+func TestMetricsBuckets(t *testing.T) {
+	m := NewMetrics(time.Millisecond, time.Second)
+	for _, d := range []time.Duration{0, time.Millisecond, 2 * time.Millisecond, time.Minute} {
+		m.ObserveDetector(DetectorEvent{MIME: "a/b", Duration: d})
+	}
+	s := m.Snapshot()
+	if len(s) != 1 {
+		t.Fatalf("expected 1 detector, got %d", len(s))
+	}
+	want := []uint64{2, 1, 1}
+	for i := range want {
+		if s[0].Buckets[i] != want[i] {
+			t.Errorf("buckets: got %v, want %v", s[0].Buckets, want)
+			break
+		}
+	}
+}
+
+func TestMetricsSharedMIME(t *testing.T) {
+	m := NewMetrics()
+	SetObserver(m)
+	defer SetObserver(nil)
+
+	// har is a child of json, both with the application/json MIME type.
+	Detect([]byte(`{"log": 1}`))
+	byNode := map[*MIME]DetectorStats{}
+	for _, s := range m.Snapshot() {
+		if s.MIME == "application/json" && s.Check == "" {
+			byNode[s.Node] = s
+		}
+	}
+	if len(byNode) != 2 {
+		t.Fatalf("expected 2 application/json detectors, got %d", len(byNode))
+	}
+	if s := byNode[json]; s.Calls != 1 || s.Matches != 1 {
+		t.Errorf("json: got %+v", s)
+	}
+	if s := byNode[har]; s.Calls != 1 || s.Matches != 0 {
+		t.Errorf("har: got %+v", s)
+	}
+}
@@ -0,0 +1,97 @@
+package mimetype
+
+import (
+	"mime"
+	"os"
+
+	"github.com/gabriel-vasile/mimetype/internal/magic"
+)
+
+// pdfParams adds to ps the MIME parameters describing the PDF file in: the
+// version from its header, the PDF/A, PDF/X and PDF/UA conformance claimed in
+// its XMP metadata, linearized=true for files optimized for the web and
+// active-content=true for files holding scripts, launch actions, embedded
+// files or actions run when the document is opened.
+func pdfParams(in []byte, ps map[string]string) {
+	if v := magic.PdfVersion(in); v != "" {
+		ps["version"] = v
+	}
+	pdfa, pdfx, pdfua := magic.PdfConformance(in)
+	for k, v := range map[string]string{"pdfa": pdfa, "pdfx": pdfx, "pdfua": pdfua} {
+		if v != "" {
+			ps[k] = v
+		}
+	}
+	if magic.PdfLinearized(in) {
+		ps["linearized"] = "true"
+	}
+	if magic.PdfActiveContent(in) {
+		ps["active-content"] = "true"
+	}
+}
+
+// pdfTailLen is the size of the end of PDF files read to find their trailer
+// and the offset of their last cross-reference section.
+const pdfTailLen = 1024
+
+// detectPdfTail checks the trailer of the PDF file f, larger than the read
+// limit l, for the encryption and the active content the start of f does not
+// show. The trailer is either at the end of f or, for cross-reference streams,
+// in the dictionary of the last cross-reference section. m, the MIME type
+// detected from the start of f, is returned with the encrypted=true and
+// active-content=true parameters when they apply. At most the tail limit t is
+// read for the end of f and for the last cross-reference section.
+func detectPdfTail(f *os.File, l, t uint32, m *MIME) *MIME {
+	if !m.Is("application/pdf") {
+		return m
+	}
+	_, old, err := mime.ParseMediaType(m.mime)
+	if err != nil || old["encrypted"] != "" && old["active-content"] != "" {
+		return m
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.Size() <= int64(l) {
+		return m
+	}
+	size := fi.Size()
+
+	max := int64(pdfTailLen)
+	if max > int64(t) {
+		max = int64(t)
+	}
+	n := max
+	if n > size {
+		n = size
+	}
+	tail := make([]byte, n)
+	if _, err := f.ReadAt(tail, size-n); err != nil {
+		return m
+	}
+	trailers := [][]byte{tail}
+	if off, ok := magic.PdfStartXref(tail); ok && off < size-n {
+		xn := size - off
+		if xn > max {
+			xn = max
+		}
+		xref := make([]byte, xn)
+		if _, err := f.ReadAt(xref, off); err != nil {
+			return m
+		}
+		trailers = append(trailers, xref)
+	}
+
+	ps := map[string]string{}
+	for _, t := range trailers {
+		if magic.PdfEncrypted(t) {
+			ps["encrypted"] = "true"
+		}
+		if magic.PdfActiveContent(t) {
+			ps["active-content"] = "true"
+		}
+	}
+	if len(ps) == 0 {
+		return m
+	}
+
+	return m.withParams(ps)
+}
@@ -0,0 +1,98 @@
+package mimetype
+
+import (
+	archivetar "archive/tar"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectFilePdfTail(t *testing.T) {
+	// The catalog and the trailer are past the read limit.
+	in := append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("%padding\n"), 1000)...)
+	in = append(in, "1 0 obj\n<< /Type /Catalog /OpenAction 3 0 R >>\nendobj\n"+
+		"trailer\n<< /Size 5 /Root 1 0 R /Encrypt 4 0 R >>\nstartxref\n9\n%%EOF\n"...)
+	path := filepath.Join(t.TempDir(), "f.pdf")
+	if err := os.WriteFile(path, in, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const want = "application/pdf; active-content=true; encrypted=true; version=1.7"
+	for _, mmap := range []bool{false, true} {
+		SetMmap(mmap)
+		if m, err := DetectFile(path); err != nil || m.String() != want {
+			t.Errorf("mmap %t: DetectFile: got %s, %v, want %s", mmap, m, err, want)
+		}
+	}
+	SetMmap(false)
+	if m := Detect(in); m.String() != "application/pdf; version=1.7" {
+		t.Errorf("Detect: got %s, want application/pdf; version=1.7", m)
+	}
+}
+
+func TestDetectPdfJunk(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+	for _, c := range []struct{ typ, data string }{
+		{"IHDR", "\x00\x00\x00\x01\x00\x00\x00\x01\x08\x00\x00\x00\x00"},
+		{"tEXt", "Comment\x00%PDF-1.4\n"},
+	} {
+		png = binary.BigEndian.AppendUint32(png, uint32(len(c.data)))
+		chunk := append([]byte(c.typ), c.data...)
+		png = append(png, chunk...)
+		png = binary.BigEndian.AppendUint32(png, crc32.ChecksumIEEE(chunk))
+	}
+
+	tarBuf := &bytes.Buffer{}
+	tw := archivetar.NewWriter(tarBuf)
+	pdf := []byte("%PDF-1.7\n%%EOF\n")
+	if err := tw.WriteHeader(&archivetar.Header{Name: "a.pdf", Mode: 0644, Size: int64(len(pdf))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(pdf); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tcases := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"html", []byte("<html><body>Save as %PDF-1.4 file</body></html>"), "text/html; charset=utf-8"},
+		{"png", png, "image/png"},
+		{"gif", []byte("GIF89a\n%PDF-1.4\n"), "image/gif"},
+		{"json", []byte(`{"magic": "%PDF-"}`), "application/json"},
+		{"shell", []byte("#!/bin/sh\ngrep -l '%PDF-' *\n"), "text/x-shellscript"},
+		{"text", []byte("files start with %PDF-1.4 or %PDF-1.7"), "text/plain; charset=utf-8"},
+		{"tar", tarBuf.Bytes(), "application/x-tar"},
+		{"junk", []byte("Content-Type: application/pdf\r\n\r\n%PDF-1.7\n%%EOF\n"), "application/pdf; version=1.7"},
+	}
+	for _, tc := range tcases {
+		if m := Detect(tc.in); m.String() != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, m, tc.want)
+		}
+	}
+
+	n := 0
+	for _, m := range Types() {
+		if m.Is("application/pdf") {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("Types lists application/pdf %d times, want once", n)
+	}
+	// The fuzz tests check the detectors of all the nodes.
+	found := false
+	for _, m := range root.flatten() {
+		found = found || m == pdfJunk
+	}
+	if !found {
+		t.Errorf("the junk PDF detector is not in the flattened tree")
+	}
+}
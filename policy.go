@@ -0,0 +1,186 @@
+package mimetype
+
+import (
+	"fmt"
+	"io"
+	"mime"
+)
+
+// Action is the decision a Policy takes for a MIME type.
+type Action uint8
+
+const (
+	// Deny rejects the MIME type.
+	Deny Action = iota
+	// Allow accepts the MIME type.
+	Allow
+)
+
+// String returns the name of the action.
+func (a Action) String() string {
+	if a == Allow {
+		return "allow"
+	}
+	return "deny"
+}
+
+// Category groups file formats by the risk they pose when accepted from
+// untrusted sources.
+type Category uint8
+
+const (
+	// CategoryExecutable holds native and bytecode executables, ex: PE
+	// executables, ELF and Mach-O binaries, Java classes.
+	CategoryExecutable Category = iota + 1
+	// CategoryScript holds scripts recognized by their interpreter, ex: PHP,
+	// Python, Perl, Node.js or shell scripts starting with a shebang line.
+	CategoryScript
+	// CategoryInstaller holds software packages and installers, ex: MSI, RPM
+	// and Debian packages.
+	CategoryInstaller
+)
+
+// String returns the name of the category.
+func (c Category) String() string {
+	switch c {
+	case CategoryExecutable:
+		return "executable"
+	case CategoryScript:
+		return "script"
+	case CategoryInstaller:
+		return "installer"
+	default:
+		return fmt.Sprintf("Category(%d)", c)
+	}
+}
+
+// categories holds the nodes belonging to each category.
+var categories = map[Category][]*MIME{
+	CategoryExecutable: {exe, elf, elfObj, elfExe, elfLib, macho, class, wasm},
+	CategoryScript:     {php, js, lua, perl, python, tcl, shell},
+	CategoryInstaller:  {msi, rpm, deb, cabIS},
+}
+
+// Rule targets a set of MIME types with an Action. A rule matches when all its
+// non-empty targets match the detected MIME type. A rule with no targets
+// matches any MIME type.
+type Rule struct {
+	Action Action
+	// Type matches a MIME type, or any of its aliases.
+	Type string
+	// Subtree matches a MIME type and all its descendants from the hierarchy.
+	// For example, application/zip matches zip archives, docx, jar, epub, etc.
+	Subtree string
+	// Category matches all the MIME types in a risk category, and their
+	// descendants from the hierarchy.
+	Category Category
+}
+
+// matches reports whether r targets the detected MIME type.
+func (r *Rule) matches(detected *MIME) bool {
+	if r.Type != "" && !detected.Is(r.Type) {
+		return false
+	}
+	if r.Subtree != "" && !inSubtree(detected, r.Subtree) {
+		return false
+	}
+	if r.Category != 0 && !inCategory(detected, r.Category) {
+		return false
+	}
+
+	return true
+}
+
+func inSubtree(detected *MIME, subtree string) bool {
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Is(subtree) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func inCategory(detected *MIME, c Category) bool {
+	for m := detected; m != nil; m = m.Parent() {
+		for _, n := range categories[c] {
+			if m.Is(n.mime) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Policy decides whether content is accepted based on its detected MIME type.
+// Rules are evaluated in order and the first matching rule decides the action.
+// When no rule matches, the default action is taken.
+//
+// A Policy is safe for concurrent use.
+type Policy struct {
+	rules []Rule
+	def   Action
+}
+
+// Decision is the result of checking content against a Policy.
+type Decision struct {
+	Action Action
+	// MIME is the MIME type detected from the content.
+	MIME *MIME
+	// Rule is the rule which decided the action. It is nil when no rule matched
+	// and the default action was taken.
+	Rule *Rule
+}
+
+// NewPolicy returns a Policy which evaluates rules in order and takes the def
+// action when no rule matches. An error is returned for rules targeting
+// malformed MIME types or unknown categories.
+func NewPolicy(def Action, rules ...Rule) (*Policy, error) {
+	for i, r := range rules {
+		for _, s := range []string{r.Type, r.Subtree} {
+			if s == "" {
+				continue
+			}
+			if _, _, err := mime.ParseMediaType(s); err != nil {
+				return nil, fmt.Errorf("mimetype: rule %d: %w", i, err)
+			}
+		}
+		if _, ok := categories[r.Category]; r.Category != 0 && !ok {
+			return nil, fmt.Errorf("mimetype: rule %d: unknown category %s", i, r.Category)
+		}
+	}
+
+	return &Policy{
+		rules: append([]Rule(nil), rules...),
+		def:   def,
+	}, nil
+}
+
+// Check detects the MIME type of in and decides whether it is accepted.
+func (p *Policy) Check(in []byte) Decision {
+	return p.CheckMIME(Detect(in))
+}
+
+// CheckReader detects the MIME type of r and decides whether it is accepted.
+// Any error returned is related to the reading from r, in which case the
+// content is denied.
+func (p *Policy) CheckReader(r io.Reader) (Decision, error) {
+	m, err := DetectReader(r)
+	if err != nil {
+		return Decision{Action: Deny, MIME: m}, err
+	}
+
+	return p.CheckMIME(m), nil
+}
+
+// CheckMIME decides whether an already detected MIME type is accepted.
+func (p *Policy) CheckMIME(m *MIME) Decision {
+	for _, r := range p.rules {
+		if r.matches(m) {
+			return Decision{Action: r.Action, MIME: m, Rule: &r}
+		}
+	}
+
+	return Decision{Action: p.def, MIME: m}
+}
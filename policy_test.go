@@ -0,0 +1,110 @@
+package mimetype
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	p, err := NewPolicy(Deny,
+		Rule{Action: Deny, Category: CategoryExecutable},
+		Rule{Action: Deny, Category: CategoryScript},
+		Rule{Action: Deny, Category: CategoryInstaller},
+		Rule{Action: Deny, Type: "application/vnd.ms-excel"},
+		Rule{Action: Allow, Subtree: "application/x-ole-storage"},
+		Rule{Action: Allow, Subtree: "application/zip"},
+		Rule{Action: Deny, Subtree: "text/plain", Type: "text/html"},
+		Rule{Action: Allow, Subtree: "text/plain"},
+		Rule{Action: Allow, Type: "image/jpeg"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		file   string
+		action Action
+		// rule is the index of the deciding rule, -1 for the default action.
+		rule int
+	}{
+		{"exe.exe", Deny, 0},
+		{"ln", Deny, 0},
+		{"macho.macho", Deny, 0},
+		{"class.class", Deny, 0},
+		{"py.py", Deny, 1},
+		{"php.php", Deny, 1},
+		{"sh.sh", Deny, 1},
+		{"msi.msi", Deny, 2},
+		{"deb.deb", Deny, 2},
+		{"rpm.rpm", Deny, 2},
+		{"xls.xls", Deny, 3},
+		{"doc.doc", Allow, 4},
+		{"ppt.ppt", Allow, 4},
+		{"docx.docx", Allow, 5},
+		{"zip.zip", Allow, 5},
+		{"html.html", Deny, 6},
+		{"csv.csv", Allow, 7},
+		{"utf8.txt", Allow, 7},
+		{"jpg.jpg", Allow, 8},
+		{"png.png", Deny, -1},
+	}
+	for _, tc := range testCases {
+		in, err := os.ReadFile(filepath.Join(testDataDir, tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := p.Check(in)
+		if d.Action != tc.action {
+			t.Errorf("%s: expected: %s, got: %s", tc.file, tc.action, d.Action)
+		}
+		if tc.rule == -1 && d.Rule != nil {
+			t.Errorf("%s: expected default action, got rule: %+v", tc.file, *d.Rule)
+		}
+		if tc.rule != -1 && (d.Rule == nil || *d.Rule != p.rules[tc.rule]) {
+			t.Errorf("%s: expected rule: %+v, got: %+v", tc.file, p.rules[tc.rule], d.Rule)
+		}
+
+		dr, err := p.CheckReader(bytes.NewReader(in))
+		if err != nil || dr.Action != d.Action || dr.MIME.String() != d.MIME.String() {
+			t.Errorf("%s: CheckReader and Check disagree: %+v, %+v, %v", tc.file, dr, d, err)
+		}
+	}
+}
+
+func TestPolicyCategoryDescendants(t *testing.T) {
+	python.Extend(func(raw []byte, limit uint32) bool {
+		return bytes.Contains(raw, []byte("import django"))
+	}, "text/x-django", ".django")
+	t.Cleanup(func() { removeExtension(python, "text/x-django") })
+
+	p, err := NewPolicy(Allow, Rule{Action: Deny, Category: CategoryScript})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := p.Check([]byte("#!/usr/bin/env python\nimport django\n"))
+	if !d.MIME.Is("text/x-django") || d.Action != Deny {
+		t.Errorf("a child of a script must be in its category, got %s for %s", d.Action, d.MIME)
+	}
+}
+
+func TestNewPolicyErrors(t *testing.T) {
+	for _, r := range []Rule{
+		{Type: "not a mime"},
+		{Subtree: "text/plain;;"},
+		{Category: 100},
+	} {
+		if _, err := NewPolicy(Allow, r); err == nil {
+			t.Errorf("NewPolicy(%+v) should fail", r)
+		}
+	}
+	// A rule without targets matches everything.
+	p, err := NewPolicy(Deny, Rule{Action: Allow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := p.Check([]byte("anything")); d.Action != Allow || d.Rule == nil {
+		t.Errorf("catch-all rule should allow, got: %+v", d)
+	}
+}
@@ -0,0 +1,214 @@
+package mimetype
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// SymlinkPolicy tells DetectFS and DetectDir what to do with symbolic links.
+type SymlinkPolicy uint8
+
+const (
+	// SymlinkSkip ignores symbolic links.
+	SymlinkSkip SymlinkPolicy = iota
+	// SymlinkFollow detects the files symbolic links point to. Directories
+	// reached through symbolic links are not walked, which avoids cycles.
+	SymlinkFollow
+)
+
+// ScanOptions configures DetectFS and DetectDir. The zero value is ready to use.
+type ScanOptions struct {
+	// Context stops the scan when done. A nil Context never stops the scan.
+	Context context.Context
+	// Workers is the number of files detected concurrently. Values lower than
+	// 1 mean runtime.GOMAXPROCS(0).
+	Workers int
+	// Include, when not empty, limits the scan to files matching one of the
+	// patterns. Exclude skips the files, and the directories with all their
+	// content, matching one of the patterns. The patterns use the syntax of
+	// path.Match. Patterns containing a slash are matched against the whole
+	// slash separated path, the others only against the last element.
+	Include, Exclude []string
+	// Symlinks tells what to do with symbolic links.
+	Symlinks SymlinkPolicy
+}
+
+// Result is the outcome of detecting the MIME type of one file during a scan.
+type Result struct {
+	// Path of the file: a path of the scanned fs.FS for DetectFS, or a path of
+	// the operating system for DetectDir.
+	Path string
+	// Size of the file, in bytes.
+	Size int64
+	// MIME is the detected MIME type, nil when Err is not nil.
+	MIME *MIME
+	// Err holds the error which prevented the detection.
+	Err error
+}
+
+// DetectFS walks the file tree of fsys rooted at root and detects the MIME
+// type of each regular file, using a bounded pool of goroutines. Any fs.FS can
+// be scanned, such as embed.FS, *zip.Reader or the result of os.DirFS.
+//
+// Results are sent in no particular order on the returned channel, which is
+// closed once the scan is complete or its context is done. Errors opening or
+// reading a file, or listing a directory, are sent as results with a non-nil
+// Err and do not stop the scan. Callers must receive all the results or
+// cancel the context, otherwise the scan blocks forever.
+func DetectFS(fsys fs.FS, root string, opts ScanOptions) <-chan Result {
+	return detectFS(fsys, root, opts, func(p string) string { return p })
+}
+
+// DetectDir is like DetectFS, but it scans the directory dir of the operating
+// system. Result paths are joined with dir, as with filepath.Join. Files are
+// detected as with DetectFile.
+func DetectDir(dir string, opts ScanOptions) <-chan Result {
+	return detectFS(os.DirFS(dir), ".", opts, func(p string) string {
+		return filepath.Join(dir, filepath.FromSlash(p))
+	})
+}
+
+// detectFS implements DetectFS, using resultPath to turn the paths of fsys
+// into the paths reported in results.
+func detectFS(fsys fs.FS, root string, opts ScanOptions, resultPath func(string) string) <-chan Result {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	workers := opts.Workers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	type job struct {
+		path string
+		size int64
+	}
+	jobs := make(chan job)
+	results := make(chan Result)
+	send := func(r Result) {
+		r.Path = resultPath(r.Path)
+		select {
+		case results <- r:
+		case <-ctx.Done():
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				m, err := detectFSFile(fsys, j.path)
+				send(Result{Path: j.path, Size: j.size, MIME: m, Err: err})
+			}
+		}()
+	}
+
+	go func() {
+		defer func() {
+			close(jobs)
+			wg.Wait()
+			close(results)
+		}()
+		for _, patterns := range [][]string{opts.Include, opts.Exclude} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					send(Result{Path: root, Err: err})
+					return
+				}
+			}
+		}
+
+		fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return fs.SkipAll
+			}
+			if err != nil {
+				send(Result{Path: p, Err: err})
+				return nil
+			}
+			if p != root && matchAny(opts.Exclude, p) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || len(opts.Include) > 0 && !matchAny(opts.Include, p) {
+				return nil
+			}
+
+			var info fs.FileInfo
+			if d.Type()&fs.ModeSymlink != 0 {
+				if opts.Symlinks == SymlinkSkip {
+					return nil
+				}
+				info, err = fs.Stat(fsys, p)
+			} else {
+				info, err = d.Info()
+			}
+			if err != nil {
+				send(Result{Path: p, Err: err})
+				return nil
+			}
+			// Devices and named pipes could block forever when read.
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			select {
+			case jobs <- job{path: p, size: info.Size()}:
+			case <-ctx.Done():
+				return fs.SkipAll
+			}
+			return nil
+		})
+	}()
+
+	return results
+}
+
+func detectFSFile(fsys fs.FS, name string) (*MIME, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Files of the operating system, as opened by DetectDir, are detected like
+	// DetectFile does, which also reads the end of some formats.
+	if osf, ok := f.(*os.File); ok {
+		m, err := detectFile(osf)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	m, err := DetectReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// matchAny reports whether p matches any of the patterns.
+func matchAny(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		name := p
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(p)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
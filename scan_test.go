@@ -0,0 +1,181 @@
+package mimetype
+
+import (
+	archivezip "archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+// collect drains results into a map from path to MIME type, or to the error
+// prefixed with "error: ".
+func collect(t *testing.T, results <-chan Result) map[string]string {
+	t.Helper()
+	got := map[string]string{}
+	for r := range results {
+		if r.Err != nil {
+			got[r.Path] = "error: " + r.Err.Error()
+			continue
+		}
+		got[r.Path] = r.MIME.String()
+	}
+	return got
+}
+
+func TestDetectFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.json":          {Data: []byte(`{"a":1}`)},
+		"img/b.gif":       {Data: []byte("GIF89a")},
+		"img/c.png":       {Data: []byte("\x89PNG\x0d\x0a\x1a\x0a")},
+		"vendor/d.gif":    {Data: []byte("GIF89a")},
+		"docs/e.pdf":      {Data: []byte("%PDF-1.7")},
+		"docs/sub/f.html": {Data: []byte("<html>")},
+	}
+
+	tcases := []struct {
+		name string
+		root string
+		opts ScanOptions
+		want map[string]string
+	}{{
+		name: "all",
+		root: ".",
+		want: map[string]string{
+			"a.json":          "application/json",
+			"img/b.gif":       "image/gif",
+			"img/c.png":       "image/png",
+			"vendor/d.gif":    "image/gif",
+			"docs/e.pdf":      "application/pdf; version=1.7",
+			"docs/sub/f.html": "text/html; charset=utf-8",
+		},
+	}, {
+		name: "sub directory, one worker",
+		root: "docs",
+		opts: ScanOptions{Workers: 1},
+		want: map[string]string{
+			"docs/e.pdf":      "application/pdf; version=1.7",
+			"docs/sub/f.html": "text/html; charset=utf-8",
+		},
+	}, {
+		name: "include and exclude",
+		root: ".",
+		opts: ScanOptions{Include: []string{"*.gif", "docs/*/*"}, Exclude: []string{"vendor"}},
+		want: map[string]string{
+			"img/b.gif":       "image/gif",
+			"docs/sub/f.html": "text/html; charset=utf-8",
+		},
+	}, {
+		name: "bad pattern",
+		root: ".",
+		opts: ScanOptions{Exclude: []string{"["}},
+		want: map[string]string{
+			".": "error: syntax error in pattern",
+		},
+	}, {
+		name: "missing root",
+		root: "missing",
+		want: map[string]string{
+			"missing": "error: open missing: file does not exist",
+		},
+	}}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := collect(t, DetectFS(fsys, tc.root, tc.opts))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDetectFSZip(t *testing.T) {
+	b := &bytes.Buffer{}
+	zw := archivezip.NewWriter(b)
+	w, _ := zw.Create("dir/a.gif")
+	w.Write([]byte("GIF89a"))
+	w, _ = zw.Create("b.txt")
+	w.Write([]byte("text"))
+	zw.Close()
+
+	zr, err := archivezip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int64
+	for r := range DetectFS(zr, ".", ScanOptions{}) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		sizes = append(sizes, r.Size)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	if !reflect.DeepEqual(sizes, []int64{4, 6}) {
+		t.Errorf("sizes: got %v, want [4 6]", sizes)
+	}
+}
+
+func TestDetectDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.gif"), []byte("GIF89a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "a.gif"), filepath.Join(dir, "sub", "link.gif")); err != nil {
+		t.Skip("symbolic links not supported:", err)
+	}
+	if err := os.Symlink(dir, filepath.Join(dir, "sub", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := collect(t, DetectDir(dir, ScanOptions{}))
+	want := map[string]string{filepath.Join(dir, "a.gif"): "image/gif"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SymlinkSkip: got %v, want %v", got, want)
+	}
+
+	got = collect(t, DetectDir(dir, ScanOptions{Symlinks: SymlinkFollow}))
+	want[filepath.Join(dir, "sub", "link.gif")] = "image/gif"
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SymlinkFollow: got %v, want %v", got, want)
+	}
+}
+
+func TestDetectDirLikeDetectFile(t *testing.T) {
+	// The trailer of the PDF file is past the read limit, so it is only read
+	// by DetectFile.
+	dir := t.TempDir()
+	pdf := append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("%padding\n"), 1000)...)
+	pdf = append(pdf, "trailer\n<< /Size 5 /Root 1 0 R /Encrypt 4 0 R >>\nstartxref\n9\n%%EOF\n"...)
+	if err := os.WriteFile(filepath.Join(dir, "a.pdf"), pdf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := collect(t, DetectDir(dir, ScanOptions{}))
+	want := map[string]string{filepath.Join(dir, "a.pdf"): "application/pdf; encrypted=true; version=1.7"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDetectFSCancel(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		fsys[name] = &fstest.MapFile{Data: []byte(name)}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := DetectFS(fsys, ".", ScanOptions{Context: ctx, Workers: 1})
+	<-results
+	cancel()
+	// The channel must be closed after cancel, even if results are not received.
+	for range results {
+	}
+}
@@ -0,0 +1,66 @@
+package mimetype
+
+import "github.com/gabriel-vasile/mimetype/internal/mimesniff"
+
+// SniffContext is the context in which a browser uses a resource. Browsers
+// sniff the content of images, media files and fonts differently than the
+// content of documents opened in a tab.
+type SniffContext uint8
+
+const (
+	// SniffBrowsing is the context of documents opened in a browser tab.
+	SniffBrowsing = SniffContext(mimesniff.Browsing)
+	// SniffImage is the context of resources used as images, ex: <img src>.
+	SniffImage = SniffContext(mimesniff.Image)
+	// SniffAudioVideo is the context of resources used as media, ex: <video src>.
+	SniffAudioVideo = SniffContext(mimesniff.AudioVideo)
+	// SniffPlugin is the context of resources used by plugins, ex: <object data>.
+	SniffPlugin = SniffContext(mimesniff.Plugin)
+	// SniffStyle is the context of stylesheets.
+	SniffStyle = SniffContext(mimesniff.Style)
+	// SniffScript is the context of scripts.
+	SniffScript = SniffContext(mimesniff.Script)
+	// SniffFont is the context of resources used as fonts, ex: @font-face src.
+	SniffFont = SniffContext(mimesniff.Font)
+	// SniffTextTrack is the context of resources used as text tracks, ex: <track src>.
+	SniffTextTrack = SniffContext(mimesniff.TextTrack)
+	// SniffCacheManifest is the context of application cache manifests.
+	SniffCacheManifest = SniffContext(mimesniff.CacheManifest)
+)
+
+// SniffHTTP computes the MIME type of an HTTP resource the way browsers do,
+// following the WHATWG MIME Sniffing Standard: https://mimesniff.spec.whatwg.org/
+// Unlike Detect, which recognizes as many formats as possible, SniffHTTP
+// only recognizes the formats listed in the standard and most of the times
+// trusts the supplied MIME type.
+//
+// suppliedContentType is the Content-Type header of the HTTP response and
+// must be passed unmodified, because the standard checks its exact value.
+// noSniff is set when the response has the X-Content-Type-Options: nosniff header.
+// Only the first 1445 bytes of in are used, as required by the standard.
+//
+// The result is the supplied Content-Type when it is kept, including its
+// parameters, or the essence of the sniffed MIME type, ex: image/png.
+func SniffHTTP(in []byte, suppliedContentType string, noSniff bool) string {
+	if len(in) > mimesniff.HeaderLen {
+		in = in[:mimesniff.HeaderLen]
+	}
+
+	return mimesniff.Computed(in, mimesniff.Resource{
+		Supplied: suppliedContentType,
+		NoSniff:  noSniff,
+	})
+}
+
+// SniffHTTPContext is like SniffHTTP, but it computes the MIME type of a resource
+// used in the ctx context, ex: an image loaded with an <img> tag.
+// In the SniffBrowsing context it is equivalent to SniffHTTP with noSniff unset.
+func SniffHTTPContext(ctx SniffContext, in []byte, suppliedContentType string) string {
+	if len(in) > mimesniff.HeaderLen {
+		in = in[:mimesniff.HeaderLen]
+	}
+
+	return mimesniff.InContext(mimesniff.Context(ctx), in, mimesniff.Resource{
+		Supplied: suppliedContentType,
+	})
+}
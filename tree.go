@@ -25,8 +25,13 @@ var root = newMIME("application/octet-stream", "",
 	djvu, mobi, lit, bpg, sqlite3, dwg, nes, lnk, macho, qcp, icns, heic,
 	heicSeq, heif, heifSeq, hdr, mrc, mdb, accdb, zstd, cab, rpm, xz, lzip,
 	torrent, cpio, tzif, xcf, pat, gbr, glb, avif, cabIS, jxr,
+	// PDF files with junk before their header, once no other format matched.
+	pdfJunk,
 	// Keep text last because it is the slowest check
 	text,
+	// Special files are never detected from content, see DetectPath.
+	emptyFile, inodeDir, inodeSymlink, inodeFifo, inodeSocket, inodeCharDevice,
+	inodeBlockDevice,
 )
 
 // errMIME is returned from Detect functions when err is not nil.
@@ -34,34 +39,70 @@ var root = newMIME("application/octet-stream", "",
 // errMIME is same as root but it does not require locking.
 var errMIME = newMIME("application/octet-stream", "", func([]byte, uint32) bool { return false })
 
+// never is the detector of MIME types which are not detected from content.
+func never([]byte, uint32) bool { return false }
+
 // mu guards access to the root MIME tree. Access to root must be synchronized with this lock.
 var mu = &sync.RWMutex{}
 
+// treeGeneration is incremented on each change to the tree, so that cached
+// detection results can be discarded. See Cache.
+var treeGeneration uint64
+
 // The list of nodes appended to the root node.
 var (
-	xz   = newMIME("application/x-xz", ".xz", magic.Xz)
-	gzip = newMIME("application/gzip", ".gz", magic.Gzip).alias(
+	xz   = newMIME("application/x-xz", ".xz", magic.Xz, xzTar)
+	gzip = newMIME("application/gzip", ".gz", magic.Gzip, gzipTar).alias(
 		"application/x-gzip", "application/x-gunzip", "application/gzipped",
 		"application/gzip-compressed", "application/x-gzip-compressed",
 		"gzip/document")
 	sevenZ = newMIME("application/x-7z-compressed", ".7z", magic.SevenZ)
-	zip    = newMIME("application/zip", ".zip", magic.Zip, xlsx, docx, pptx, epub, jar, odt, ods, odp, odg, odf, odc, sxc).
+	zip    = newMIME("application/zip", ".zip", magic.Zip, xlsx, docx, pptx, xlsm, xltx, xltm,
+		xlsb, xlam, docm, dotx, dotm, pptm, potx, ppsx, ppsm, vsdx, oxps, epub, jar, odt, ods, odp, odg, odf, odc, odb, odi, sxc, sxw, sxi, sxd).
 		alias("application/x-zip", "application/x-zip-compressed")
 	tar = newMIME("application/x-tar", ".tar", magic.Tar)
-	xar = newMIME("application/x-xar", ".xar", magic.Xar)
-	bz2 = newMIME("application/x-bzip2", ".bz2", magic.Bz2)
-	pdf = newMIME("application/pdf", ".pdf", magic.Pdf).
+	// Compressed tar archives, with the names used by shared-mime-info.
+	gzipTar = newMIME("application/x-compressed-tar", ".tar.gz", magic.GzipTar)
+	xzTar   = newMIME("application/x-xz-compressed-tar", ".tar.xz", magic.XzTar)
+	zstdTar = newMIME("application/x-zstd-compressed-tar", ".tar.zst", magic.ZstdTar)
+	bz2Tar  = newMIME("application/x-bzip2-compressed-tar", ".tar.bz2", magic.Bz2Tar).
+		alias("application/x-bzip-compressed-tar")
+	lzipTar = newMIME("application/x-lzip-compressed-tar", ".tar.lz", magic.LzipTar)
+	xar     = newMIME("application/x-xar", ".xar", magic.Xar)
+	bz2     = newMIME("application/x-bzip2", ".bz2", magic.Bz2, bz2Tar)
+	pdf     = newMIME("application/pdf", ".pdf", magic.Pdf).
 		alias("application/x-pdf")
+	// pdfJunk stands for pdf at the end of the tree.
+	pdfJunk = newMIME("application/pdf", ".pdf", magic.PdfJunk).
+		alias("application/x-pdf").entryOf(pdf)
 	fdf  = newMIME("application/vnd.fdf", ".fdf", magic.Fdf)
 	xlsx = newMIME("application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx", magic.Xlsx)
 	docx = newMIME("application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx", magic.Docx)
 	pptx = newMIME("application/vnd.openxmlformats-officedocument.presentationml.presentation", ".pptx", magic.Pptx)
+	xlsm = newMIME("application/vnd.ms-excel.sheet.macroEnabled.12", ".xlsm", magic.Xlsm)
+	xltx = newMIME("application/vnd.openxmlformats-officedocument.spreadsheetml.template", ".xltx", magic.Xltx)
+	xltm = newMIME("application/vnd.ms-excel.template.macroEnabled.12", ".xltm", magic.Xltm)
+	xlsb = newMIME("application/vnd.ms-excel.sheet.binary.macroEnabled.12", ".xlsb", magic.Xlsb)
+	xlam = newMIME("application/vnd.ms-excel.addin.macroEnabled.12", ".xlam", magic.Xlam)
+	docm = newMIME("application/vnd.ms-word.document.macroEnabled.12", ".docm", magic.Docm)
+	dotx = newMIME("application/vnd.openxmlformats-officedocument.wordprocessingml.template", ".dotx", magic.Dotx)
+	dotm = newMIME("application/vnd.ms-word.template.macroEnabled.12", ".dotm", magic.Dotm)
+	pptm = newMIME("application/vnd.ms-powerpoint.presentation.macroEnabled.12", ".pptm", magic.Pptm)
+	potx = newMIME("application/vnd.openxmlformats-officedocument.presentationml.template", ".potx", magic.Potx)
+	ppsx = newMIME("application/vnd.openxmlformats-officedocument.presentationml.slideshow", ".ppsx", magic.Ppsx)
+	ppsm = newMIME("application/vnd.ms-powerpoint.slideshow.macroEnabled.12", ".ppsm", magic.Ppsm)
+	vsdx = newMIME("application/vnd.ms-visio.drawing.main+xml", ".vsdx", magic.Vsdx)
+	oxps = newMIME("application/oxps", ".oxps", magic.Oxps)
 	epub = newMIME("application/epub+zip", ".epub", magic.Epub)
 	jar  = newMIME("application/jar", ".jar", magic.Jar)
-	ole  = newMIME("application/x-ole-storage", "", magic.Ole, msi, aaf, msg, xls, pub, ppt, doc)
+	ole  = newMIME("application/x-ole-storage", "", magic.Ole, msi, aaf, encryptedOOXML, msg, xls, pub, ppt, doc, vsd, wps, mpp)
 	msi  = newMIME("application/x-ms-installer", ".msi", magic.Msi).
 		alias("application/x-windows-installer", "application/x-msi")
 	aaf = newMIME("application/octet-stream", ".aaf", magic.Aaf)
+
+	// encryptedOOXML is an OOXML document of any kind encrypted with a password.
+	encryptedOOXML = newMIME("application/x-ms-encrypted-ooxml", "", magic.EncryptedOOXML)
+
 	doc = newMIME("application/msword", ".doc", magic.Doc).
 		alias("application/vnd.ms-word")
 	ppt = newMIME("application/vnd.ms-powerpoint", ".ppt", magic.Ppt).
@@ -69,26 +110,31 @@ var (
 	pub = newMIME("application/vnd.ms-publisher", ".pub", magic.Pub)
 	xls = newMIME("application/vnd.ms-excel", ".xls", magic.Xls).
 		alias("application/msexcel")
-	msg  = newMIME("application/vnd.ms-outlook", ".msg", magic.Msg)
+	msg  = newMIME("application/vnd.ms-outlook", ".msg", magic.Msg, oft)
+	oft  = newMIME("application/vnd.ms-outlook-template", ".oft", magic.Oft)
+	vsd  = newMIME("application/vnd.visio", ".vsd", magic.Vsd)
+	wps  = newMIME("application/vnd.ms-works", ".wps", magic.Wps)
+	mpp  = newMIME("application/vnd.ms-project", ".mpp", magic.Mpp)
 	ps   = newMIME("application/postscript", ".ps", magic.Ps)
 	fits = newMIME("application/fits", ".fits", magic.Fits)
 	ogg  = newMIME("application/ogg", ".ogg", magic.Ogg, oggAudio, oggVideo).
 		alias("application/x-ogg")
 	oggAudio = newMIME("audio/ogg", ".oga", magic.OggAudio)
 	oggVideo = newMIME("video/ogg", ".ogv", magic.OggVideo)
-	text     = newMIME("text/plain", ".txt", magic.Text, html, svg, xml, php, js, lua, perl, python, json, ndJSON, rtf, srt, tcl, csv, tsv, vCard, iCalendar, warc, vtt)
-	xml      = newMIME("text/xml", ".xml", magic.XML, rss, atom, x3d, kml, xliff, collada, gml, gpx, tcx, amf, threemf, xfdf, owl2)
-	json     = newMIME("application/json", ".json", magic.JSON, geoJSON, har)
-	har      = newMIME("application/json", ".har", magic.HAR)
-	csv      = newMIME("text/csv", ".csv", magic.Csv)
-	tsv      = newMIME("text/tab-separated-values", ".tsv", magic.Tsv)
-	geoJSON  = newMIME("application/geo+json", ".geojson", magic.GeoJSON)
-	ndJSON   = newMIME("application/x-ndjson", ".ndjson", magic.NdJSON)
-	html     = newMIME("text/html", ".html", magic.HTML)
-	php      = newMIME("text/x-php", ".php", magic.Php)
-	rtf      = newMIME("text/rtf", ".rtf", magic.Rtf).alias("application/rtf")
-	js       = newMIME("application/javascript", ".js", magic.Js).
-			alias("application/x-javascript", "text/javascript")
+	text     = newMIME("text/plain", ".txt", magic.Text, html, svg, xml, php, js, lua, perl, python, json, ndJSON, rtf, srt, tcl, shell, csv, tsv, vCard, iCalendar, warc, vtt)
+	xml      = newMIME("text/xml", ".xml", magic.XML, rss, atom, x3d, kml, xliff, collada, gml, gpx, tcx, amf, threemf, xfdf, owl2).
+			alias("application/xml")
+	json    = newMIME("application/json", ".json", magic.JSON, geoJSON, har)
+	har     = newMIME("application/json", ".har", magic.HAR)
+	csv     = newMIME("text/csv", ".csv", magic.Csv)
+	tsv     = newMIME("text/tab-separated-values", ".tsv", magic.Tsv)
+	geoJSON = newMIME("application/geo+json", ".geojson", magic.GeoJSON)
+	ndJSON  = newMIME("application/x-ndjson", ".ndjson", magic.NdJSON)
+	html    = newMIME("text/html", ".html", magic.HTML)
+	php     = newMIME("text/x-php", ".php", magic.Php)
+	rtf     = newMIME("text/rtf", ".rtf", magic.Rtf).alias("application/rtf")
+	js      = newMIME("application/javascript", ".js", magic.Js).
+		alias("application/x-javascript", "text/javascript")
 	srt = newMIME("application/x-subrip", ".srt", magic.Srt).
 		alias("application/x-srt", "text/x-srt")
 	vtt    = newMIME("text/vtt", ".vtt", magic.Vtt)
@@ -98,16 +144,19 @@ var (
 		alias("text/x-script.python", "application/x-python")
 	tcl = newMIME("text/x-tcl", ".tcl", magic.Tcl).
 		alias("application/x-tcl")
+	shell = newMIME("text/x-shellscript", ".sh", magic.Shell).
+		alias("application/x-shellscript", "application/x-sh", "text/x-sh")
 	vCard     = newMIME("text/vcard", ".vcf", magic.VCard)
 	iCalendar = newMIME("text/calendar", ".ics", magic.ICalendar)
 	svg       = newMIME("image/svg+xml", ".svg", magic.Svg)
 	rss       = newMIME("application/rss+xml", ".rss", magic.Rss).
 			alias("text/rss")
-	owl2    = newMIME("application/owl+xml", ".owl", magic.Owl2)
-	atom    = newMIME("application/atom+xml", ".atom", magic.Atom)
-	x3d     = newMIME("model/x3d+xml", ".x3d", magic.X3d)
-	kml     = newMIME("application/vnd.google-earth.kml+xml", ".kml", magic.Kml)
-	xliff   = newMIME("application/x-xliff+xml", ".xlf", magic.Xliff)
+	owl2  = newMIME("application/owl+xml", ".owl", magic.Owl2)
+	atom  = newMIME("application/atom+xml", ".atom", magic.Atom)
+	x3d   = newMIME("model/x3d+xml", ".x3d", magic.X3d)
+	kml   = newMIME("application/vnd.google-earth.kml+xml", ".kml", magic.Kml)
+	xliff = newMIME("application/x-xliff+xml", ".xlf", magic.Xliff).
+		alias("application/xliff+xml")
 	collada = newMIME("model/vnd.collada+xml", ".dae", magic.Collada)
 	gml     = newMIME("application/gml+xml", ".gml", magic.Gml)
 	gpx     = newMIME("application/gpx+xml", ".gpx", magic.Gpx)
@@ -130,7 +179,8 @@ var (
 	tiff = newMIME("image/tiff", ".tiff", magic.Tiff)
 	bmp  = newMIME("image/bmp", ".bmp", magic.Bmp).
 		alias("image/x-bmp", "image/x-ms-bmp")
-	ico  = newMIME("image/x-icon", ".ico", magic.Ico)
+	ico = newMIME("image/x-icon", ".ico", magic.Ico).
+		alias("image/vnd.microsoft.icon")
 	icns = newMIME("image/x-icns", ".icns", magic.Icns)
 	psd  = newMIME("image/vnd.adobe.photoshop", ".psd", magic.Psd).
 		alias("image/x-psd", "application/photoshop")
@@ -172,26 +222,29 @@ var (
 	threeG2 = newMIME("video/3gpp2", ".3g2", magic.ThreeG2).
 		alias("video/3g2", "audio/3gpp2")
 	avi = newMIME("video/x-msvideo", ".avi", magic.Avi).
-		alias("video/avi", "video/msvideo")
+		alias("video/avi", "video/msvideo", "video/vnd.avi")
 	flv = newMIME("video/x-flv", ".flv", magic.Flv)
-	mkv = newMIME("video/x-matroska", ".mkv", magic.Mkv)
+	mkv = newMIME("video/x-matroska", ".mkv", magic.Mkv).
+		alias("video/matroska")
 	asf = newMIME("video/x-ms-asf", ".asf", magic.Asf).
-		alias("video/asf", "video/x-ms-wmv")
+		alias("video/asf", "video/x-ms-wmv", "application/vnd.ms-asf")
 	rmvb  = newMIME("application/vnd.rn-realmedia-vbr", ".rmvb", magic.Rmvb)
 	class = newMIME("application/x-java-applet", ".class", magic.Class)
-	swf   = newMIME("application/x-shockwave-flash", ".swf", magic.SWF)
-	crx   = newMIME("application/x-chrome-extension", ".crx", magic.CRX)
-	ttf   = newMIME("font/ttf", ".ttf", magic.Ttf).
+	swf   = newMIME("application/x-shockwave-flash", ".swf", magic.SWF).
+		alias("application/vnd.adobe.flash.movie")
+	crx = newMIME("application/x-chrome-extension", ".crx", magic.CRX)
+	ttf = newMIME("font/ttf", ".ttf", magic.Ttf).
 		alias("font/sfnt", "application/x-font-ttf", "application/font-sfnt")
-	woff    = newMIME("font/woff", ".woff", magic.Woff)
-	woff2   = newMIME("font/woff2", ".woff2", magic.Woff2)
-	otf     = newMIME("font/otf", ".otf", magic.Otf)
-	ttc     = newMIME("font/collection", ".ttc", magic.Ttc)
-	eot     = newMIME("application/vnd.ms-fontobject", ".eot", magic.Eot)
-	wasm    = newMIME("application/wasm", ".wasm", magic.Wasm)
-	shp     = newMIME("application/vnd.shp", ".shp", magic.Shp)
-	shx     = newMIME("application/vnd.shx", ".shx", magic.Shx, shp)
-	dbf     = newMIME("application/x-dbf", ".dbf", magic.Dbf)
+	woff  = newMIME("font/woff", ".woff", magic.Woff)
+	woff2 = newMIME("font/woff2", ".woff2", magic.Woff2)
+	otf   = newMIME("font/otf", ".otf", magic.Otf)
+	ttc   = newMIME("font/collection", ".ttc", magic.Ttc)
+	eot   = newMIME("application/vnd.ms-fontobject", ".eot", magic.Eot)
+	wasm  = newMIME("application/wasm", ".wasm", magic.Wasm)
+	shp   = newMIME("application/vnd.shp", ".shp", magic.Shp)
+	shx   = newMIME("application/vnd.shx", ".shx", magic.Shx, shp)
+	dbf   = newMIME("application/x-dbf", ".dbf", magic.Dbf).
+		alias("application/vnd.dbf")
 	exe     = newMIME("application/vnd.microsoft.portable-executable", ".exe", magic.Exe)
 	elf     = newMIME("application/x-elf", "", magic.Elf, elfObj, elfExe, elfLib, elfDump)
 	elfObj  = newMIME("application/x-object", "", magic.ElfObj)
@@ -203,7 +256,7 @@ var (
 	deb = newMIME("application/vnd.debian.binary-package", ".deb", magic.Deb)
 	rpm = newMIME("application/x-rpm", ".rpm", magic.RPM)
 	dcm = newMIME("application/dicom", ".dcm", magic.Dcm)
-	odt = newMIME("application/vnd.oasis.opendocument.text", ".odt", magic.Odt, ott).
+	odt = newMIME("application/vnd.oasis.opendocument.text", ".odt", magic.Odt, ott, odm, oth).
 		alias("application/x-vnd.oasis.opendocument.text")
 	ott = newMIME("application/vnd.oasis.opendocument.text-template", ".ott", magic.Ott).
 		alias("application/x-vnd.oasis.opendocument.text-template")
@@ -223,9 +276,20 @@ var (
 		alias("application/x-vnd.oasis.opendocument.formula")
 	odc = newMIME("application/vnd.oasis.opendocument.chart", ".odc", magic.Odc).
 		alias("application/x-vnd.oasis.opendocument.chart")
+	odm = newMIME("application/vnd.oasis.opendocument.text-master", ".odm", magic.Odm).
+		alias("application/x-vnd.oasis.opendocument.text-master")
+	oth = newMIME("application/vnd.oasis.opendocument.text-web", ".oth", magic.Oth).
+		alias("application/x-vnd.oasis.opendocument.text-web")
+	odb = newMIME("application/vnd.oasis.opendocument.base", ".odb", magic.Odb).
+		alias("application/vnd.sun.xml.base")
+	odi = newMIME("application/vnd.oasis.opendocument.image", ".odi", magic.Odi).
+		alias("application/x-vnd.oasis.opendocument.image")
 	sxc = newMIME("application/vnd.sun.xml.calc", ".sxc", magic.Sxc)
+	sxw = newMIME("application/vnd.sun.xml.writer", ".sxw", magic.Sxw)
+	sxi = newMIME("application/vnd.sun.xml.impress", ".sxi", magic.Sxi)
+	sxd = newMIME("application/vnd.sun.xml.draw", ".sxd", magic.Sxd)
 	rar = newMIME("application/x-rar-compressed", ".rar", magic.RAR).
-		alias("application/x-rar")
+		alias("application/x-rar", "application/vnd.rar")
 	djvu    = newMIME("image/vnd.djvu", ".djvu", magic.DjVu)
 	mobi    = newMIME("application/x-mobipocket-ebook", ".mobi", magic.Mobi)
 	lit     = newMIME("application/x-ms-reader", ".lit", magic.Lit)
@@ -243,10 +307,10 @@ var (
 	mrc     = newMIME("application/marc", ".mrc", magic.Marc)
 	mdb     = newMIME("application/x-msaccess", ".mdb", magic.MsAccessMdb)
 	accdb   = newMIME("application/x-msaccess", ".accdb", magic.MsAccessAce)
-	zstd    = newMIME("application/zstd", ".zst", magic.Zstd)
+	zstd    = newMIME("application/zstd", ".zst", magic.Zstd, zstdTar)
 	cab     = newMIME("application/vnd.ms-cab-compressed", ".cab", magic.Cab)
 	cabIS   = newMIME("application/x-installshield", ".cab", magic.InstallShieldCab)
-	lzip    = newMIME("application/lzip", ".lz", magic.Lzip).alias("application/x-lzip")
+	lzip    = newMIME("application/lzip", ".lz", magic.Lzip, lzipTar).alias("application/x-lzip")
 	torrent = newMIME("application/x-bittorrent", ".torrent", magic.Torrent)
 	cpio    = newMIME("application/x-cpio", ".cpio", magic.Cpio)
 	tzif    = newMIME("application/tzif", "", magic.TzIf)
@@ -257,4 +321,12 @@ var (
 	xfdf    = newMIME("application/vnd.adobe.xfdf", ".xfdf", magic.Xfdf)
 	glb     = newMIME("model/gltf-binary", ".glb", magic.Glb)
 	jxr     = newMIME("image/jxr", ".jxr", magic.Jxr).alias("image/vnd.ms-photo")
+	// Special files, as named by file(1) and shared-mime-info.
+	emptyFile        = newMIME("application/x-empty", "", never)
+	inodeDir         = newMIME("inode/directory", "", never)
+	inodeSymlink     = newMIME("inode/symlink", "", never)
+	inodeFifo        = newMIME("inode/fifo", "", never)
+	inodeSocket      = newMIME("inode/socket", "", never)
+	inodeCharDevice  = newMIME("inode/chardevice", "", never)
+	inodeBlockDevice = newMIME("inode/blockdevice", "", never)
 )
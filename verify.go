@@ -0,0 +1,165 @@
+package mimetype
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// ClaimRelation describes how a claimed MIME type relates to the MIME type
+// detected from content.
+type ClaimRelation uint8
+
+const (
+	// ClaimNone means no MIME type was claimed.
+	ClaimNone ClaimRelation = iota
+	// ClaimExact means the claimed MIME type, or one of its aliases, is the
+	// detected MIME type.
+	ClaimExact
+	// ClaimAncestor means the claimed MIME type is a less specific ancestor of
+	// the detected MIME type, ex: application/zip claimed for a docx file, or
+	// the MIME type its structured syntax suffix stands for, ex:
+	// application/xml claimed for an SVG file.
+	ClaimAncestor
+	// ClaimDescendant means the claimed MIME type is more specific than the
+	// detected MIME type and the content cannot confirm it, ex: a docx MIME
+	// type claimed for a file detected as application/zip.
+	ClaimDescendant
+	// ClaimContradicts means the claimed MIME type is unrelated to the detected
+	// MIME type, ex: image/png claimed for a PDF file.
+	ClaimContradicts
+)
+
+// String returns the name of the relation.
+func (r ClaimRelation) String() string {
+	switch r {
+	case ClaimExact:
+		return "exact"
+	case ClaimAncestor:
+		return "ancestor"
+	case ClaimDescendant:
+		return "descendant"
+	case ClaimContradicts:
+		return "contradicts"
+	default:
+		return "none"
+	}
+}
+
+// Verdict is the result of verifying a claimed MIME type and filename against
+// the content they describe.
+type Verdict struct {
+	// Detected is the MIME type detected from the content.
+	Detected *MIME
+	// Claimed is the canonical form of the claimed MIME type, as returned by
+	// Canonical. It is empty when no MIME type was claimed.
+	Claimed string
+	// Relation tells how the claimed MIME type relates to the detected one.
+	Relation ClaimRelation
+	// ExtensionMismatch is true when the filename has an extension which is
+	// not used by the detected MIME type or by any of its ancestors.
+	ExtensionMismatch bool
+}
+
+// Consistent reports whether the claims made about the content are true: the
+// claimed MIME type is the detected one or one of its ancestors, and the
+// filename extension matches the content.
+func (v Verdict) Consistent() bool {
+	return (v.Relation == ClaimExact || v.Relation == ClaimAncestor) && !v.ExtensionMismatch
+}
+
+// Verify detects the MIME type of in and checks it against the claimedType,
+// usually coming from a Content-Type header, and against the extension of
+// filename. Both claimedType and filename can be empty, in which case the
+// respective check is skipped.
+//
+// The claimed MIME type is compared with the detected MIME type, its aliases,
+// its ancestors from the hierarchy and its structured syntax suffix. MIME type
+// parameters are ignored.
+func Verify(in []byte, claimedType, filename string) Verdict {
+	v := Verdict{Detected: Detect(in)}
+	if claimedType != "" {
+		v.Claimed = Canonical(claimedType)
+		v.Relation = claimRelation(v.Detected, claimedType, v.Claimed)
+	}
+	if filename != "" {
+		v.ExtensionMismatch = !extensionMatches(v.Detected, filename)
+	}
+
+	return v
+}
+
+// claimRelation compares the detected MIME with the claimed MIME type, both in
+// its original and its canonical form.
+func claimRelation(detected *MIME, claimed, canonical string) ClaimRelation {
+	if canonical == "" {
+		return ClaimContradicts
+	}
+	is := func(m *MIME) bool {
+		return m.Is(claimed) || m.Is(canonical)
+	}
+
+	if is(detected) {
+		return ClaimExact
+	}
+	for p := detected.Parent(); p != nil; p = p.Parent() {
+		if is(p) {
+			return ClaimAncestor
+		}
+	}
+	// The MIME type a structured syntax suffix stands for, ex: application/xml
+	// for image/svg+xml, is less specific than the MIME types using the suffix.
+	for p := detected; p != nil; p = p.Parent() {
+		if p.IsWith(claimed, MatchSuffix) || p.IsWith(canonical, MatchSuffix) {
+			return ClaimAncestor
+		}
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	// The claimed node is a descendant when the detected MIME type can be found
+	// among its ancestors. Unknown MIME types with a structured syntax suffix
+	// are descendants of the node the suffix stands for.
+	var start *MIME
+	if c := root.lookupFold(canonical); c != nil {
+		start = c.Parent()
+	} else {
+		for _, t := range suffixTypes[suffix(canonical)] {
+			if start = root.lookup(t); start != nil {
+				break
+			}
+		}
+	}
+	detectedMIME, _, _ := mime.ParseMediaType(detected.String())
+	for p := start; p != nil; p = p.Parent() {
+		if p.Is(detectedMIME) {
+			return ClaimDescendant
+		}
+	}
+
+	return ClaimContradicts
+}
+
+// extensionMatches reports whether filename has no extension or has an
+// extension used by the detected MIME type or by any of its ancestors.
+// The root MIME type is skipped because it stands for any content.
+func extensionMatches(detected *MIME, filename string) bool {
+	filename = strings.ToLower(filepath.Base(filename))
+	ext := filepath.Ext(filename)
+	if ext == "" || detected.Parent() == nil {
+		return true
+	}
+
+	// The stdlib knows of extensions mimetype does not use, ex: .jpeg.
+	byExt := mime.TypeByExtension(ext)
+	for m := detected; m.Parent() != nil; m = m.Parent() {
+		if m.Extension() != "" && strings.HasSuffix(filename, m.Extension()) {
+			return true
+		}
+		if byExt != "" && m.Is(byExt) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,59 @@
+package mimetype
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	testCases := []struct {
+		file              string
+		claimed           string
+		filename          string
+		relation          ClaimRelation
+		extensionMismatch bool
+	}{
+		{"docx.docx", "", "", ClaimNone, false},
+		{"docx.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "a.docx", ClaimExact, false},
+		{"docx.docx", "application/zip", "a.zip", ClaimAncestor, false},
+		{"docx.docx", "application/x-zip-compressed", "", ClaimAncestor, false},
+		{"docx.docx", "application/octet-stream", "", ClaimAncestor, false},
+		{"docx.docx", "image/png", "a.png", ClaimContradicts, true},
+		{"zip.zip", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "a.docx", ClaimDescendant, true},
+		{"zip.zip", "application/vnd.foo+zip", "", ClaimDescendant, false},
+		{"zip.zip", "not a mime", "", ClaimContradicts, false},
+		{"zip.zip", "application/foo", "", ClaimContradicts, false},
+		{"html.html", "TEXT/HTML; charset=utf-8", "index.HTML", ClaimExact, false},
+		{"html.html", "text/plain", "index.txt", ClaimAncestor, false},
+		{"utf8.txt", "text/html", "", ClaimDescendant, false},
+		{"utf8ctrlchars", "image/png", "a.png", ClaimDescendant, false},
+		{"jpg.jpg", "image/jpeg", "photo.jpeg", ClaimExact, false},
+		{"jpg.jpg", "image/jpeg", "photo", ClaimExact, false},
+		{"jpg.jpg", "image/jpeg", "photo.exe", ClaimExact, true},
+		{"rar.rar", "application/vnd.rar", "a.rar", ClaimExact, false},
+		{"svg.svg", "application/xml", "a.svg", ClaimAncestor, false},
+		{"svg.svg", "text/xml", "a.xml", ClaimAncestor, true},
+		{"svg.svg", "application/json", "", ClaimContradicts, false},
+		{"svg.svg", "text/plain", "a.svg", ClaimAncestor, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.file+" "+tc.claimed, func(t *testing.T) {
+			in, err := os.ReadFile(filepath.Join(testDataDir, tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := Verify(in, tc.claimed, tc.filename)
+			if v.Relation != tc.relation {
+				t.Errorf("relation; expected: %s, got: %s", tc.relation, v.Relation)
+			}
+			if v.ExtensionMismatch != tc.extensionMismatch {
+				t.Errorf("extension mismatch; expected: %t, got: %t", tc.extensionMismatch, v.ExtensionMismatch)
+			}
+			consistent := (tc.relation == ClaimExact || tc.relation == ClaimAncestor) && !tc.extensionMismatch
+			if v.Consistent() != consistent {
+				t.Errorf("consistent; expected: %t, got: %t", consistent, v.Consistent())
+			}
+		})
+	}
+}